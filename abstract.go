@@ -0,0 +1,43 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxAbstractPages is the number of pages, from the start of the text, searched for an abstract
+	maxAbstractPages = 2
+
+	// maxAbstractWords limits the size of abstracts that run into the text because their end was not found
+	maxAbstractWords = 400
+)
+
+var (
+	abstractStart = regexp.MustCompile(`(?im)^\s*abstract\b[\s.:—–-]*`)
+	abstractEnd   = regexp.MustCompile(`(?im)^\s*((\d+|[IVX]+)\.?\s+)?(introduction|keywords|key words|index terms|categories and subject descriptors|ccs concepts)\b`)
+)
+
+// findAbstract returns the abstract of an academic paper, found in the first pages
+// under a heading "Abstract". It returns an empty string if there is no such heading.
+func findAbstract(pages []string) string {
+	for i, page := range pages {
+		if i == maxAbstractPages {
+			break
+		}
+		loc := abstractStart.FindStringIndex(page)
+		if loc == nil {
+			continue
+		}
+		rest := page[loc[1]:]
+		if end := abstractEnd.FindStringIndex(rest); end != nil {
+			rest = rest[:end[0]]
+		}
+		words := strings.Fields(rest)
+		if len(words) > maxAbstractWords {
+			words = words[:maxAbstractWords]
+		}
+		return strings.Join(words, " ")
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindAbstract(t *testing.T) {
+	tests := []struct {
+		pages []string
+		want  string
+	}{
+		{[]string{"A Paper\nAbstract\nWe study things.\nThey matter.\n1. Introduction\nBody"}, "We study things. They matter."},
+		{[]string{"A Paper\nABSTRACT: Short one.\nKeywords: a, b"}, "Short one."},
+		{[]string{"Title page", "Abstract — On the second page.\nIndex Terms—x"}, "On the second page."},
+		{[]string{"Title page", "Preface", "Abstract\nToo late."}, ""},
+		{[]string{"No heading here.\nAbstracting is an art."}, ""},
+		{[]string{"Abstract\n" + strings.Repeat("word ", maxAbstractWords+10)}, strings.TrimSpace(strings.Repeat("word ", maxAbstractWords))},
+	}
+	for _, tt := range tests {
+		if got := findAbstract(tt.pages); got != tt.want {
+			t.Errorf("findAbstract(%q) = %q, want %q", tt.pages, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// accessEntry is a line of the access log
+type accessEntry struct {
+	Time     string  `json:"time"`
+	Client   string  `json:"client"`
+	Method   string  `json:"method"`
+	URI      string  `json:"uri"`
+	Status   int     `json:"status"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration_ms"`
+	Agent    string  `json:"agent,omitempty"`
+}
+
+// accessLog writes a json line for each request to w
+type accessLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newAccessLog(w io.Writer) *accessLog {
+	return &accessLog{enc: json.NewEncoder(w)}
+}
+
+// log logs the requests to h
+func (l *accessLog) log(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		e := accessEntry{
+			Time:     formatTimestamp(start),
+			Client:   client,
+			Method:   r.Method,
+			URI:      r.URL.RequestURI(),
+			Status:   sw.status,
+			Bytes:    sw.bytes,
+			Duration: float64(time.Since(start).Microseconds()) / 1000,
+			Agent:    r.UserAgent(),
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if err := l.enc.Encode(e); err != nil {
+			log.Printf("can't write access log: %v", err)
+		}
+	})
+}
+
+// statusWriter records the status and the size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends the data written so far to the client
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var b bytes.Buffer
+	h := newAccessLog(&b).log(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "hello")
+	}))
+	for _, target := range []string{"/search?q=lice", "/missing"} {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = "192.0.2.7:4321"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	dec := json.NewDecoder(&b)
+	want := []accessEntry{
+		{Client: "192.0.2.7", Method: "GET", URI: "/search?q=lice", Status: 200, Bytes: 5},
+		{Client: "192.0.2.7", Method: "GET", URI: "/missing", Status: 404, Bytes: 19},
+	}
+	for _, w := range want {
+		var e accessEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Time == "" || e.Duration < 0 {
+			t.Errorf("%s: no time or duration: %+v", w.URI, e)
+		}
+		e.Time, e.Duration = "", 0
+		if e != w {
+			t.Errorf("got %+v, want %+v", e, w)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxAnnexPointerSize is the largest pointer file of an unlocked git-annex file
+const maxAnnexPointerSize = 32 << 10
+
+// errAnnexMissing is returned for annexed files whose content is not in the repository
+var errAnnexMissing = errors.New("annexed content is not present, get it with git annex get")
+
+// annexKey returns the git-annex key of the file at path, or "" if it is not annexed.
+// Locked files are symlinks to .git/annex/objects and unlocked files whose content is
+// missing are pointer files with the key. errAnnexMissing is returned with the key if
+// the content is not in the repository. The key is the same in every clone of the
+// repository, so it finds the pdf after the repository is moved, see relocateAnnexed.
+func annexKey(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !strings.Contains(filepath.ToSlash(target), "annex/objects/") {
+			return "", nil
+		}
+		key := filepath.Base(target)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return key, errAnnexMissing
+		}
+		return key, nil
+	}
+	if !info.Mode().IsRegular() || info.Size() > maxAnnexPointerSize {
+		return "", nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", nil
+	}
+	if line = strings.TrimSpace(line); strings.HasPrefix(line, "/annex/objects/") {
+		return filepath.Base(line), errAnnexMissing
+	}
+	return "", nil
+}
+
+// relocateAnnexed moves the pdfs added from a git-annex repository to the files with
+// their keys in the repository at root, a clone or the repository moved, and writes the
+// moves to w
+func relocateAnnexed(root string, w io.Writer) error {
+	paths := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("walk error %s: %v", path, err)
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if key, err := annexKey(path); key != "" && (err == nil || errors.Is(err, errAnnexMissing)) {
+			paths[key] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(annexedSQL)
+	if err != nil {
+		return err
+	}
+	type move struct {
+		id       int
+		from, to string
+	}
+	var moves []move
+	for rows.Next() {
+		var (
+			m   move
+			key string
+		)
+		if err := rows.Scan(&m.id, &m.from, &key); err != nil {
+			rows.Close()
+			return err
+		}
+		if m.to = paths[key]; m.to != "" && m.to != m.from {
+			moves = append(moves, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range moves {
+		if err := updatePDF(m.id, "move", "pdf with id %d not found", relocateSQL, m.to, m.id); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "[%d] %s -> %s\n", m.id, m.from, m.to)
+	}
+	return nil
+}
+
+const (
+	annexedSQL = `SELECT id, path, annex_key FROM pdfs WHERE annex_key IS NOT NULL`
+
+	relocateSQL = `UPDATE pdfs SET path = ? WHERE id = ?`
+)
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnnexKey(t *testing.T) {
+	dir := t.TempDir()
+	const key = "SHA256E-s8--2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae.pdf"
+	object := filepath.Join(".git", "annex", "objects", "Xq", "3j", key, key)
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(object)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		object:         "%PDF-1.4",
+		"plain.pdf":    "%PDF-1.4",
+		"unlocked.pdf": "/annex/objects/" + key + "\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"locked.pdf":  object,
+		"missing.pdf": filepath.Join(".git", "annex", "objects", "Ab", "cd", "MD5E-s1--x.pdf", "MD5E-s1--x.pdf"),
+		"link.pdf":    "plain.pdf",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		missing bool
+	}{
+		{"plain.pdf", "", false},
+		{"link.pdf", "", false},
+		{"locked.pdf", key, false},
+		{"missing.pdf", "MD5E-s1--x.pdf", true},
+		{"unlocked.pdf", key, true},
+	}
+	for _, tt := range tests {
+		got, err := annexKey(filepath.Join(dir, tt.name))
+		if err != nil && !errors.Is(err, errAnnexMissing) {
+			t.Errorf("annexKey(%s) failed: %v", tt.name, err)
+			continue
+		}
+		if got != tt.key || errors.Is(err, errAnnexMissing) != tt.missing {
+			t.Errorf("annexKey(%s) = %q, %v, want %q, missing %v", tt.name, got, err, tt.key, tt.missing)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+//go:build fts5
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// apiPageSize is the default number of search results in a page of the api
+	apiPageSize = 20
+
+	// apiMaxPageSize is the most search results in a page of the api
+	apiMaxPageSize = 100
+)
+
+// apiSearchResponse is a page of the results of a search
+type apiSearchResponse struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Page    int            `json:"page"`
+	PerPage int            `json:"per_page"`
+	Pages   int            `json:"pages"`
+	Results []searchResult `json:"results"`
+}
+
+// apiTag is a keyword and the number of pdfs with it
+type apiTag struct {
+	Tag  string `json:"tag"`
+	PDFs int    `json:"pdfs"`
+}
+
+// handleAPISearch writes the page, in the parameters page and per_page, of the results of
+// the query in the parameter q
+func (s *server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	if !apiMethod(w, r) {
+		return
+	}
+	resp := apiSearchResponse{Query: strings.TrimSpace(r.FormValue("q")), Page: pageParam(r), PerPage: apiPageSize}
+	if resp.Query == "" {
+		apiError(w, http.StatusBadRequest, "missing query q")
+		return
+	}
+	s.searches.Add(1)
+	if v := r.FormValue("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > apiMaxPageSize {
+			apiError(w, http.StatusBadRequest, "per_page must be from 1 to "+strconv.Itoa(apiMaxPageSize))
+			return
+		}
+		resp.PerPage = n
+	}
+
+	var err error
+	if resp.Total, err = searchCount(r.Context(), searchCountSQL, resp.Query, filter{}); timedOut(r) {
+		apiServerError(w, r, err)
+		return
+	} else if err != nil {
+		apiError(w, http.StatusBadRequest, "bad query: "+err.Error())
+		return
+	}
+	resp.Pages = (resp.Total + resp.PerPage - 1) / resp.PerPage
+	opts := searchOptions{limit: resp.PerPage, offset: (resp.Page - 1) * resp.PerPage, tokens: 16, snippets: 1}
+	if resp.Results, err = search(r.Context(), searchStmt, resp.Query, opts, filter{}, io.Discard, resultFormat{}); err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	if resp.Results == nil {
+		resp.Results = []searchResult{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAPIDoc writes the details of the pdf with the id in the path /api/docs/{id}, or
+// its cover for /api/docs/{id}/cover
+func (s *server) handleAPIDoc(w http.ResponseWriter, r *http.Request) {
+	if !apiMethod(w, r) {
+		return
+	}
+	ref := strings.TrimPrefix(r.URL.Path, "/api/docs/")
+	cover := strings.HasSuffix(ref, "/cover")
+	ref = strings.TrimSuffix(ref, "/cover")
+	id, err := strconv.Atoi(ref)
+	if err != nil {
+		apiError(w, http.StatusNotFound, "no pdf "+ref)
+		return
+	}
+	if cover {
+		s.serveCover(w, r, id)
+		return
+	}
+	v, err := s.pdfView(r.Context(), id)
+	if errors.Is(err, errNotFound) {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// handleAPITags writes the keywords of the pdfs, the most common first
+func (s *server) handleAPITags(w http.ResponseWriter, r *http.Request) {
+	if !apiMethod(w, r) {
+		return
+	}
+	counts, err := keywordCounts(r.Context())
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	tags := make([]apiTag, len(counts))
+	for i, c := range counts {
+		tags[i] = apiTag{c.term, int(c.weight)}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// cors lets the pages of the cors origins of s call the api in h. It answers the preflight
+// requests of browsers and marks the responses of the api to the origins allowed.
+func (s *server) cors(h http.Handler) http.Handler {
+	if len(s.corsOrigins) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !strings.HasPrefix(r.URL.Path, "/api/") || origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if indexOf(s.corsOrigins, "*") >= 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if indexOf(s.corsOrigins, origin) >= 0 {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// apiMethod reports whether the method of r is GET or HEAD, the methods of the api, and
+// writes an error if it is not
+func apiMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+// apiServerError logs err and writes an internal server error, or a gateway timeout if
+// the request took longer than the query timeout
+func apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("%s: %v", r.URL, err)
+	status := http.StatusInternalServerError
+	if timedOut(r) {
+		status = http.StatusGatewayTimeout
+	}
+	apiError(w, status, http.StatusText(status))
+}
+
+// apiError writes msg as a json error with status
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writeJSON writes v as json with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("failed to write json: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// restoreDatabase replaces the contents of the db with the backup at path. The backup is
+// checked first: its schema must be supported and both the database and the full text
+// index must pass their integrity checks. The replaced db is kept as a backup next to it,
+// with the extension .bak.
+func restoreDatabase(path string) error {
+	if err := checkBackup(path); err != nil {
+		return fmt.Errorf("backup check failed: %w", err)
+	}
+
+	bak := databasePath + ".bak"
+	if err := os.Remove(bak); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := backupDatabase(bak); err != nil {
+		return fmt.Errorf("failed to keep the current database: %w", err)
+	}
+
+	if err := restoreFrom(path); err != nil {
+		return err
+	}
+	return migrate(db)
+}
+
+// checkBackup checks that the backup at path can be restored
+func checkBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	// not read only, the integrity check of the full text index is an insert that writes nothing
+	b, err := sql.Open(driverName, "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	var version int
+	if err := b.QueryRow(getVersionSQL).Scan(&version); err != nil {
+		return fmt.Errorf("not a booklice database: %w", err)
+	}
+	if version == 0 || version > len(migrations) {
+		return fmt.Errorf("unsupported schema version %d", version)
+	}
+
+	problems, err := integrityProblems(b)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// backupDatabase writes a consistent snapshot of the db to a new database at path, using
+// the sqlite3 backup api. It is safe to run while other processes use the db.
+func backupDatabase(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return backupTo(path)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// citationPages is the number of pages at the start of the text searched for a DOI and a year
+const citationPages = 3
+
+var (
+	doiPattern = regexp.MustCompile(`(?i)\b(10\.\d{4,9}/[-._;()/:a-z0-9]*[a-z0-9])`)
+
+	// copyrightYearPattern matches the year of a copyright notice, the best guess of the
+	// year of publication in the text
+	copyrightYearPattern = regexp.MustCompile(`(?i)(?:©|\(c\)|copyright)\s*(?:©\s*)?((?:19|20)\d\d)\b`)
+
+	bibtexEscaper = strings.NewReplacer(`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`, `&`, `\&`, `%`, `\%`, `#`, `\#`, `$`, `\$`, `_`, `\_`)
+
+	// bibtexFileEscaper escapes the separators of the file field of Zotero and JabRef
+	bibtexFileEscaper = strings.NewReplacer(`\`, `\\`, `:`, `\:`, `;`, `\;`)
+)
+
+// bibEntry is an entry of a BibTeX file
+type bibEntry struct {
+	typ    string // like book or misc
+	key    string
+	fields [][2]string // names and values, empty values are skipped
+}
+
+// write writes e to w. The values, except file, are escaped for LaTeX and the title is
+// braced twice so that its case is kept.
+func (e bibEntry) write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@%s{%s,\n", e.typ, e.key)
+	for _, f := range e.fields {
+		name, value := f[0], f[1]
+		switch {
+		case value == "":
+			continue
+		case name == "title":
+			value = "{" + bibtexEscaper.Replace(value) + "}"
+		case name != "file":
+			value = bibtexEscaper.Replace(value)
+		}
+		fmt.Fprintf(&b, "  %s = {%s},\n", name, value)
+	}
+	b.WriteString("}\n\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// bibFile returns the file field of the pdf at path, as imported by Zotero
+func bibFile(title, path string) string {
+	return bibtexFileEscaper.Replace(title) + ":" + bibtexFileEscaper.Replace(path) + ":application/pdf"
+}
+
+// bibAuthors returns the authors separated by &, like Knuth, Donald & Graham, Ronald, as
+// separated in BibTeX
+func bibAuthors(authors string) string {
+	var names []string
+	for _, a := range strings.Split(authors, "&") {
+		if a = strings.TrimSpace(a); a != "" {
+			names = append(names, a)
+		}
+	}
+	return strings.Join(names, " and ")
+}
+
+// bibKey returns the citation key of the pdf with id, the surname of the first author
+// and the year if known, followed by the id to make it unique
+func bibKey(id int, authors, year string) string {
+	first, _, _ := strings.Cut(authors, "&")
+	surname, _, found := strings.Cut(first, ",")
+	if !found {
+		if f := strings.Fields(first); len(f) > 0 {
+			surname = f[len(f)-1]
+		}
+	}
+	key := strings.ToLower(nonAlnum.ReplaceAllString(surname, ""))
+	if key == "" {
+		key = "pdf"
+	}
+	return key + year + "-" + strconv.Itoa(id)
+}
+
+// findDOI returns the first DOI in the first pages of a pdf
+func findDOI(pages []string) string {
+	for i, page := range pages {
+		if i >= citationPages {
+			break
+		}
+		if m := doiPattern.FindStringSubmatch(page); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// findYear returns the year of the first copyright notice in the first pages of a pdf
+func findYear(pages []string) string {
+	for i, page := range pages {
+		if i >= citationPages {
+			break
+		}
+		if m := copyrightYearPattern.FindStringSubmatch(page); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
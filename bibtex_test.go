@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBibEntry(t *testing.T) {
+	e := bibEntry{typ: "book", key: "knuth1994-3", fields: [][2]string{
+		{"title", "Concrete Mathematics: A {Foundation} for CS"},
+		{"author", "Graham, Ronald and Knuth, Donald"},
+		{"year", ""},
+		{"keywords", "sums & recurrences, 100%"},
+		{"file", bibFile("Concrete", `/pdfs/a:b;c\d.pdf`)},
+	}}
+	var b strings.Builder
+	if err := e.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `@book{knuth1994-3,
+  title = {{Concrete Mathematics: A \{Foundation\} for CS}},
+  author = {Graham, Ronald and Knuth, Donald},
+  keywords = {sums \& recurrences, 100\%},
+  file = {Concrete:/pdfs/a\:b\;c\\d.pdf:application/pdf},
+}
+
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestBibAuthors(t *testing.T) {
+	if got := bibAuthors("Knuth, Donald & Graham, Ronald &"); got != "Knuth, Donald and Graham, Ronald" {
+		t.Errorf("bibAuthors = %q", got)
+	}
+}
+
+func TestBibKey(t *testing.T) {
+	tests := []struct {
+		id      int
+		authors string
+		year    string
+		want    string
+	}{
+		{3, "Knuth, Donald & Graham, Ronald", "1994", "knuth1994-3"},
+		{4, "Donald E. Knuth", "", "knuth-4"},
+		{5, "", "2001", "pdf2001-5"},
+		{6, "Gödel, Kurt", "", "gödel-6"},
+	}
+	for _, tt := range tests {
+		if got := bibKey(tt.id, tt.authors, tt.year); got != tt.want {
+			t.Errorf("bibKey(%d, %q, %q) = %q, want %q", tt.id, tt.authors, tt.year, got, tt.want)
+		}
+	}
+}
+
+func TestFindDOIAndYear(t *testing.T) {
+	pages := []string{
+		"The Art of SQL\nCopyright © 2006 O'Reilly Media",
+		"Published as doi:10.1145/1234567.890123. See https://doi.org/10.1000/xyz",
+		"Copyright 1999 on page 3",
+		"10.9999/too.late",
+	}
+	if got := findDOI(pages); got != "10.1145/1234567.890123" {
+		t.Errorf("findDOI = %q", got)
+	}
+	if got := findYear(pages); got != "2006" {
+		t.Errorf("findYear = %q", got)
+	}
+	if got := findDOI(pages[3:]); got != "10.9999/too.late" {
+		t.Errorf("findDOI of one page = %q", got)
+	}
+	if got := findYear([]string{"no notice 2006"}); got != "" {
+		t.Errorf("findYear without a notice = %q", got)
+	}
+}
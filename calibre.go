@@ -0,0 +1,98 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// importedPDF is a pdf of another library, like Calibre or Zotero, with its metadata there
+type importedPDF struct {
+	path string // of the pdf file
+	meta pdfMeta
+}
+
+// addImported adds the pdfs with their metadata. Pdfs already in the index are skipped,
+// so that a library can be mirrored by importing it again.
+func addImported(pdfs []importedPDF) {
+	for _, p := range pdfs {
+		if err := addPDFMeta(p.path, p.meta); err != nil {
+			log.Printf("add error %s: %v", p.path, err)
+		}
+	}
+}
+
+// importCalibre adds the pdfs of the books of the Calibre library in dir, with the titles,
+// authors, tags and covers of the library
+func importCalibre(dir string) error {
+	books, err := calibreBooks(dir)
+	if err != nil {
+		return err
+	}
+	addImported(books)
+	return nil
+}
+
+// calibreBooks reads the pdfs of the books from the metadata.db of the library in dir
+func calibreBooks(dir string) ([]importedPDF, error) {
+	metadata := filepath.Join(dir, "metadata.db")
+	if _, err := os.Stat(metadata); err != nil {
+		return nil, fmt.Errorf("%s is not a Calibre library: %w", dir, err)
+	}
+	lib, err := sql.Open(driverName, "file:"+metadata+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer lib.Close()
+
+	rows, err := lib.Query(calibreBooksSQL)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the books of %s: %w", metadata, err)
+	}
+	defer rows.Close()
+
+	var books []importedPDF
+	for rows.Next() {
+		var (
+			title, path, name, authors, tags string
+			hasCover                         bool
+		)
+		if err := rows.Scan(&title, &path, &name, &hasCover, &authors, &tags); err != nil {
+			return nil, err
+		}
+		// calibre stores paths with / on all systems
+		bookDir := filepath.Join(dir, filepath.FromSlash(path))
+		b := importedPDF{
+			path: filepath.Join(bookDir, name+".pdf"),
+			meta: pdfMeta{title: title, authors: authors},
+		}
+		if tags != "" {
+			b.meta.tags = strings.Split(tags, "\x1f")
+		}
+		if hasCover {
+			cover, err := os.ReadFile(filepath.Join(bookDir, "cover.jpg"))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			b.meta.cover = cover
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// calibreBooksSQL lists the books of a Calibre library that have a pdf. The authors are
+// in the order of the library, the tags are separated by the unit separator \x1f, since
+// tags may have commas.
+const calibreBooksSQL = `SELECT books.title, books.path, data.name, books.has_cover, ` +
+	`IFNULL((SELECT group_concat(name, ' & ') FROM (SELECT authors.name AS name FROM books_authors_link ` +
+	`JOIN authors ON authors.id = books_authors_link.author WHERE books_authors_link.book = books.id ORDER BY books_authors_link.id)), ''), ` +
+	`IFNULL((SELECT group_concat(tags.name, char(31)) FROM books_tags_link JOIN tags ON tags.id = books_tags_link.tag ` +
+	`WHERE books_tags_link.book = books.id), '') ` +
+	`FROM books JOIN data ON data.book = books.id WHERE data.format = 'PDF' ORDER BY books.id`
@@ -0,0 +1,135 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+)
+
+// checkDatabase runs the integrity checks of sqlite3 and of the full text indexes on the db
+// and writes to w the problems found. It returns an error if there are any.
+func checkDatabase(w io.Writer) error {
+	problems, err := integrityProblems(db)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	fmt.Fprintln(w, "ok")
+	return nil
+}
+
+// integrityProblems checks the database d and returns a description of each problem found
+func integrityProblems(d *sql.DB) ([]string, error) {
+	var problems []string
+
+	rows, err := d.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, err
+		}
+		if result != "ok" {
+			problems = append(problems, "database: "+result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := []string{"pdfs_fts"}
+	var trigram int
+	if err := d.QueryRow(trigramExistsSQL).Scan(&trigram); err != nil {
+		return nil, err
+	}
+	if trigram > 0 {
+		indexes = append(indexes, "pdfs_trigram")
+	}
+
+	for _, index := range indexes {
+		if _, err := d.Exec(fmt.Sprintf(ftsIndexCheckSQL, index)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", index, err))
+		}
+
+		missing, err := queryPDFs(d, fmt.Sprintf(ftsMissingSQL, index))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range missing {
+			problems = append(problems, fmt.Sprintf("%s: [%d] %s is not indexed", index, p.id, p.path))
+		}
+
+		orphaned, err := queryIDs(d, fmt.Sprintf(ftsOrphanedSQL, index))
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range orphaned {
+			problems = append(problems, fmt.Sprintf("%s: [%d] is indexed but not in pdfs", index, id))
+		}
+	}
+	return problems, nil
+}
+
+type pdfRef struct {
+	id   int
+	path string
+}
+
+// queryPDFs returns the id and the path of the pdfs selected by query
+func queryPDFs(d *sql.DB, query string) ([]pdfRef, error) {
+	rows, err := d.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []pdfRef
+	for rows.Next() {
+		var r pdfRef
+		if err := rows.Scan(&r.id, &r.path); err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
+
+// queryIDs returns the ids selected by query
+func queryIDs(d *sql.DB, query string) ([]int, error) {
+	rows, err := d.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const (
+	// ftsIndexCheckSQL checks that the full text index %s matches its content
+	ftsIndexCheckSQL = `INSERT INTO %[1]s(%[1]s, rank) VALUES('integrity-check', 1)`
+
+	// ftsMissingSQL selects the pdfs that are not in the full text index %s
+	ftsMissingSQL = `SELECT id, path FROM pdfs WHERE id NOT IN (SELECT id FROM %s_docsize) ORDER BY id`
+
+	// ftsOrphanedSQL selects the rows of the full text index %s without a pdf
+	ftsOrphanedSQL = `SELECT id FROM %s_docsize WHERE id NOT IN (SELECT id FROM pdfs) ORDER BY id`
+)
@@ -0,0 +1,47 @@
+//go:build fts5
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelocateKeepsIndex(t *testing.T) {
+	openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	const key = "MD5E-s8--0123456789abcdef0123456789abcdef.pdf"
+	if _, err := insertStmt.Exec("/old/library/go.pdf", 1, "sig1", "Go is a language", nil, "2024-03-01T10:00:00Z", "", "", "", "", "", nil, "", "", "add", nil, key); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(t.TempDir(), "moved")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(".git", "annex", "objects", "Ab", "cd", key, key), filepath.Join(root, "go.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := relocateAnnexed(root, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := integrityProblems(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("integrityProblems() after relocate = %q", problems)
+	}
+	for query, want := range map[string]int{"path:moved": 1, "path:old": 0} {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pdfs_fts WHERE pdfs_fts MATCH ?`, query).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("%s matches %d pdfs, want %d", query, n, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// deflate compresses, and encrypts if a key is loaded, the text of a pdf for storing it.
+// Values that are already compressed, and NULLs, are returned unchanged. It is registered
+// as an sql function.
+func deflate(v interface{}) (interface{}, error) {
+	var data []byte
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		data = []byte(x)
+	case []byte:
+		if x == nil {
+			return nil, nil
+		}
+		if bytes.HasPrefix(x, gzipMagic) || isSealed(x) {
+			return x, nil
+		}
+		data = x
+	default:
+		return v, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return seal(buf.Bytes())
+}
+
+// inflate returns the text of a pdf as stored by deflate. Texts stored uncompressed,
+// by older versions, are returned as they are. It is registered as an sql function.
+func inflate(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case []byte:
+		if x == nil {
+			return nil, nil
+		}
+		x, err := unseal(x)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(x, gzipMagic) {
+			return string(x), nil
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(x))
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	default:
+		return v, nil
+	}
+}
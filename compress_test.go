@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeflateInflate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want interface{}
+	}{
+		{"nil", nil, nil},
+		{"empty", "", ""},
+		{"text", "some text\fnext page", "some text\fnext page"},
+		{"unicode", "καλημέρα κόσμε", "καλημέρα κόσμε"},
+		{"int", int64(3), int64(3)},
+	}
+	for _, tt := range tests {
+		stored, err := deflate(tt.in)
+		if err != nil {
+			t.Fatalf("%s: deflate: %v", tt.name, err)
+		}
+		if s, ok := stored.([]byte); ok && !bytes.HasPrefix(s, gzipMagic) {
+			t.Errorf("%s: deflate stored %q, want gzip", tt.name, s)
+		}
+		got, err := inflate(stored)
+		if err != nil {
+			t.Fatalf("%s: inflate: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: inflate(deflate(%v)) = %v, want %v", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDeflateCompressed(t *testing.T) {
+	stored, err := deflate("text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := deflate(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.([]byte), stored.([]byte)) {
+		t.Errorf("deflate compressed the compressed text again")
+	}
+}
+
+func TestInflateUncompressed(t *testing.T) {
+	// older versions stored the text as it is
+	got, err := inflate([]byte("plain text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "plain text" {
+		t.Errorf("inflate = %v, want plain text", got)
+	}
+}
@@ -0,0 +1,78 @@
+//go:build fts5
+
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+)
+
+// coverHash returns the key of a cover in the covers table. It is the sha256 of the
+// cover before encryption, so that identical covers are stored once with or without
+// a key. Covers encrypted with another key are hashed as stored.
+func coverHash(cover []byte) string {
+	if plain, err := unseal(cover); err == nil {
+		cover = plain
+	}
+	sum := sha256.Sum256(cover)
+	return hex.EncodeToString(sum[:])
+}
+
+// migrateCovers moves the covers stored in pdfs to the covers table, where identical
+// covers, like blank pages or the same scan, are stored once.
+func migrateCovers(tx *sql.Tx) error {
+	if _, err := tx.Exec(coversSQL); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, cover FROM pdfs WHERE cover IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	// only the hashes are kept in memory, the covers are copied by the first pdf using them
+	hashes := make(map[int]string)
+	firsts := make(map[string]int)
+	for rows.Next() {
+		var (
+			id    int
+			cover []byte
+		)
+		if err := rows.Scan(&id, &cover); err != nil {
+			rows.Close()
+			return err
+		}
+		h := coverHash(cover)
+		hashes[id] = h
+		if _, ok := firsts[h]; !ok {
+			firsts[h] = id
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for h, id := range firsts {
+		if _, err := tx.Exec(`INSERT INTO covers(hash, data) SELECT ?, cover FROM pdfs WHERE id = ?`, h, id); err != nil {
+			return err
+		}
+	}
+	for id, h := range hashes {
+		if _, err := tx.Exec(`UPDATE pdfs SET cover = NULL, cover_hash = ? WHERE id = ?`, h, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	coversSQL = `CREATE TABLE covers(hash TEXT PRIMARY KEY, data BLOB NOT NULL);
+ALTER TABLE pdfs ADD COLUMN cover_hash TEXT;
+CREATE INDEX pdfs_cover_hash ON pdfs(cover_hash);`
+
+	insertCoverSQL = `INSERT OR IGNORE INTO covers(hash, data) VALUES(?, ?)`
+
+	// orphanCoversSQL deletes the covers no pdf uses
+	orphanCoversSQL = `DELETE FROM covers WHERE hash NOT IN (SELECT cover_hash FROM pdfs WHERE cover_hash IS NOT NULL)`
+)
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timestampLayout is the format of the stored timestamps. It is UTC with a fixed width,
+// so that timestamps sort as strings, and it is understood by the sqlite3 date functions.
+const timestampLayout = "2006-01-02T15:04:05Z"
+
+// legacyTimestampLayouts are the formats of timestamps stored by older versions
+var legacyTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339Nano,
+}
+
+// dateRange selects the pdfs added in [since, until). Empty bounds are open.
+type dateRange struct {
+	since, until string
+}
+
+// args returns the arguments for the :since and :until parameters of a statement
+func (r dateRange) args() []interface{} {
+	return []interface{}{sql.Named("since", r.since), sql.Named("until", r.until)}
+}
+
+// formatTimestamp formats t for storing
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// parseLegacyTimestamp parses a timestamp stored by an older version
+func parseLegacyTimestamp(s string) (time.Time, error) {
+	// the monotonic clock reading of time.Time.String
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	for _, layout := range legacyTimestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown timestamp format %q", s)
+}
+
+// newDateRange returns the range of the dates since and until, both inclusive and in
+// the local time zone. A date is either 2006-01-02 or a RFC3339 timestamp, which is exact.
+func newDateRange(since, until string) (dateRange, error) {
+	var r dateRange
+	if since != "" {
+		t, _, err := parseDate(since)
+		if err != nil {
+			return r, err
+		}
+		r.since = formatTimestamp(t)
+	}
+	if until != "" {
+		t, day, err := parseDate(until)
+		if err != nil {
+			return r, err
+		}
+		if day {
+			t = t.AddDate(0, 0, 1)
+		} else {
+			t = t.Add(time.Second)
+		}
+		r.until = formatTimestamp(t)
+	}
+	return r, nil
+}
+
+// parseDate parses a date given by the user and reports whether it is a whole day
+func parseDate(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("bad date %q, use 2006-01-02 or 2006-01-02T15:04:05Z", s)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLegacyTimestamp(t *testing.T) {
+	want := time.Date(2023, 5, 14, 18, 30, 12, 123456789, time.UTC)
+	tests := []string{
+		"2023-05-14 21:30:12.123456789+03:00",
+		"2023-05-14 21:30:12.123456789 +0300 EEST",
+		"2023-05-14 21:30:12.123456789 +0300 EEST m=+0.012345678",
+		"2023-05-14T21:30:12.123456789+03:00",
+		"2023-05-14T18:30:12.123456789Z",
+	}
+	for _, s := range tests {
+		got, err := parseLegacyTimestamp(s)
+		if err != nil {
+			t.Errorf("parseLegacyTimestamp(%q): %v", s, err)
+		} else if !got.Equal(want) {
+			t.Errorf("parseLegacyTimestamp(%q) = %v, want %v", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"", "yesterday", "14/05/2023"} {
+		if _, err := parseLegacyTimestamp(s); err == nil {
+			t.Errorf("parseLegacyTimestamp(%q) succeeded", s)
+		}
+	}
+}
+
+func TestNewDateRange(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("EET", 2*60*60)
+	defer func() { time.Local = local }()
+
+	tests := []struct {
+		since, until string
+		want         dateRange
+	}{
+		{"", "", dateRange{}},
+		{"2024-01-01", "", dateRange{since: "2023-12-31T22:00:00Z"}},
+		{"", "2024-12-31", dateRange{until: "2024-12-31T22:00:00Z"}},
+		{"2024-03-01", "2024-03-01", dateRange{"2024-02-29T22:00:00Z", "2024-03-01T22:00:00Z"}},
+		{"2024-03-01T10:00:00Z", "2024-03-01T12:00:00+02:00", dateRange{"2024-03-01T10:00:00Z", "2024-03-01T10:00:01Z"}},
+	}
+	for _, tt := range tests {
+		got, err := newDateRange(tt.since, tt.until)
+		if err != nil {
+			t.Errorf("newDateRange(%q, %q): %v", tt.since, tt.until, err)
+		} else if got != tt.want {
+			t.Errorf("newDateRange(%q, %q) = %+v, want %+v", tt.since, tt.until, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"2024-13-01", "01/02/2024", "2024-01-01 10:00"} {
+		if _, err := newDateRange(bad, ""); err == nil {
+			t.Errorf("newDateRange(%q, \"\") succeeded", bad)
+		}
+		if _, err := newDateRange("", bad); err == nil {
+			t.Errorf("newDateRange(\"\", %q) succeeded", bad)
+		}
+	}
+}
@@ -4,28 +4,54 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"regexp"
+	"strings"
 )
 
+// tokenizeOption matches the tokenize option in the definition of the full text index
+var tokenizeOption = regexp.MustCompile(`tokenize="((?:[^"]|"")*)"`)
+
 var (
-	db         *sql.DB
-	insertStmt *sql.Stmt
-	coverStmt  *sql.Stmt
-	searchStmt *sql.Stmt
-	listStmt   *sql.Stmt
-	existsStmt *sql.Stmt
+	db           *sql.DB
+	databasePath string
+	insertStmt   *sql.Stmt
+	coverStmt    *sql.Stmt
+	searchStmt   *sql.Stmt
+	listStmt     *sql.Stmt
+	existsStmt   *sql.Stmt
+	infoStmt     *sql.Stmt
+	countStmt    *sql.Stmt
+	dfStmt       *sql.Stmt
+	termsStmt    *sql.Stmt
+	similarStmt  *sql.Stmt
+	topicsStmt   *sql.Stmt
+	dupesStmt    *sql.Stmt
+
+	// trigramSearchStmt is nil if the trigram index is not enabled
+	trigramSearchStmt *sql.Stmt
+
+	// readOnly opens the db and the libraries read-only. Set it before openDatabase.
+	readOnly bool
 )
 
-// openDatabase initializes the db
+// busyTimeout is how long, in milliseconds, a connection waits for a lock held by another
+// process, like a long running add, before failing with "database is locked"
+const busyTimeout = 10000
+
+// openDatabase initializes the db. The db is in WAL mode so that readers and a writer
+// do not block each other.
 func openDatabase(dataSourceName string) {
-	if d, err := sql.Open("sqlite3", "file:"+dataSourceName); err == nil {
+	databasePath = dataSourceName
+	if d, err := sql.Open(mainDriverName, databaseDSN(dataSourceName)); err == nil {
 		db = d
 	} else {
 		log.Fatalf("can't open database %s: %s", dataSourceName, err)
 	}
 
-	if _, err := db.Exec(schemaSQL); err != nil {
-		log.Fatalf("can't create schema: %s", err)
+	if err := migrate(db); err != nil {
+		log.Fatalf("can't migrate schema: %s", err)
 	}
 
 	if stmt, err := db.Prepare(insertSQL); err == nil {
@@ -40,7 +66,7 @@ func openDatabase(dataSourceName string) {
 		log.Fatalf("can't prepare cover statement: %s", err)
 	}
 
-	if stmt, err := db.Prepare(searchSQL); err == nil {
+	if stmt, err := db.Prepare(fmt.Sprintf(searchSQL, defaultRank)); err == nil {
 		searchStmt = stmt
 	} else {
 		log.Fatalf("can't prepare search statement: %s", err)
@@ -57,6 +83,138 @@ func openDatabase(dataSourceName string) {
 	} else {
 		log.Fatalf("can't prepare exists statement: %s", err)
 	}
+
+	if stmt, err := db.Prepare(infoSQL); err == nil {
+		infoStmt = stmt
+	} else {
+		log.Fatalf("can't prepare info statement: %s", err)
+	}
+
+	if stmt, err := db.Prepare(countSQL); err == nil {
+		countStmt = stmt
+	} else {
+		log.Fatalf("can't prepare count statement: %s", err)
+	}
+
+	if stmt, err := db.Prepare(dfSQL); err == nil {
+		dfStmt = stmt
+	} else {
+		log.Fatalf("can't prepare df statement: %s", err)
+	}
+
+	if stmt, err := db.Prepare(termsSQL); err == nil {
+		termsStmt = stmt
+	} else {
+		log.Fatalf("can't prepare terms statement: %s", err)
+	}
+
+	if stmt, err := db.Prepare(similarSQL); err == nil {
+		similarStmt = stmt
+	} else {
+		log.Fatalf("can't prepare similar statement: %s", err)
+	}
+
+	if stmt, err := db.Prepare(topicsSQL); err == nil {
+		topicsStmt = stmt
+	} else {
+		log.Fatalf("can't prepare topics statement: %s", err)
+	}
+
+	if stmt, err := db.Prepare(dupesSQL); err == nil {
+		dupesStmt = stmt
+	} else {
+		log.Fatalf("can't prepare dupes statement: %s", err)
+	}
+
+	if err := prepareTrigram(); err != nil {
+		log.Fatalf("can't prepare trigram search statement: %s", err)
+	}
+}
+
+// prepareTrigram prepares trigramSearchStmt if the trigram index is enabled
+func prepareTrigram() error {
+	var exists int
+	if err := db.QueryRow(trigramExistsSQL).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		trigramSearchStmt = nil
+		return nil
+	}
+	stmt, err := db.Prepare(trigramSearchSQL)
+	if err != nil {
+		return err
+	}
+	trigramSearchStmt = stmt
+	return nil
+}
+
+// tokenizer returns the tokenizer of the full text index, as given in its definition.
+// It returns an empty string for the default unicode61 tokenizer.
+func tokenizer() (string, error) {
+	var def string
+	if err := db.QueryRow(ftsDefinitionSQL).Scan(&def); err != nil {
+		return "", err
+	}
+	return definedTokenizer(def), nil
+}
+
+// definedTokenizer returns the tokenizer given in def, the definition of the full text index
+func definedTokenizer(def string) string {
+	if m := tokenizeOption.FindStringSubmatch(def); m != nil {
+		return strings.ReplaceAll(m[1], `""`, `"`)
+	}
+	return ""
+}
+
+// ftsTableDef returns the definition of the full text index with tokenizer
+func ftsTableDef(tokenizer string) string {
+	return fmt.Sprintf(ftsTableSQL, `"`+strings.ReplaceAll(tokenizer, `"`, `""`)+`"`)
+}
+
+// retokenize recreates the full text index with tokenizer and rebuilds it from the stored text
+func retokenize(tokenizer string) error {
+	def := ftsTableDef(tokenizer)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{`DROP TABLE pdfs_fts`, def, `INSERT INTO pdfs_fts(pdfs_fts) VALUES('rebuild')`} {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// enableTrigram creates, or drops if on is false, the trigram index. The trigram
+// index is a second fts table over the text that matches substrings of words.
+func enableTrigram(on bool) error {
+	if trigramSearchStmt != nil {
+		trigramSearchStmt.Close()
+		trigramSearchStmt = nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(dropTrigramSQL); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if on {
+		if _, err := tx.Exec(createTrigramSQL); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return prepareTrigram()
 }
 
 // closeDatabase closes the db
@@ -66,38 +224,118 @@ func closeDatabase() {
 	}
 }
 
+// schemaSQL is the schema of version 1. Later changes are migrations, see migrate.go
 const schemaSQL = `-- pdfs
 CREATE TABLE IF NOT EXISTS pdfs(
-	id       INTEGER PRIMARY KEY,
-	path     TEXT,
-	pages    INT,
-	sig      TEXT,
-	text     TEXT,
-	cover    BLOB,
-	added_at TEXT
+	id        INTEGER PRIMARY KEY,
+	path      TEXT,
+	pages     INT,
+	sig       TEXT,
+	text      TEXT,
+	cover     BLOB,
+	added_at  TEXT,
+	title     TEXT,
+	title_raw TEXT,
+	abstract  TEXT,
+	keywords  TEXT,
+	isbn      TEXT,
+	simhash   INTEGER,
+	toc       TEXT
 );
 
 CREATE INDEX IF NOT EXISTS pdfs_sig ON pdfs(sig);
 
-CREATE VIRTUAL TABLE IF NOT EXISTS pdfs_fts USING fts5(text, content=pdfs, content_rowid=id);
+CREATE VIRTUAL TABLE IF NOT EXISTS pdfs_fts USING fts5(text, abstract, keywords, toc, content=pdfs, content_rowid=id);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS pdfs_vocab USING fts5vocab(pdfs_fts, 'row');
 
 CREATE TRIGGER IF NOT EXISTS pdfs_ai AFTER INSERT ON pdfs BEGIN
-	INSERT INTO pdfs_fts(text) VALUES (new.text);
+	INSERT INTO pdfs_fts(rowid, text, abstract, keywords, toc) VALUES (new.id, new.text, new.abstract, new.keywords, new.toc);
 END;
 
 CREATE TRIGGER IF NOT EXISTS pdfs_ad AFTER DELETE ON pdfs BEGIN
-	INSERT INTO pdfs_fts(pdfs_fts, rowid, text) VALUES('delete', old.id, old.text);
+	INSERT INTO pdfs_fts(pdfs_fts, rowid, text, abstract, keywords, toc) VALUES('delete', old.id, old.text, old.abstract, old.keywords, old.toc);
 END;`
 
 const (
-	insertSQL = `INSERT INTO pdfs(path, pages, sig, text, cover, added_at) VALUES(?, ?, ?, ?, ?, ?)`
+	insertSQL = `INSERT INTO pdfs(path, pages, sig, text, cover_hash, added_at, title, title_raw, abstract, keywords, isbn, simhash, toc, cover_path, origin, authors, annex_key) ` +
+		`VALUES(?, ?, ?, deflate(?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	coverSQL = `SELECT IFNULL(covers.data, pdfs.cover), IFNULL(pdfs.cover_path, '') FROM pdfs LEFT JOIN covers ON covers.hash = pdfs.cover_hash WHERE pdfs.id = ?`
+
+	// searchSQL is formatted with the rankWeights of the columns
+	searchSQL = `SELECT '', pdfs.id, pdfs.path, pdfs.pages, IFNULL(pdfs.title, ''), bm25(pdfs_fts, %[1]s), snippet(pdfs_fts, -1, '{{{', '}}}', '...', :tokens), ` +
+		`CASE WHEN :highlight THEN highlight(pdfs_fts, 0, '{{{', '}}}') ELSE '' END ` +
+		`FROM pdfs_fts, pdfs WHERE pdfs_fts MATCH :query AND pdfs_fts.rowid = pdfs.id AND ` + liveSQL + ` AND ` + filterSQL +
+		` ORDER BY bm25(pdfs_fts, %[1]s) LIMIT :limit OFFSET :offset`
+
+	// searchCountSQL counts the pdfs matching the query of searchSQL, for the pages of results
+	searchCountSQL = `SELECT COUNT(*) FROM pdfs_fts, pdfs WHERE pdfs_fts MATCH :query AND pdfs_fts.rowid = pdfs.id AND ` + liveSQL + ` AND ` + filterSQL
+
+	// listSQL lists the pdfs matching the fts query :match too, if not empty
+	listSQL = `SELECT pdfs.id, pdfs.path, pdfs.pages, IFNULL(pdfs.keywords, ''), IFNULL(pdfs.title, ''), IFNULL(pdfs.isbn, '') ` +
+		`FROM pdfs WHERE path LIKE :expr AND ` + liveSQL + ` AND ` + filterSQL +
+		` AND (:match = '' OR pdfs.id IN (SELECT rowid FROM pdfs_fts WHERE pdfs_fts MATCH :match))`
+
+	// liveSQL selects the pdfs that are not in the trash
+	liveSQL = `pdfs.deleted_at IS NULL`
 
-	coverSQL = `SELECT cover FROM pdfs WHERE id = ?`
+	// addedInSQL selects the pdfs added in a dateRange, see dateRange.args
+	addedInSQL = `(:since = '' OR pdfs.added_at >= :since) AND (:until = '' OR pdfs.added_at < :until)`
 
-	searchSQL = `SELECT pdfs.id, pdfs.path, pdfs.pages, snippet(pdfs_fts, 0, '{{{', '}}}', '...', 16) ` +
-		`FROM pdfs_fts, pdfs WHERE pdfs_fts MATCH ? AND pdfs_fts.rowid = pdfs.id ORDER BY rank LIMIT ?`
+	// filterSQL selects the pdfs of a filter, see filter.args
+	filterSQL = addedInSQL + ` AND (:minPages = 0 OR pdfs.pages >= :minPages) AND (:maxPages = 0 OR pdfs.pages <= :maxPages) ` +
+		`AND (:path = '' OR pdfs.path LIKE :path) AND (:notPath = '' OR pdfs.path NOT LIKE :notPath) AND (:origin = '' OR IFNULL(pdfs.origin, '') LIKE :origin) ` +
+		`AND (:tag = '' OR instr(' ' || IFNULL(pdfs.keywords, '') || ' ', ' ' || :tag || ' ') > 0) ` +
+		`AND (:notTag = '' OR instr(' ' || IFNULL(pdfs.keywords, '') || ' ', ' ' || :notTag || ' ') = 0) AND pdfs.id != :except`
 
-	listSQL = `SELECT pdfs.id, pdfs.path, pdfs.pages FROM pdfs WHERE path LIKE ?`
+	existsSQL = `SELECT COUNT(*), COUNT(deleted_at) FROM pdfs WHERE sig = ?`
 
-	existsSQL = `SELECT EXISTS (SELECT sig FROM pdfs WHERE sig = ?)`
+	trashedSigSQL = `SELECT id FROM pdfs WHERE sig = ? AND deleted_at IS NOT NULL LIMIT 1`
+
+	infoSQL = `SELECT id, path, pages, sig, added_at, IFNULL(title, ''), IFNULL(title_raw, ''), IFNULL(abstract, ''), IFNULL(keywords, ''), ` +
+		`IFNULL(isbn, ''), IFNULL(toc, ''), IFNULL(deleted_at, ''), EXISTS(SELECT 1 FROM originals WHERE pdf_id = pdfs.id), IFNULL(origin, ''), IFNULL(authors, ''), IFNULL(annex_key, '') FROM pdfs WHERE id = ?`
+
+	countSQL = `SELECT COUNT(*) FROM pdfs`
+
+	dfSQL = `SELECT COUNT(*) FROM pdfs_fts WHERE pdfs_fts MATCH ?`
+
+	termsSQL = `SELECT IFNULL(keywords, ''), inflate(text) FROM pdfs WHERE id = ?`
+
+	similarSQL = `SELECT pdfs.id, pdfs.path, pdfs.pages FROM pdfs_fts, pdfs ` +
+		`WHERE pdfs_fts MATCH ? AND pdfs_fts.rowid = pdfs.id AND pdfs.id != ? AND ` + liveSQL + ` ORDER BY bm25(pdfs_fts, ` + defaultRank + `) LIMIT ?`
+
+	topicsSQL = `SELECT id, path, IFNULL(keywords, '') FROM pdfs WHERE ` + liveSQL + ` ORDER BY id`
+
+	dupesSQL = `SELECT id, path, pages, simhash FROM pdfs WHERE simhash IS NOT NULL AND ` + liveSQL + ` ORDER BY id`
+
+	trigramExistsSQL = `SELECT COUNT(*) FROM sqlite_master WHERE name = 'pdfs_trigram'`
+
+	ftsDefinitionSQL = `SELECT sql FROM sqlite_master WHERE name = 'pdfs_fts'`
+
+	// ftsTableSQL is the definition of the full text index, see retokenize
+	ftsTableSQL = `CREATE VIRTUAL TABLE pdfs_fts USING fts5(text, abstract, keywords, toc, title, path, content=pdfs_text, content_rowid=id, tokenize=%s)`
+
+	trigramSearchSQL = `SELECT '', pdfs.id, pdfs.path, pdfs.pages, IFNULL(pdfs.title, ''), rank, snippet(pdfs_trigram, 0, '{{{', '}}}', '...', min(:tokens * 4, 64)), ` +
+		`CASE WHEN :highlight THEN highlight(pdfs_trigram, 0, '{{{', '}}}') ELSE '' END ` +
+		`FROM pdfs_trigram, pdfs WHERE pdfs_trigram MATCH :query AND pdfs_trigram.rowid = pdfs.id AND ` + liveSQL + ` AND ` + filterSQL +
+		` ORDER BY rank LIMIT :limit OFFSET :offset`
+
+	trigramCountSQL = `SELECT COUNT(*) FROM pdfs_trigram, pdfs WHERE pdfs_trigram MATCH :query AND pdfs_trigram.rowid = pdfs.id AND ` + liveSQL + ` AND ` + filterSQL
 )
+
+const createTrigramSQL = `CREATE VIRTUAL TABLE pdfs_trigram USING fts5(text, content=pdfs_text, content_rowid=id, tokenize='trigram');
+
+CREATE TRIGGER pdfs_trigram_ai AFTER INSERT ON pdfs BEGIN
+	INSERT INTO pdfs_trigram(rowid, text) VALUES (new.id, inflate(new.text));
+END;
+
+CREATE TRIGGER pdfs_trigram_ad AFTER DELETE ON pdfs BEGIN
+	INSERT INTO pdfs_trigram(pdfs_trigram, rowid, text) VALUES('delete', old.id, inflate(old.text));
+END;
+
+INSERT INTO pdfs_trigram(pdfs_trigram) VALUES('rebuild');`
+
+const dropTrigramSQL = `DROP TRIGGER IF EXISTS pdfs_trigram_ai;
+DROP TRIGGER IF EXISTS pdfs_trigram_ad;
+DROP TABLE IF EXISTS pdfs_trigram;`
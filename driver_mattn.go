@@ -0,0 +1,104 @@
+//go:build fts5 && !modernc
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// driverName is the sqlite3 driver with the sql functions of booklice registered
+	driverName = "sqlite3_booklice"
+
+	// mainDriverName is the driver for the db. It also attaches the libraries.
+	mainDriverName = "sqlite3_booklice_main"
+)
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: registerFunctions,
+	})
+	sql.Register(mainDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := registerFunctions(conn); err != nil {
+				return err
+			}
+			for _, lib := range libraries {
+				if _, err := conn.Exec("ATTACH DATABASE "+sqlQuote(lib.path)+" AS "+lib.schema, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// registerFunctions registers the sql functions of booklice to conn
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	// deflate is not pure, seal draws a random nonce
+	if err := conn.RegisterFunc("deflate", deflate, false); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("inflate", inflate, true)
+}
+
+// databaseDSN returns the data source name for the database at path
+func databaseDSN(path string) string {
+	if readOnly {
+		return fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d", path, busyTimeout)
+	}
+	return fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d", path, busyTimeout)
+}
+
+// backupTo copies the db to the new database at path
+func backupTo(path string) error {
+	dst, err := sql.Open(driverName, "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	return copyDatabase(dst, db)
+}
+
+// restoreFrom copies the database at path to the db
+func restoreFrom(path string) error {
+	src, err := sql.Open(driverName, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return copyDatabase(db, src)
+}
+
+// copyDatabase copies with the sqlite3 backup api the database src to dst
+func copyDatabase(dst, src *sql.DB) error {
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			b, err := dstDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
@@ -0,0 +1,92 @@
+//go:build fts5 && modernc
+
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+// modernc.org/sqlite registers a single driver, its functions and hooks apply to all
+// the connections. The hook attaches the libraries to the connections of the db only.
+const (
+	driverName     = "sqlite"
+	mainDriverName = "sqlite"
+)
+
+func init() {
+	// deflate is not deterministic, seal draws a random nonce
+	sqlite.MustRegisterScalarFunction("deflate", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return deflate(args[0])
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("inflate", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return inflate(args[0])
+	})
+	sqlite.RegisterConnectionHook(func(conn sqlite.ExecQuerierContext, dsn string) error {
+		if databasePath == "" || dsn != databaseDSN(databasePath) {
+			return nil
+		}
+		for _, lib := range libraries {
+			if _, err := conn.ExecContext(context.Background(), "ATTACH DATABASE "+sqlQuote(lib.path)+" AS "+lib.schema, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// databaseDSN returns the data source name for the database at path
+func databaseDSN(path string) string {
+	if readOnly {
+		return fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(%d)", path, busyTimeout)
+	}
+	return fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(%d)", path, busyTimeout)
+}
+
+// backuper is implemented by the connections of modernc.org/sqlite
+type backuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// backupTo copies with the sqlite3 backup api the db to the new database at path
+func backupTo(path string) error {
+	return rawBackup(func(c backuper) (*sqlite.Backup, error) {
+		return c.NewBackup("file:" + path)
+	})
+}
+
+// restoreFrom copies with the sqlite3 backup api the database at path to the db
+func restoreFrom(path string) error {
+	return rawBackup(func(c backuper) (*sqlite.Backup, error) {
+		return c.NewRestore("file:" + path + "?mode=ro")
+	})
+}
+
+// rawBackup runs to completion the backup started by start on a connection of the db
+func rawBackup(start func(c backuper) (*sqlite.Backup, error)) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(backuper)
+		if !ok {
+			return fmt.Errorf("driver connection %T does not support backups", driverConn)
+		}
+		b, err := start(c)
+		if err != nil {
+			return err
+		}
+		if _, err := b.Step(-1); err != nil {
+			b.Finish()
+			return err
+		}
+		return b.Finish()
+	})
+}
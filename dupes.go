@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/bits"
+)
+
+// simhash returns a 64 bit fingerprint of text. Texts that share most of their terms
+// have fingerprints that differ in a few bits, like two scans of the same book.
+// Texts without terms, like scans without ocr, have no fingerprint.
+func simhash(text string) (int64, bool) {
+	tf := termFrequencies(text)
+	if len(tf) == 0 {
+		return 0, false
+	}
+	var v [64]int
+	for t, n := range tf {
+		h := fnv.New64a()
+		h.Write([]byte(t))
+		x := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if x&(1<<uint(i)) != 0 {
+				v[i] += n
+			} else {
+				v[i] -= n
+			}
+		}
+	}
+
+	var fp uint64
+	for i := 0; i < 64; i++ {
+		if v[i] > 0 {
+			fp |= 1 << uint(i)
+		}
+	}
+	return int64(fp), true
+}
+
+// dupes writes to w groups of pdfs with the same text fingerprint. If maxDistance is
+// positive, fingerprints that differ in at most maxDistance bits are also grouped.
+func dupes(maxDistance int, w io.Writer) error {
+	rows, err := dupesStmt.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var entries []listEntry
+	var fps []uint64
+	for rows.Next() {
+		var (
+			e  listEntry
+			fp int64
+		)
+		if err := rows.Scan(&e.id, &e.name, &e.pages, &fp); err != nil {
+			return fmt.Errorf("dupes failed, can't scan row: %w", err)
+		}
+		entries = append(entries, e)
+		fps = append(fps, uint64(fp))
+	}
+	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("dupes failed, can't fetch rows: %w", err)
+	}
+
+	grouped := make([]bool, len(entries))
+	for i := range entries {
+		if grouped[i] {
+			continue
+		}
+		group := []int{i}
+		for j := i + 1; j < len(entries); j++ {
+			if !grouped[j] && bits.OnesCount64(fps[i]^fps[j]) <= maxDistance {
+				group = append(group, j)
+				grouped[j] = true
+			}
+		}
+		if len(group) == 1 {
+			continue
+		}
+		for _, j := range group {
+			fmt.Fprintf(w, "[%d] %s (#%d) distance %d\n", entries[j].id, entries[j].name, entries[j].pages, bits.OnesCount64(fps[i]^fps[j]))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
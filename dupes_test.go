@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+func TestSimhashNoTerms(t *testing.T) {
+	for _, text := range []string{"", "   ", "\f\f", "12 34 -- a of"} {
+		if fp, ok := simhash(text); ok {
+			t.Errorf("simhash(%q) = %x, want no fingerprint", text, fp)
+		}
+	}
+}
+
+func TestSimhashDistance(t *testing.T) {
+	book := strings.Repeat("btrees store sorted keys in pages and split full pages when inserting keys ", 20) +
+		"logging recovery transactions isolation locking buffers"
+	scan := strings.Replace(book, "logging", "loggmg", 1)
+	other := "kittens purring softly beside warm fireplaces during winter evenings"
+
+	fpBook, _ := simhash(book)
+	fpScan, _ := simhash(scan)
+	fpOther, _ := simhash(other)
+	if d := bits.OnesCount64(uint64(fpBook ^ fpScan)); d > 6 {
+		t.Errorf("distance of near duplicates is %d", d)
+	}
+	if d := bits.OnesCount64(uint64(fpBook ^ fpOther)); d < 10 {
+		t.Errorf("distance of unrelated texts is %d", d)
+	}
+}
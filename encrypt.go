@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// sealedMagic starts every blob encrypted by seal
+var sealedMagic = []byte("BLX1")
+
+// blobCipher, if set, encrypts the text and the covers of the pdfs
+var blobCipher cipher.AEAD
+
+// loadKey sets up blobCipher with the key in the file at path. The key is the
+// sha256 of the contents of the file, so any file with enough random bytes will do.
+func loadKey(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read key: %w", err)
+	}
+	if len(data) < 16 {
+		return errors.New("key file is too short, use at least 16 random bytes")
+	}
+	key := sha256.Sum256(data)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	blobCipher = aead
+	return nil
+}
+
+// seal encrypts data if a key is loaded. Otherwise data is returned unchanged.
+func seal(data []byte) ([]byte, error) {
+	if blobCipher == nil || data == nil || isSealed(data) {
+		return data, nil
+	}
+	nonce := make([]byte, blobCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, sealedMagic...), nonce...)
+	return blobCipher.Seal(out, nonce, data, sealedMagic), nil
+}
+
+// unseal decrypts data encrypted by seal. Data that is not encrypted is returned unchanged.
+func unseal(data []byte) ([]byte, error) {
+	if !isSealed(data) {
+		return data, nil
+	}
+	if blobCipher == nil {
+		return nil, errors.New("the database is encrypted, use -k to give the key")
+	}
+	data = data[len(sealedMagic):]
+	n := blobCipher.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("encrypted data is truncated")
+	}
+	plain, err := blobCipher.Open(nil, data[:n], data[n:], sealedMagic)
+	if err != nil {
+		return nil, errors.New("can't decrypt data, wrong key?")
+	}
+	return plain, nil
+}
+
+// isSealed reports whether data was encrypted by seal
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedMagic)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withKey loads a key from a temporary file and unloads it when the test ends
+func withKey(t *testing.T, key string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(key), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadKey(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { blobCipher = nil })
+}
+
+func TestSealUnseal(t *testing.T) {
+	withKey(t, "0123456789abcdef0123456789abcdef")
+
+	for _, data := range [][]byte{{}, []byte("cover"), bytes.Repeat([]byte{0xff, 0xd8}, 1000)} {
+		sealed, err := seal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isSealed(sealed) {
+			t.Errorf("seal(%.10q) is not sealed", data)
+		}
+		if again, _ := seal(sealed); !bytes.Equal(again, sealed) {
+			t.Errorf("seal(%.10q) sealed twice", data)
+		}
+		got, err := unseal(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("unseal(seal(%.10q)) = %.10q", data, got)
+		}
+	}
+}
+
+func TestSealNonce(t *testing.T) {
+	withKey(t, "0123456789abcdef0123456789abcdef")
+
+	a, _ := seal([]byte("text"))
+	b, _ := seal([]byte("text"))
+	if bytes.Equal(a, b) {
+		t.Errorf("seal is deterministic, the nonce is reused")
+	}
+}
+
+func TestUnsealErrors(t *testing.T) {
+	withKey(t, "0123456789abcdef0123456789abcdef")
+	sealed, err := seal([]byte("text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := unseal(sealed[:len(sealedMagic)+4]); err == nil {
+		t.Errorf("unseal of truncated data succeeded")
+	}
+
+	withKey(t, "another key, long enough for it")
+	if _, err := unseal(sealed); err == nil {
+		t.Errorf("unseal with the wrong key succeeded")
+	}
+
+	blobCipher = nil
+	if _, err := unseal(sealed); err == nil {
+		t.Errorf("unseal without a key succeeded")
+	}
+	if got, err := unseal([]byte("plain")); err != nil || string(got) != "plain" {
+		t.Errorf("unseal(plain) = %q, %v", got, err)
+	}
+}
+
+func TestDeflateInflateSealed(t *testing.T) {
+	withKey(t, "0123456789abcdef0123456789abcdef")
+
+	stored, err := deflate("secret text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(stored.([]byte)) {
+		t.Fatalf("deflate with a key stored %q, want sealed", stored)
+	}
+	got, err := inflate(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "secret text" {
+		t.Errorf("inflate(deflate(secret text)) = %v", got)
+	}
+}
+
+func TestLoadKeyShort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadKey(path); err == nil {
+		blobCipher = nil
+		t.Errorf("loadKey accepted a short key")
+	}
+}
@@ -0,0 +1,132 @@
+//go:build fts5
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// encryptDatabase encrypts, with the loaded key, the text, the covers and the stored files
+// of the pdfs added before the key was used and writes to w how many were encrypted. Covers
+// stored as files are encrypted in place after the db is updated, so the command can be run
+// again if it fails.
+func encryptDatabase(w io.Writer) error {
+	if blobCipher == nil {
+		return errors.New("no key, use -k")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(encryptTextSQL)
+	if err != nil {
+		return err
+	}
+	texts, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(encryptOriginalsSQL); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(allCoversSQL)
+	if err != nil {
+		return err
+	}
+	type cover struct {
+		hash string
+		data []byte
+		path string
+	}
+	var covers []cover
+	for rows.Next() {
+		var c cover
+		if err := rows.Scan(&c.hash, &c.data, &c.path); err != nil {
+			rows.Close()
+			return err
+		}
+		covers = append(covers, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var (
+		files  []string
+		sealed int
+	)
+	for _, c := range covers {
+		if c.path != "" {
+			files = append(files, c.path)
+			continue
+		}
+		if isSealed(c.data) {
+			continue
+		}
+		data, err := seal(c.data)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(updateCoverSQL, data, c.hash); err != nil {
+			return err
+		}
+		sealed++
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		ok, err := sealFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt cover %s: %w", path, err)
+		}
+		if ok {
+			sealed++
+		}
+	}
+	fmt.Fprintf(w, "encrypted the texts of %d pdfs and %d covers\n", texts, sealed)
+	return nil
+}
+
+// sealFile encrypts the file at path and reports whether it did. Missing files and files
+// already encrypted are left alone. The file is replaced by renaming, so that it is never
+// left half written.
+func sealFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if isSealed(data) {
+		return false, nil
+	}
+	if data, err = seal(data); err != nil {
+		return false, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
+
+const (
+	// encryptTextSQL encrypts the texts not encrypted. The text in the index does not change.
+	encryptTextSQL = `UPDATE pdfs SET text = deflate(inflate(text)) WHERE text IS NOT NULL AND substr(text, 1, 4) != CAST('BLX1' AS BLOB)`
+
+	encryptOriginalsSQL = `UPDATE originals SET data = deflate(inflate(data)) WHERE substr(data, 1, 4) != CAST('BLX1' AS BLOB)`
+
+	allCoversSQL = `SELECT hash, data, '' FROM covers UNION ALL SELECT DISTINCT '', NULL, cover_path FROM pdfs WHERE IFNULL(cover_path, '') != ''`
+
+	updateCoverSQL = `UPDATE covers SET data = ? WHERE hash = ?`
+)
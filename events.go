@@ -0,0 +1,71 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// execer is either the db or a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// hostname identifies in the events the machine that changed the db
+var hostname = func() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}()
+
+// recordEvent records in the events table that op was applied to the pdf with id
+func recordEvent(ex execer, op string, id int) error {
+	_, err := ex.Exec(recordEventSQL, formatTimestamp(time.Now()), hostname, op, id)
+	return err
+}
+
+// history writes to w the latest n events since a date, oldest first
+func history(n int, since string, w io.Writer) error {
+	rows, err := db.Query(historySQL, since, n)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id           int
+			at, host, op string
+			path         string
+		)
+		if err := rows.Scan(&at, &host, &op, &id, &path); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s %s %-7s [%d] %s\n", at, host, op, id, path)
+	}
+	return rows.Err()
+}
+
+const (
+	eventsSQL = `CREATE TABLE IF NOT EXISTS events(
+	id     INTEGER PRIMARY KEY,
+	at     TEXT NOT NULL,
+	host   TEXT NOT NULL,
+	op     TEXT NOT NULL,
+	pdf_id INTEGER NOT NULL,
+	path   TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS events_at ON events(at);`
+
+	// the path is copied, so that the events of deleted pdfs are readable
+	recordEventSQL = `INSERT INTO events(at, host, op, pdf_id, path) SELECT ?, ?, ?, id, path FROM pdfs WHERE id = ?`
+
+	historySQL = `SELECT at, host, op, pdf_id, path FROM (SELECT * FROM events WHERE at >= ? ORDER BY id DESC LIMIT ?) ORDER BY id`
+)
@@ -0,0 +1,39 @@
+//go:build fts5
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// explanation is what search -explain shows about a search
+type explanation struct {
+	sql     string        // the statement that searched
+	query   string        // the fts query or the regexp, as matched
+	rank    string        // the bm25 weights of rankColumns, empty if not ranked by bm25
+	count   int           // the pdfs found before the limit, negative if not counted
+	elapsed time.Duration // the time to search and write the results
+}
+
+// write writes e and the ranks of results to w
+func (e explanation) write(w io.Writer, results []searchResult) {
+	fmt.Fprintf(w, "sql: %s\n", e.sql)
+	fmt.Fprintf(w, "query: %s\n", e.query)
+	if e.rank != "" {
+		weights := strings.Split(e.rank, ", ")
+		for i := range weights {
+			weights[i] = rankColumns[i] + "=" + weights[i]
+		}
+		fmt.Fprintf(w, "rank: bm25 %s\n", strings.Join(weights, ","))
+	}
+	if e.count >= 0 {
+		fmt.Fprintf(w, "found: %d\n", e.count)
+	}
+	fmt.Fprintf(w, "elapsed: %s\n", e.elapsed.Round(time.Microsecond))
+	for _, r := range results {
+		fmt.Fprintf(w, "%10.4f [%s] %s\n", r.Rank, r.ref(), r.Path)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build fts5
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleFeed writes the Atom feed of the pdfs added last, with their covers
+func (s *server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.QueryContext(r.Context(), recentSQL, s.feedSize, 0)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	feed := atomFeed{
+		ID:     s.announce + "/feed.xml",
+		Title:  progName,
+		Author: atomPerson{Name: progName},
+		Links: []atomLink{
+			{Rel: "self", Href: s.announce + "/feed.xml", Type: "application/atom+xml"},
+			{Rel: "alternate", Href: s.announce + "/", Type: "text/html"},
+		},
+	}
+	for rows.Next() {
+		var (
+			res      searchResult
+			added    string
+			abstract string
+		)
+		if err := rows.Scan(&res.ID, &res.Path, &res.Pages, &res.Title, &added, &abstract); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if feed.Updated == "" {
+			feed.Updated = added
+		}
+		feed.Entries = append(feed.Entries, s.feedEntry(res, added, abstract))
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if feed.Updated == "" {
+		feed.Updated = formatTimestamp(time.Now())
+	}
+	writeFeed(w, feed, "application/atom+xml")
+}
+
+// feedEntry returns the entry of the pdf r, added at added, with its cover and abstract
+func (s *server) feedEntry(r searchResult, added, abstract string) atomEntry {
+	page := s.announce + "/pdf/" + strconv.Itoa(r.ID)
+	content := fmt.Sprintf(`<p><a href="%s"><img src="%s/cover/%d" alt=""></a></p><p>%d pages</p>`, html.EscapeString(page), html.EscapeString(s.announce), r.ID, r.Pages)
+	if abstract != "" {
+		content += "<p>" + html.EscapeString(abstract) + "</p>"
+	}
+	return atomEntry{
+		ID:      page,
+		Title:   resultView{searchResult: r}.Name(),
+		Updated: added,
+		Links: []atomLink{
+			{Rel: "alternate", Href: page, Type: "text/html"},
+			{Rel: "enclosure", Href: s.absURL(s.link(r)), Type: "application/pdf"},
+		},
+		Content: &atomText{Type: "html", Text: content},
+	}
+}
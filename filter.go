@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filter selects the pdfs shown by search and list, see filterSQL
+type filter struct {
+	added    dateRange
+	minPages int    // 0 is unbounded
+	maxPages int    // 0 is unbounded
+	path     string // sql like expression, empty matches all
+	notPath  string // sql like expression of the paths to skip, empty skips none
+	origin   string // sql like expression, empty matches all
+	tag      string // a keyword the pdfs have, empty matches all
+	notTag   string // a keyword of the pdfs to skip, empty skips none
+	except   int    // the id of a pdf to skip, 0 skips none
+}
+
+// newFilter returns the filter for the values of the flags of search and list
+func newFilter(since, until, pages, path, notPath, origin, tag, notTag string) (filter, error) {
+	added, err := newDateRange(since, until)
+	if err != nil {
+		return filter{}, err
+	}
+	minPages, maxPages, err := parsePageRange(pages)
+	if err != nil {
+		return filter{}, err
+	}
+	return filter{added: added, minPages: minPages, maxPages: maxPages, path: path, notPath: notPath, origin: origin, tag: strings.ToLower(strings.TrimSpace(tag)),
+		notTag: strings.ToLower(strings.TrimSpace(notTag))}, nil
+}
+
+// args returns the arguments for the parameters of filterSQL
+func (f filter) args() []interface{} {
+	return append(f.added.args(),
+		sql.Named("minPages", f.minPages), sql.Named("maxPages", f.maxPages),
+		sql.Named("path", f.path), sql.Named("notPath", f.notPath), sql.Named("origin", f.origin),
+		sql.Named("tag", f.tag), sql.Named("notTag", f.notTag), sql.Named("except", f.except))
+}
+
+// parsePageRange parses a range of page counts like 100..300, 100.., ..300 or 100.
+// Missing bounds are 0.
+func parsePageRange(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "..")
+	if !isRange {
+		hi = lo
+	}
+	var bounds [2]int
+	for i, b := range []string{lo, hi} {
+		if b == "" {
+			continue
+		}
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("bad page range %q, use 100..300, 100.. or ..300", s)
+		}
+		bounds[i] = n
+	}
+	if bounds[0] == 0 && bounds[1] == 0 || bounds[1] != 0 && bounds[0] > bounds[1] {
+		return 0, 0, fmt.Errorf("bad page range %q, use 100..300, 100.. or ..300", s)
+	}
+	return bounds[0], bounds[1], nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParsePageRange(t *testing.T) {
+	tests := []struct {
+		in       string
+		min, max int
+	}{
+		{"", 0, 0},
+		{"100..300", 100, 300},
+		{"100..", 100, 0},
+		{"..300", 0, 300},
+		{"42", 42, 42},
+		{"7..7", 7, 7},
+	}
+	for _, tt := range tests {
+		min, max, err := parsePageRange(tt.in)
+		if err != nil {
+			t.Errorf("parsePageRange(%q): %v", tt.in, err)
+		} else if min != tt.min || max != tt.max {
+			t.Errorf("parsePageRange(%q) = %d, %d, want %d, %d", tt.in, min, max, tt.min, tt.max)
+		}
+	}
+
+	for _, bad := range []string{"..", "300..100", "0..10", "-5", "ten", "1...3", "1..2..3"} {
+		if _, _, err := parsePageRange(bad); err == nil {
+			t.Errorf("parsePageRange(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// parseRefOrPath returns the id of the pdf with ref, that is an id, label:id or the path
+// of a pdf in the index
+func parseRefOrPath(ref string) (int, error) {
+	id, err := parseRef(ref)
+	if !errors.Is(err, flag.ErrHelp) {
+		return id, err
+	}
+	path, err := filepath.Abs(ref)
+	if err != nil {
+		return 0, err
+	}
+	err = db.QueryRow(pathIDSQL, path).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no pdf with path %s", path)
+	}
+	return id, err
+}
+
+// grepPDF writes to w the lines of the stored text of the pdf with id that match re, each
+// labelled with its page. The matches start with the ANSI escape highlight, if not empty.
+func grepPDF(id int, re *regexp.Regexp, highlight string, w io.Writer) error {
+	pages, err := pageTexts(id)
+	if err != nil {
+		return err
+	}
+	for i, page := range pages {
+		for _, line := range strings.Split(page, "\n") {
+			if !re.MatchString(line) {
+				continue
+			}
+			if highlight != "" {
+				line = re.ReplaceAllString(line, highlight+"$0\033[0m")
+			}
+			if _, err := fmt.Fprintf(w, "p. %d: %s\n", i+1, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pageTexts returns the stored text of the pages of the pdf with id
+func pageTexts(id int) ([]string, error) {
+	var kws, text string
+	err := termsStmt.QueryRow(id).Scan(&kws, &text)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("pdf with id %d not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(text, pageSeparator), nil
+}
+
+// grepPattern returns the regexp that matches s literally
+func grepPattern(s string, ignoreCase bool) *regexp.Regexp {
+	s = regexp.QuoteMeta(s)
+	if ignoreCase {
+		s = "(?i)" + s
+	}
+	return regexp.MustCompile(s)
+}
+
+const pathIDSQL = `SELECT id FROM pdfs WHERE path = ? AND ` + liveSQL + ` ORDER BY id LIMIT 1`
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithGzip(t *testing.T) {
+	const body = "<p>hello hello hello</p>"
+	tests := []struct {
+		accept, contentType string
+		gzipped             bool
+	}{
+		{"gzip, deflate", "text/html; charset=utf-8", true},
+		{"gzip", "application/json", true},
+		{"gzip", "", true}, // sniffed as html
+		{"deflate", "text/html", false},
+		{"gzip;q=0", "text/html", false},
+		{"gzip", "image/jpeg", false},
+		{"gzip", "application/pdf", false},
+		{"gzip", "text/event-stream", false},
+	}
+	for _, tt := range tests {
+		h := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.contentType != "" {
+				w.Header().Set("Content-Type", tt.contentType)
+			}
+			io.WriteString(w, body)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+		if gzipped != tt.gzipped {
+			t.Errorf("%q, %q: gzipped %v, want %v", tt.accept, tt.contentType, gzipped, tt.gzipped)
+			continue
+		}
+		var r io.Reader = rec.Body
+		if gzipped {
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Errorf("%q, %q: %v", tt.accept, tt.contentType, err)
+				continue
+			}
+			r = zr
+		}
+		if got, err := io.ReadAll(r); err != nil || string(got) != body {
+			t.Errorf("%q, %q: body %q, %v, want %q", tt.accept, tt.contentType, got, err, body)
+		}
+	}
+}
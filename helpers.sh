@@ -8,7 +8,7 @@ function text {
 }
 
 function cover {
-    gs -dNOPAUSE -dBATCH -dSAFER -dQUIET -sDEVICE=pdfwrite -sOutputFile=- -dFirstPage=1 -dLastPage=1 "$1"
+    gs -dNOPAUSE -dBATCH -dSAFER -dQUIET -sDEVICE=jpeg -dJPEGQ=75 -g300x400 -dFIXEDMEDIA -dPDFFitPage -sOutputFile=- -dFirstPage=1 -dLastPage=1 "$1"
 }
 
 function pages {
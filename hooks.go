@@ -0,0 +1,92 @@
+//go:build fts5
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// hookTimeout is the longest a hook may run
+const hookTimeout = time.Minute
+
+// hookPDF is the pdf given to hooks as json on stdin
+type hookPDF struct {
+	Event    string `json:"event"` // on-add or on-remove
+	Database string `json:"database"`
+	ID       int    `json:"id"`
+	Path     string `json:"path"`
+	Title    string `json:"title"`
+	Authors  string `json:"authors,omitempty"`
+	Pages    int    `json:"pages"`
+	Keywords string `json:"keywords"`
+	ISBN     string `json:"isbn,omitempty"`
+	Origin   string `json:"origin,omitempty"`
+	Sig      string `json:"sig"`
+	AddedAt  string `json:"added_at"`
+}
+
+// hookPath returns the path of the hook named event, an executable in the hooks dir of
+// the config dir of the user, or "" if there is none
+func hookPath(event string) string {
+	cfgPath, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(cfgPath, progName, "hooks", event)
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() || fi.Mode()&0111 == 0 {
+		return ""
+	}
+	return path
+}
+
+// runHook runs the hook named event, if the user has one, with the pdf with id as json on
+// stdin. Hooks run after the change is committed, so a failed hook is only logged.
+func runHook(event string, id int) {
+	path := hookPath(event)
+	if path == "" {
+		return
+	}
+	if err := execHook(path, event, id); err != nil {
+		log.Printf("hook %s failed for pdf %d: %v", path, id, err)
+	}
+}
+
+// execHook runs the hook at path for event with the pdf with id
+func execHook(path, event string, id int) error {
+	p := hookPDF{Event: event, ID: id}
+	err := db.QueryRow(hookSQL, id).Scan(&p.Path, &p.Title, &p.Authors, &p.Pages, &p.Keywords, &p.ISBN, &p.Origin, &p.Sig, &p.AddedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("pdf not found")
+	}
+	if err != nil {
+		return err
+	}
+	if p.Database, err = filepath.Abs(databasePath); err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	// the stdout of booklice is kept for its own output
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+const hookSQL = `SELECT path, IFNULL(title, ''), IFNULL(authors, ''), pages, IFNULL(keywords, ''), IFNULL(isbn, ''), IFNULL(origin, ''), sig, added_at ` +
+	`FROM pdfs WHERE id = ?`
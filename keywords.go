@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxKeywords is the number of keywords stored for each pdf
+	maxKeywords = 10
+
+	// maxKeywordCandidates is the number of the most frequent terms of a pdf considered as keywords
+	maxKeywordCandidates = 200
+)
+
+// stopWords are frequent english words that are never keywords
+var stopWords = makeSet(`about above after again against all also among and any are because been before
+being below between both but can could did does doing down during each few for from further had has
+have having her here hers herself him himself his how however into its itself just may might more most
+much must nor not now off once only other our ours ourselves out over own same shall she should some
+such than that the their theirs them themselves then there these they this those through thus too under
+until upon very was were what when where which while who whom why will with within without would you
+your yours yourself yourselves`)
+
+func makeSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// terms splits text to lowercase terms, dropping stop words, numbers and very short words
+func terms(text string) []string {
+	var ts []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(w)) < 3 || stopWords[w] || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		ts = append(ts, w)
+	}
+	return ts
+}
+
+// termFrequencies counts the occurrences of each term of text
+func termFrequencies(text string) map[string]int {
+	tf := make(map[string]int)
+	for _, t := range terms(text) {
+		tf[t]++
+	}
+	return tf
+}
+
+type weightedTerm struct {
+	term   string
+	weight float64
+}
+
+// topTerms returns the n terms of tf with the highest TF-IDF weight. Document frequencies
+// are returned by df, for an index of docs documents.
+func topTerms(tf map[string]int, n int, docs int, df func(term string) (int, error)) ([]weightedTerm, error) {
+	candidates := make([]weightedTerm, 0, len(tf))
+	for t, c := range tf {
+		candidates = append(candidates, weightedTerm{t, float64(c)})
+	}
+	sortTerms(candidates)
+	if len(candidates) > maxKeywordCandidates {
+		candidates = candidates[:maxKeywordCandidates]
+	}
+
+	for i := range candidates {
+		f, err := df(candidates[i].term)
+		if err != nil {
+			return nil, err
+		}
+		idf := math.Log(float64(docs+1)/float64(f+1)) + 1
+		candidates[i].weight = (1 + math.Log(candidates[i].weight)) * idf
+	}
+	sortTerms(candidates)
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates, nil
+}
+
+// sortTerms sorts terms by decreasing weight, breaking ties alphabetically
+func sortTerms(ts []weightedTerm) {
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].weight != ts[j].weight {
+			return ts[i].weight > ts[j].weight
+		}
+		return ts[i].term < ts[j].term
+	})
+}
+
+// keywords returns the top TF-IDF terms of text, separated by spaces
+func keywords(text string) (string, error) {
+	var docs int
+	if err := countStmt.QueryRow().Scan(&docs); err != nil {
+		return "", err
+	}
+	top, err := topTerms(termFrequencies(text), maxKeywords, docs, documentFrequency)
+	if err != nil {
+		return "", err
+	}
+	kws := make([]string, len(top))
+	for i, t := range top {
+		kws[i] = t.term
+	}
+	return strings.Join(kws, " "), nil
+}
+
+// documentFrequency returns the number of documents of the index containing term. The
+// index is queried, instead of pdfs_vocab, so that term is tokenized like the documents
+// were, for example stemmed by porter or without diacritics.
+func documentFrequency(term string) (int, error) {
+	var n int
+	if err := dfStmt.QueryRow(ftsQuote(term)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// tagKeywords returns the words of tags, like the tags of a Calibre library, lowercased,
+// followed by the keywords kws that are not among them
+func tagKeywords(tags []string, kws string) string {
+	if len(tags) == 0 {
+		return kws
+	}
+	seen := make(map[string]bool)
+	var words []string
+	notWord := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }
+	for _, w := range append(strings.FieldsFunc(strings.ToLower(strings.Join(tags, " ")), notWord), strings.Fields(kws)...) {
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,101 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestDocumentFrequency(t *testing.T) {
+	openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	for i, text := range []string{"running dogs", "the dog runs", "a café in Paris"} {
+		if _, err := insertStmt.Exec(fmt.Sprintf("/doc%d.pdf", i), 1, fmt.Sprint(i), text, nil, "", "", "", "", "", "", nil, "", "", "add", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		tokenizer string
+		term      string
+		want      int
+	}{
+		{"", "dogs", 1},
+		{"", "dog", 1},
+		{"", "cafe", 1},
+		{"porter", "dogs", 2},
+		{"porter", "running", 2},
+		{"porter unicode61 remove_diacritics 2", "cafe", 1},
+		{"porter unicode61 remove_diacritics 2", "café", 1},
+		{"porter", "missing", 0},
+	}
+	for _, tt := range tests {
+		if err := retokenize(tt.tokenizer); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := documentFrequency(tt.term); err != nil {
+			t.Errorf("documentFrequency(%q) with %q: %v", tt.term, tt.tokenizer, err)
+		} else if got != tt.want {
+			t.Errorf("documentFrequency(%q) with %q = %d, want %d", tt.term, tt.tokenizer, got, tt.want)
+		}
+	}
+}
+
+func TestTagKeywords(t *testing.T) {
+	tests := []struct {
+		tags []string
+		kws  string
+		want string
+	}{
+		{nil, "btree page", "btree page"},
+		{[]string{"Databases"}, "btree page", "databases btree page"},
+		{[]string{"Computer Science", "databases"}, "btree databases", "computer science databases btree"},
+		{[]string{"Fiction"}, "", "fiction"},
+		{[]string{"Science, Theory", "C++"}, "lambda", "science theory c lambda"},
+	}
+	for _, tt := range tests {
+		if got := tagKeywords(tt.tags, tt.kws); got != tt.want {
+			t.Errorf("tagKeywords(%q, %q) = %q, want %q", tt.tags, tt.kws, got, tt.want)
+		}
+	}
+}
+
+func TestTagFilter(t *testing.T) {
+	openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	for i, kws := range []string{"go databases", "godot games", ""} {
+		if _, err := insertStmt.Exec(fmt.Sprintf("/doc%d.pdf", i), 1, fmt.Sprint(i), "a book", nil, "", "", "", "", kws, "", nil, "", "", "add", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		tag, notTag string
+		want        int
+	}{
+		{"", "", 3},
+		{"go", "", 1},
+		{" Games ", "", 1},
+		{"data", "", 0},
+		{"%", "", 0},
+		{"", "go", 2},
+		{"", "data", 3},
+		{"go", "databases", 0},
+	}
+	for _, tt := range tests {
+		f, err := newFilter("", "", "", "", "", "", tt.tag, tt.notTag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := searchCount(context.Background(), searchCountSQL, "book", f); err != nil {
+			t.Errorf("searchCount with tag %q and not tag %q: %v", tt.tag, tt.notTag, err)
+		} else if got != tt.want {
+			t.Errorf("searchCount with tag %q and not tag %q = %d, want %d", tt.tag, tt.notTag, got, tt.want)
+		}
+	}
+}
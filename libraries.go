@@ -0,0 +1,117 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// library is a database attached to the db, to be searched together with it
+type library struct {
+	schema string // the name of the attached database in sql
+	label  string // shown with the results from the library
+	path   string
+}
+
+// libraries are attached to every connection of the db
+var libraries []library
+
+// attachLibraries migrates the databases at paths to the current schema and arranges
+// for them to be attached to the db when it is opened. Unlike the db, the libraries
+// must exist, so that a mistyped name does not create an empty database.
+func attachLibraries(paths []string) {
+	for i, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			log.Fatalf("can't find library %s: %s", path, err)
+		}
+		d, err := sql.Open(driverName, databaseDSN(path))
+		if err != nil {
+			log.Fatalf("can't open library %s: %s", path, err)
+		}
+		if err := migrate(d); err != nil {
+			log.Fatalf("can't migrate schema of library %s: %s", path, err)
+		}
+		d.Close()
+
+		libraries = append(libraries, library{
+			schema: fmt.Sprintf("lib%d", i+1),
+			label:  libraryLabel(path),
+			path:   path,
+		})
+	}
+}
+
+// libraryLabel returns the name of the database file at path, without extension
+func libraryLabel(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// parseRef parses a pdf reference, as written by search, that is either an id or label:id.
+// If label is of a library, the db is reopened as the library, so that the pdf can be
+// queried as if the library was given alone with -n.
+func parseRef(ref string) (int, error) {
+	label, idStr, found := strings.Cut(ref, ":")
+	if !found {
+		label, idStr = "", ref
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, flag.ErrHelp
+	}
+	if label == "" || label == libraryLabel(databasePath) {
+		return id, nil
+	}
+	for _, lib := range libraries {
+		if lib.label == label {
+			closeDatabase()
+			libraries = nil
+			openDatabase(lib.path)
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no library %q, see -n", label)
+}
+
+// librariesSearchSQL returns a statement like searchSQL, ranked by the rankWeights, that
+// searches the db and all libraries and labels each result with its library
+func librariesSearchSQL(rank string) string {
+	parts := []string{fmt.Sprintf(librarySearchSQL, "main", sqlQuote(libraryLabel(databasePath)), rank)}
+	for _, lib := range libraries {
+		parts = append(parts, fmt.Sprintf(librarySearchSQL, lib.schema, sqlQuote(lib.label), rank))
+	}
+	return `SELECT library, id, path, pages, title, score, snippet, context FROM (` + strings.Join(parts, " UNION ALL ") + `) ORDER BY score LIMIT :limit OFFSET :offset`
+}
+
+// librariesCountSQL returns a statement like searchCountSQL that counts the pdfs found in
+// the db and all libraries
+func librariesCountSQL() string {
+	parts := []string{fmt.Sprintf(libraryCountSQL, "main")}
+	for _, lib := range libraries {
+		parts = append(parts, fmt.Sprintf(libraryCountSQL, lib.schema))
+	}
+	return `SELECT SUM(n) FROM (` + strings.Join(parts, " UNION ALL ") + `)`
+}
+
+// sqlQuote quotes s as an sql string
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// librarySearchSQL searches one library. The ranking must be the same as in searchSQL.
+const librarySearchSQL = `SELECT %[2]s AS library, pdfs.id AS id, pdfs.path AS path, pdfs.pages AS pages, ` +
+	`IFNULL(pdfs.title, '') AS title, bm25(pdfs_fts, %[3]s) AS score, snippet(pdfs_fts, -1, '{{{', '}}}', '...', :tokens) AS snippet, ` +
+	`CASE WHEN :highlight THEN highlight(pdfs_fts, 0, '{{{', '}}}') ELSE '' END AS context ` +
+	`FROM %[1]s.pdfs_fts, %[1]s.pdfs AS pdfs WHERE pdfs_fts MATCH :query AND pdfs_fts.rowid = pdfs.id AND ` +
+	liveSQL + ` AND ` + filterSQL
+
+// libraryCountSQL counts the pdfs found in one library
+const libraryCountSQL = `SELECT COUNT(*) AS n FROM %[1]s.pdfs_fts, %[1]s.pdfs AS pdfs WHERE pdfs_fts MATCH :query AND pdfs_fts.rowid = pdfs.id AND ` +
+	liveSQL + ` AND ` + filterSQL
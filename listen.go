@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is the first file descriptor passed by systemd socket activation
+const systemdFirstFD = 3
+
+// listen listens on addr, a tcp address like localhost:8080 or a unix socket like
+// unix:/run/booklice.sock. A stale socket file at the path is removed first. If the
+// process was started by systemd socket activation, the passed socket is used instead.
+func listen(addr string) (net.Listener, error) {
+	if socketActivated() {
+		return systemdListener()
+	}
+	if !strings.HasPrefix(addr, "unix:") {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, "unix:")
+	if path == "" {
+		return nil, errors.New("no path in -listen unix:")
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// removeStaleSocket removes the unix socket at path if no one listens on it
+func removeStaleSocket(path string) error {
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// socketActivated reports whether systemd passed sockets to the process, see sd_listen_fds(3)
+func socketActivated() bool {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return false
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	return err == nil && n > 0
+}
+
+// systemdListener returns the first socket passed by systemd. The environment of the
+// activation is cleared, so that children don't use it.
+func systemdListener() (net.Listener, error) {
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if n > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, booklice listens on one", n)
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	f := os.NewFile(systemdFirstFD, "systemd socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't listen on the socket of systemd: %w", err)
+	}
+	return ln, nil
+}
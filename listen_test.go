@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "booklice.sock")
+
+	// a socket left behind by a server that crashed
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("listen over a stale socket: %v", err)
+	}
+	defer ln.Close()
+	if _, err := listen("unix:" + path); err == nil {
+		t.Error("listen on a socket in use succeeded")
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("can't connect: %v", err)
+	}
+	c.Close()
+}
+
+func TestSocketActivated(t *testing.T) {
+	tests := []struct {
+		pid, fds string
+		want     bool
+	}{
+		{"", "", false},
+		{strconv.Itoa(os.Getpid()), "1", true},
+		{strconv.Itoa(os.Getpid()), "0", false},
+		{strconv.Itoa(os.Getpid() + 1), "1", false}, // passed to the parent
+	}
+	for _, tt := range tests {
+		t.Setenv("LISTEN_PID", tt.pid)
+		t.Setenv("LISTEN_FDS", tt.fds)
+		if got := socketActivated(); got != tt.want {
+			t.Errorf("socketActivated() with LISTEN_PID=%q LISTEN_FDS=%q = %v, want %v", tt.pid, tt.fds, got, tt.want)
+		}
+	}
+}
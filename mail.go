@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxMessageSize is the largest message of a maildir that is read for attachments
+const maxMessageSize = 256 << 20
+
+// mailAttachment is a pdf attached to a message
+type mailAttachment struct {
+	name string
+	data []byte
+}
+
+// ingestMaildir saves to dir the pdfs attached to the messages of the maildir at root,
+// and of its folders, and adds them with origin mail and the sender and subject of their
+// message. An attachment is saved once, so that a maildir can be ingested again.
+func ingestMaildir(root, dir string) error {
+	if _, err := os.Stat(filepath.Join(root, "cur")); err != nil {
+		return fmt.Errorf("%s is not a maildir: %w", root, err)
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("walk error %s: %v", path, err)
+			return nil
+		}
+		if parent := filepath.Base(filepath.Dir(path)); d.IsDir() || parent != "cur" && parent != "new" {
+			return nil
+		}
+		if err := ingestMessage(path, dir); err != nil {
+			log.Printf("mail error %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// ingestMessage saves to dir and adds the pdfs attached to the message in the file at path
+func ingestMessage(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	origin, atts, err := mailAttachments(io.LimitReader(f, maxMessageSize))
+	if err != nil {
+		return err
+	}
+	for _, a := range atts {
+		p, err := saveAttachment(dir, a)
+		if err != nil {
+			return err
+		}
+		pdfOrigin = origin
+		if err := addPDF(p); err != nil {
+			log.Printf("add error %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// saveAttachment saves a in dir, with its name or the name with a number if a file with
+// another content has it, and returns the path of the file. If a file with the content
+// of a exists, its path is returned instead.
+func saveAttachment(dir string, a mailAttachment) (string, error) {
+	ext := filepath.Ext(a.name)
+	base := strings.TrimSuffix(a.name, ext)
+	for i := 0; ; i++ {
+		p := filepath.Join(dir, a.name)
+		if i > 0 {
+			p = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, ext))
+		}
+		data, err := os.ReadFile(p)
+		if err == nil {
+			if bytes.Equal(data, a.data) {
+				return p, nil
+			}
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(a.data); err != nil {
+			f.Close()
+			os.Remove(p)
+			return "", err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(p)
+			return "", err
+		}
+		return p, nil
+	}
+}
+
+// mailAttachments returns the origin of the message read from r, like
+// "mail from ann@example.com: Paper draft", and its pdf attachments
+func mailAttachments(r io.Reader) (string, []mailAttachment, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return "", nil, err
+	}
+	dec := new(mime.WordDecoder)
+	from := msg.Header.Get("From")
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+	subject := msg.Header.Get("Subject")
+	if s, err := dec.DecodeHeader(subject); err == nil {
+		subject = s
+	}
+	origin := "mail from " + strings.TrimSpace(from)
+	if subject = strings.Join(strings.Fields(subject), " "); subject != "" {
+		origin += ": " + subject
+	}
+
+	var atts []mailAttachment
+	err = walkPart(textproto.MIMEHeader(msg.Header), msg.Body, &atts)
+	return origin, atts, err
+}
+
+// walkPart appends to atts the pdfs in the part with header h and body, and in its parts
+func walkPart(h textproto.MIMEHeader, body io.Reader, atts *[]mailAttachment) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPart(p.Header, p, atts); err != nil {
+				return err
+			}
+		}
+	}
+
+	name := params["name"]
+	if _, dparams, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && dparams["filename"] != "" {
+		name = dparams["filename"]
+	}
+	if n, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = n
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	isPDF := strings.EqualFold(filepath.Ext(name), ".pdf")
+	if mediaType != "application/pdf" && !(isPDF && mediaType == "application/octet-stream") {
+		return nil
+	}
+	if !isPDF {
+		name = "attachment.pdf"
+	}
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("bad attachment %s: %w", name, err)
+	}
+	*atts = append(*atts, mailAttachment{name: name, data: data})
+	return nil
+}
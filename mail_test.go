@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMessage = `From: Ann Smith <ann@example.com>
+Subject: =?utf-8?q?Draft_f=C3=BCr?= review
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain
+
+see the attached
+--inner--
+--outer
+Content-Type: application/pdf; name="draft.pdf"
+Content-Disposition: attachment; filename="=?utf-8?q?entw=C3=BCrf.pdf?="
+Content-Transfer-Encoding: base64
+
+JVBERi0x
+LjQK
+--outer
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="..\\notes.PDF"
+
+%PDF-1.5
+--outer
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="data.bin"
+
+binary
+--outer
+Content-Type: application/pdf
+Content-Transfer-Encoding: quoted-printable
+
+%PDF=3D
+--outer--
+`
+
+func TestMailAttachments(t *testing.T) {
+	tests := []struct {
+		msg    string
+		origin string
+		atts   []mailAttachment
+	}{
+		{
+			testMessage,
+			"mail from ann@example.com: Draft für review",
+			[]mailAttachment{
+				{name: "entwürf.pdf", data: []byte("%PDF-1.4\n")},
+				{name: "notes.PDF", data: []byte("%PDF-1.5")},
+				{name: "attachment.pdf", data: []byte("%PDF=")},
+			},
+		},
+		{
+			"From: bob@example.com\nContent-Type: application/pdf; name=\"a.pdf\"\n\n%PDF",
+			"mail from bob@example.com",
+			[]mailAttachment{{name: "a.pdf", data: []byte("%PDF")}},
+		},
+		{"From: bob@example.com\nSubject: no pdfs\n\nhello\n", "mail from bob@example.com: no pdfs", nil},
+	}
+	for _, tt := range tests {
+		origin, atts, err := mailAttachments(strings.NewReader(strings.ReplaceAll(tt.msg, "\n", "\r\n")))
+		if err != nil {
+			t.Errorf("mailAttachments(%.20q) failed: %v", tt.msg, err)
+			continue
+		}
+		if origin != tt.origin || !reflect.DeepEqual(atts, tt.atts) {
+			t.Errorf("mailAttachments(%.20q) = %q %q, want %q %q", tt.msg, origin, atts, tt.origin, tt.atts)
+		}
+	}
+}
+
+func TestSaveAttachment(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		att  mailAttachment
+		want string
+	}{
+		{mailAttachment{name: "a.pdf", data: []byte("one")}, "a.pdf"},
+		{mailAttachment{name: "a.pdf", data: []byte("two")}, "a-1.pdf"},
+		{mailAttachment{name: "a.pdf", data: []byte("one")}, "a.pdf"},
+		{mailAttachment{name: "a.pdf", data: []byte("two")}, "a-1.pdf"},
+		{mailAttachment{name: "a.pdf", data: []byte("three")}, "a-2.pdf"},
+	}
+	for _, tt := range tests {
+		p, err := saveAttachment(dir, tt.att)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != filepath.Join(dir, tt.want) {
+			t.Errorf("saveAttachment(%s) = %s, want %s", tt.att.data, p, tt.want)
+		}
+		if data, err := os.ReadFile(p); err != nil || string(data) != string(tt.att.data) {
+			t.Errorf("%s has %q, want %q", p, data, tt.att.data)
+		}
+	}
+}
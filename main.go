@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"flag"
@@ -9,15 +10,16 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/peterbourgon/ff/v3/ffcli"
 )
 
@@ -25,13 +27,27 @@ const (
 	progName = "booklice"
 )
 
+// pdfOrigin records how the pdfs being added entered the index, like add or calibre
+var pdfOrigin = "add"
+
+// coversDir, if set, is the dir where covers are stored as files named by the sig of their pdf
+var coversDir string
+
+// defaultViewers are the viewers used for covers by file extension
+var defaultViewers = map[string]string{
+	".jpg": "eog",
+	".pdf": "evince",
+}
+
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("")
 
 	rootFs := flag.NewFlagSet("rootFlags", flag.ExitOnError)
-	dbName := rootFs.String("n", "main.db", "database. Created in .config. May use absolute paths like ./test.db")
+	dbName := rootFs.String("n", "main.db", "database. Created in .config. May use absolute paths like ./test.db. Search accepts a comma separated list of databases and searches all of them")
 	gsName := rootFs.String("e", "gs", "ghostscript executable. Must be in PATH")
+	keyFile := rootFs.String("k", "", "file with the key to encrypt the text and the covers of pdfs, see db encrypt for older pdfs. "+
+		"Not encrypted: the full text and trigram indexes, that reveal the words of the text, and the path, title, abstract, keywords, toc, isbn and fingerprint of each pdf, the paths in the history, the searches, the names of the cover files and the hashes of the covers")
 	rootCmd := &ffcli.Command{
 		Name:       progName,
 		ShortUsage: progName + " [flags] subcommand [flags] <arguments>...",
@@ -39,95 +55,1263 @@ func main() {
 		LongHelp:   progName + " indexes pdf files and builds a full text search index for their contents. Also it stores, and can display, the cover of each pdf.",
 		FlagSet:    rootFs,
 		Exec: func(ctx context.Context, args []string) error {
-			return flag.ErrHelp
+			return flag.ErrHelp
+		},
+	}
+
+	addFs := flag.NewFlagSet("addFlags", flag.ExitOnError)
+	diskCovers := addFs.Bool("c", false, "Store covers as files in the user cache dir instead of the database")
+	addOrigin := addFs.String("origin", "add", "Record the pdfs as coming from origin, like a batch name. Shown by info and matched by list -origin")
+	storeFiles := addFs.Bool("store", false, "Store the pdf files, compressed, in the database too, so that open works after they are moved or deleted. Pdfs already added are stored as well")
+	addWebDAVDir := addFs.String("webdav-dir", "", "Download the pdfs of webdav:// urls to this dir instead of the user cache dir")
+	addCmd := &ffcli.Command{
+		Name:       "add",
+		ShortUsage: "add [flags] paths...",
+		ShortHelp:  "Add adds the pdfs at paths to the index",
+		LongHelp:   "Add adds the pdfs at paths to the index. If path is a directory, it walks in it and adds all pdfs found. If path is a webdav:// url, or webdav+http:// without tls, it downloads the pdfs of the folder of the WebDAV server, like a Nextcloud share, and of its folders, and adds them. Pdfs already downloaded are not downloaded again. The user and password are those of the url or of the environment variables BOOKLICE_WEBDAV_USER and BOOKLICE_WEBDAV_PASSWORD.",
+		FlagSet:    addFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+			if *diskCovers {
+				dir, err := userCoversDir()
+				if err != nil {
+					return fmt.Errorf("failed to create covers dir: %w", err)
+				}
+				coversDir = dir
+			}
+			storeOriginals = *storeFiles
+			pdfOrigin = *addOrigin
+			for _, path := range args {
+				if isWebDAV(path) {
+					dir := *addWebDAVDir
+					if dir == "" {
+						var err error
+						if dir, err = webdavDir(path); err != nil {
+							return err
+						}
+					}
+					if err := addWebDAV(ctx, path, dir); err != nil {
+						return fmt.Errorf("failed to add %q: %w", path, err)
+					}
+					continue
+				}
+				if err := addPath(path); err != nil {
+					return fmt.Errorf("failed to add path %q: %w", path, err)
+				}
+			}
+			return nil
+		},
+	}
+
+	importCalibreFs := flag.NewFlagSet("importCalibreFlags", flag.ExitOnError)
+	importCalibreCovers := importCalibreFs.Bool("c", false, "Store covers as files in the user cache dir instead of the database")
+	importCalibreStore := importCalibreFs.Bool("store", false, "Store the pdf files, compressed, in the database too")
+	importCalibreCmd := &ffcli.Command{
+		Name:       "import-calibre",
+		ShortUsage: "import-calibre [flags] dir",
+		ShortHelp:  "Add the pdfs of a Calibre library",
+		LongHelp:   "Add the pdfs of the books of the Calibre library in dir, with the titles, authors, tags and covers of the library instead of the ones guessed from the pdfs. The tags are added to the keywords. Books already in the index are skipped, so importing the library again adds only its new books. The pdfs are recorded with origin calibre.",
+		FlagSet:    importCalibreFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			if *importCalibreCovers {
+				dir, err := userCoversDir()
+				if err != nil {
+					return fmt.Errorf("failed to create covers dir: %w", err)
+				}
+				coversDir = dir
+			}
+			storeOriginals = *importCalibreStore
+			pdfOrigin = "calibre"
+			if err := importCalibre(args[0]); err != nil {
+				return fmt.Errorf("failed to import %q: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	importZoteroFs := flag.NewFlagSet("importZoteroFlags", flag.ExitOnError)
+	importZoteroCovers := importZoteroFs.Bool("c", false, "Store covers as files in the user cache dir instead of the database")
+	importZoteroStore := importZoteroFs.Bool("store", false, "Store the pdf files, compressed, in the database too")
+	importZoteroCmd := &ffcli.Command{
+		Name:       "import-zotero",
+		ShortUsage: "import-zotero [flags] dir",
+		ShortHelp:  "Add the pdfs of a Zotero library",
+		LongHelp:   "Add the pdfs attached to the items of the Zotero data dir, like ~/Zotero, with the titles, authors and tags of their items instead of the ones guessed from the pdfs. Zotero must be closed, since it locks its database. Pdfs already in the index are skipped. The pdfs are recorded with origin zotero.",
+		FlagSet:    importZoteroFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			if *importZoteroCovers {
+				dir, err := userCoversDir()
+				if err != nil {
+					return fmt.Errorf("failed to create covers dir: %w", err)
+				}
+				coversDir = dir
+			}
+			storeOriginals = *importZoteroStore
+			pdfOrigin = "zotero"
+			if err := importZotero(args[0]); err != nil {
+				return fmt.Errorf("failed to import %q: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	importOPDSFs := flag.NewFlagSet("importOPDSFlags", flag.ExitOnError)
+	importOPDSDir := importOPDSFs.String("dir", "", "The dir to download the pdfs to, required")
+	importOPDSMatch := importOPDSFs.String("match", "", "Import only the publications with titles that match this regular expression")
+	importOPDSMax := importOPDSFs.Int("max", 0, "Import at most this many publications, 0 for all")
+	importOPDSCovers := importOPDSFs.Bool("c", false, "Store covers as files in the user cache dir instead of the database")
+	importOPDSCmd := &ffcli.Command{
+		Name:       "import-opds",
+		ShortUsage: "import-opds -dir dir [flags] url",
+		ShortHelp:  "Download and add the pdfs of an OPDS catalog",
+		LongHelp:   "Download to dir and add the pdfs of the OPDS catalog at url, of its next pages and of the catalogs it links to, with the titles, authors and covers of the catalog. Publications in other formats are skipped. Pdfs whose files are already in dir are not downloaded again, so importing the catalog again mirrors its new pdfs. The pdfs are recorded with origin opds.",
+		FlagSet:    importOPDSFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 || *importOPDSDir == "" || *importOPDSMax < 0 {
+				return flag.ErrHelp
+			}
+			var f opdsFilter
+			if *importOPDSMatch != "" {
+				re, err := regexp.Compile(*importOPDSMatch)
+				if err != nil {
+					return fmt.Errorf("bad -match: %w", err)
+				}
+				f.match = re
+			}
+			f.max = *importOPDSMax
+			dir, err := filepath.Abs(*importOPDSDir)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if *importOPDSCovers {
+				if coversDir, err = userCoversDir(); err != nil {
+					return fmt.Errorf("failed to create covers dir: %w", err)
+				}
+			}
+			pdfOrigin = "opds"
+			if err := importOPDS(ctx, args[0], dir, f); err != nil {
+				return fmt.Errorf("failed to import %q: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	ingestMailFs := flag.NewFlagSet("ingestMailFlags", flag.ExitOnError)
+	ingestMailDir := ingestMailFs.String("dir", "", "Save the attached pdfs to this dir, required")
+	ingestMailCovers := ingestMailFs.Bool("c", false, "Store covers as files in the user cache dir instead of the database")
+	ingestMailStore := ingestMailFs.Bool("store", false, "Store the pdf files, compressed, in the database too")
+	ingestMailCmd := &ffcli.Command{
+		Name:       "ingest-mail",
+		ShortUsage: "ingest-mail -dir dir [flags] maildir",
+		ShortHelp:  "Add the pdfs attached to the messages of a maildir",
+		LongHelp:   "Save to dir and add the pdfs attached to the messages of the maildir, and of its folders. The pdfs are recorded with origin like mail from ann@example.com: subject, so list -origin 'mail from ann@%' lists the pdfs she sent. Attachments already in dir are not saved again, so a maildir can be ingested again for its new messages. IMAP folders can be synced to a maildir with tools like mbsync or offlineimap.",
+		FlagSet:    ingestMailFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 || *ingestMailDir == "" {
+				return flag.ErrHelp
+			}
+			dir, err := filepath.Abs(*ingestMailDir)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if *ingestMailCovers {
+				if coversDir, err = userCoversDir(); err != nil {
+					return fmt.Errorf("failed to create covers dir: %w", err)
+				}
+			}
+			storeOriginals = *ingestMailStore
+			if err := ingestMaildir(args[0], dir); err != nil {
+				return fmt.Errorf("failed to ingest %q: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	exportZoteroFs := flag.NewFlagSet("exportZoteroFlags", flag.ExitOnError)
+	exportZoteroOut := exportZoteroFs.String("o", "", "Write to the file instead of stdout")
+	exportZoteroCmd := &ffcli.Command{
+		Name:       "export-zotero",
+		ShortUsage: "export-zotero [flags] [ids...]",
+		ShortHelp:  "Write the pdfs as BibTeX for Zotero",
+		LongHelp:   "Write the pdfs with ids, or all, as BibTeX entries with the title, the authors, the ISBN, the keywords, the abstract and a link to the pdf file, that Zotero imports with the files attached as links. The DOI and the year of the copyright notice are looked for in the first pages.",
+		FlagSet:    exportZoteroFs,
+		Exec: func(ctx context.Context, args []string) error {
+			var ids []int
+			if len(args) > 0 {
+				var err error
+				if ids, err = parseIDs(args); err != nil {
+					return err
+				}
+			}
+			if *exportZoteroOut == "" {
+				return exportZotero(os.Stdout, ids)
+			}
+			f, err := os.Create(*exportZoteroOut)
+			if err != nil {
+				return err
+			}
+			if err := exportZotero(f, ids); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+
+	exportSiteFs := flag.NewFlagSet("exportSiteFlags", flag.ExitOnError)
+	exportSiteFiles := exportSiteFs.Bool("files", false, "Copy the pdf files, or their stored originals, to the site too")
+	exportSiteCmd := &ffcli.Command{
+		Name:       "export-site",
+		ShortUsage: "export-site [flags] dir",
+		ShortHelp:  "Write a static website of the pdfs",
+		LongHelp:   "Write to dir a static website of the pdfs not in the trash, that can be hosted by any web server or opened from the disk: an index page with the covers and titles, searchable in the browser by the words of the titles, authors and keywords, and a page with the details of each pdf. The search index is built by export-site and needs no server. The files in dir are overwritten.",
+		FlagSet:    exportSiteFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return exportSite(ctx, args[0], *exportSiteFiles)
+		},
+	}
+
+	exportMarkdownFs := flag.NewFlagSet("exportMarkdownFlags", flag.ExitOnError)
+	exportMarkdownCovers := exportMarkdownFs.String("covers", "", "Write the covers to this dir, like the static dir of the site")
+	exportMarkdownCoverURL := exportMarkdownFs.String("cover-url", "/covers/", "The url of the covers dir in the site, for the cover of the front matter")
+	exportMarkdownCmd := &ffcli.Command{
+		Name:       "export-markdown",
+		ShortUsage: "export-markdown [flags] dir",
+		ShortHelp:  "Write a Markdown file for each pdf, for static site generators",
+		LongHelp:   "Write to dir, like the content dir of a Hugo or Jekyll site, a Markdown file for each pdf not in the trash, named by its id and title. The front matter has the title, authors, keywords as tags, the year and DOI found in the first pages, the date added, pages, ISBNs and cover, and the content is the abstract and table of contents. The files in dir are overwritten.",
+		FlagSet:    exportMarkdownFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return exportMarkdown(ctx, args[0], *exportMarkdownCovers, *exportMarkdownCoverURL)
+		},
+	}
+
+	exportTextFs := flag.NewFlagSet("exportTextFlags", flag.ExitOnError)
+	exportTextFormat := exportTextFs.String("format", "recoll", "The format of the export: recoll or xapian")
+	exportTextCmd := &ffcli.Command{
+		Name:       "export-text",
+		ShortUsage: "export-text [flags] dir",
+		ShortHelp:  "Write the text of the pdfs for Recoll or Xapian",
+		LongHelp:   "Write to dir the text and details of the pdfs not in the trash, for desktop search. The recoll format is an html file for each pdf, with the title, authors, keywords and abstract in the head, for Recoll to index dir like any other. Only the changed files are rewritten, and the files of trashed pdfs are removed, so export-text can run before recollindex. The xapian format is booklice.dump, for scriptindex of Xapian Omega with the index script booklice.script: scriptindex db booklice.script booklice.dump. The id of each pdf is its unique term, so a new dump updates the database.",
+		FlagSet:    exportTextFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return exportText(ctx, args[0], *exportTextFormat)
+		},
+	}
+
+	syncFs := flag.NewFlagSet("syncFlags", flag.ExitOnError)
+	syncPull := syncFs.Bool("pull", false, "Only copy the changes of the other database to this one")
+	syncFiles := syncFs.Bool("files", false, "Copy the stored files of the pdfs too")
+	syncCmd := &ffcli.Command{
+		Name:       "sync",
+		ShortUsage: "sync [flags] database|host:database",
+		ShortHelp:  "Merge the pdfs of another database",
+		LongHelp:   "Merge this database and another, a file or a name like -n, or the database of booklice on host over ssh and scp. The pdfs of each missing from the other, by signature, are copied with their covers, and the pdfs trashed or restored last in one are trashed or restored in the other. Saved searches are merged, the latest saved wins. Pdfs deleted for good with trash empty come back if the other database has them, and the paths of the pdfs are kept, so they may not exist on this machine, unless their files are stored and copied with -files. Encrypted texts need the same key in both.",
+		FlagSet:    syncFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			if host, name, ok := strings.Cut(args[0], ":"); ok && !strings.Contains(host, string(filepath.Separator)) {
+				return syncRemote(ctx, host, name, *syncPull, *syncFiles, os.Stdout)
+			}
+			path, err := pathFromName(args[0])
+			if err != nil {
+				return err
+			}
+			return syncDatabase(ctx, path, args[0], *syncPull, *syncFiles, os.Stdout)
+		},
+	}
+
+	relocateCmd := &ffcli.Command{
+		Name:       "relocate",
+		ShortUsage: "relocate dir",
+		ShortHelp:  "Move the pdfs of a git-annex repository to its new place",
+		LongHelp:   "Move the pdfs added from a git-annex repository to the files with the same annex keys in the repository at dir, after the repository was moved or cloned elsewhere. Files are matched by key, so files renamed in the repository are found too. Pdfs not added from an annexed file are left alone.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			dir, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			return relocateAnnexed(dir, os.Stdout)
+		},
+	}
+
+	mcpCmd := &ffcli.Command{
+		Name:       "mcp",
+		ShortUsage: "mcp",
+		ShortHelp:  "Serve the library to AI assistants over the Model Context Protocol",
+		LongHelp:   "Serve the tools search, info and page_text over the Model Context Protocol on stdin and stdout, so that local AI assistants can search the pdfs and read their pages. Configure the assistant to run booklice -n database mcp.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			return serveMCP(ctx, os.Stdin, os.Stdout)
+		},
+	}
+
+	apiFs := flag.NewFlagSet("apiFlags", flag.ExitOnError)
+	apiSocket := apiFs.String("socket", "", "The path of the unix socket, by default booklice-{database}.sock in $XDG_RUNTIME_DIR or the temporary dir")
+	apiCmd := &ffcli.Command{
+		Name:       "api",
+		ShortUsage: "api [flags]",
+		ShortHelp:  "Serve a JSON-RPC api on a unix socket",
+		LongHelp:   "Serve JSON-RPC 2.0 on a unix socket, one request and one response per line, for local programs that use booklice as a service. The methods are add with {\"paths\": [...]}, absolute paths of pdfs or directories, search with {\"query\": q, \"limit\": n, \"offset\": n}, cover with {\"id\": n}, that returns the image base64 encoded, and ping. Only the user may connect to the socket. With systemd socket activation, the passed socket is used.",
+		FlagSet:    apiFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			path := *apiSocket
+			if path == "" {
+				path = apiSocketPath()
+			}
+			pdfOrigin = "api"
+			return serveAPI(ctx, path)
+		},
+	}
+
+	removeCmd := &ffcli.Command{
+		Name:       "remove",
+		ShortUsage: "remove ids...",
+		ShortHelp:  "Move pdfs to the trash",
+		LongHelp:   "Move pdfs to the trash. Trashed pdfs are not searched or listed and can be restored with trash restore until the trash is emptied.",
+		Exec: func(ctx context.Context, args []string) error {
+			ids, err := parseIDs(args)
+			if err != nil {
+				return err
+			}
+			return trashPDFs(ids)
+		},
+	}
+
+	trashLsCmd := &ffcli.Command{
+		Name:       "ls",
+		ShortUsage: "trash ls",
+		ShortHelp:  "List the pdfs in the trash",
+		LongHelp:   "List the pdfs in the trash.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			return listTrash(os.Stdout)
+		},
+	}
+
+	trashRestoreCmd := &ffcli.Command{
+		Name:       "restore",
+		ShortUsage: "trash restore ids...",
+		ShortHelp:  "Move pdfs out of the trash",
+		LongHelp:   "Move pdfs out of the trash.",
+		Exec: func(ctx context.Context, args []string) error {
+			ids, err := parseIDs(args)
+			if err != nil {
+				return err
+			}
+			return restorePDFs(ids)
+		},
+	}
+
+	trashEmptyCmd := &ffcli.Command{
+		Name:       "empty",
+		ShortUsage: "trash empty",
+		ShortHelp:  "Delete the pdfs in the trash",
+		LongHelp:   "Delete for good the pdfs in the trash, with their text and covers. The pdf files are not touched.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			return emptyTrash(os.Stdout)
+		},
+	}
+
+	trashCmd := &ffcli.Command{
+		Name:        "trash",
+		ShortUsage:  "trash subcommand <arguments>...",
+		ShortHelp:   "Manage the removed pdfs",
+		LongHelp:    "Manage the removed pdfs.",
+		Subcommands: []*ffcli.Command{trashLsCmd, trashRestoreCmd, trashEmptyCmd},
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+	}
+
+	coverFs := flag.NewFlagSet("coverFlags", flag.ExitOnError)
+	coverViewer := coverFs.String("v", "", "the viewer to use. Must be on PATH. Defaults to eog for jpeg covers and evince for the pdf covers of older indexes")
+	coverCmd := &ffcli.Command{
+		Name:       "cover",
+		ShortUsage: "cover [flags] id",
+		ShortHelp:  "Show cover of pdf by id",
+		LongHelp:   "Show cover of pdf by id. The id may be label:id, as written by search over many databases.",
+		FlagSet:    coverFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			id, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			if err := showCover(id, *coverViewer); err != nil {
+				return fmt.Errorf("failed to display doc %d: %w", id, err)
+			}
+			return nil
+		},
+	}
+
+	openFs := flag.NewFlagSet("openFlags", flag.ExitOnError)
+	openViewer := openFs.String("v", "", "the viewer to use. Must be on PATH. Defaults to evince")
+	openCmd := &ffcli.Command{
+		Name:       "open",
+		ShortUsage: "open [flags] id",
+		ShortHelp:  "Open pdf by id",
+		LongHelp:   "Open pdf by id with a viewer. If the file is missing and it was stored with add -store, the stored copy is opened. The id may be label:id, as written by search over many databases.",
+		FlagSet:    openFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			id, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			if err := openPDF(id, *openViewer); err != nil {
+				return fmt.Errorf("failed to open doc %d: %w", id, err)
+			}
+			return nil
+		},
+	}
+
+	searchFs := flag.NewFlagSet("searchFlags", flag.ExitOnError)
+	matchInBold := searchFs.Bool("b", true, "Highlight the matches, see -color and -style")
+	searchColor := searchFs.String("color", "auto", "Highlight the matches always, never or auto, only if the output is a terminal")
+	searchStyle := searchFs.String("style", "bold", "The style of the matches: bold, underline, reverse, red, green, yellow, blue, magenta, cyan or ANSI codes, comma separated, like bold,red or 1;38;5;208")
+	docsToFetch := searchFs.Int("n", 10, "Fetch at most n documents")
+	searchOffset := searchFs.Int("offset", 0, "Skip the first offset documents")
+	searchPage := searchFs.Int("page", 0, "Fetch the page of n documents, starting from 1. Same as -offset (page-1)*n")
+	snippetTokens := searchFs.Int("snippet-tokens", 16, "Show snippets of at most the number of words, up to 64. Substring search shows 4 times as many characters")
+	searchContext := searchFs.String("context", "snippet", "Show for each pdf the snippet with the matches, or the paragraph of the text with the first match")
+	searchSnippets := searchFs.Int("snippets", 1, "Show for each pdf snippets from up to the number of pages with matches, each labelled with its page")
+	namesOnly := searchFs.Bool("t", false, "Show pdf names only. If the output is not a terminal, show the paths only")
+	explain := searchFs.Bool("explain", false, "Show after the results, on stderr, the sql and the fts query, how many pdfs were found before -n, the time it took and the rank of each result")
+	countOnly := searchFs.Bool("count", false, "Show only the number of pdfs found, all of them and not only n")
+	interactive := searchFs.Bool("i", false, "After the results, ask for a result to open, or its cover")
+	nulNames := searchFs.Bool("0", false, "Show the paths only, separated by NUL, for xargs -0")
+	jsonOut := searchFs.Bool("json", false, "Write one json object per pdf with the library, id, path, title, pages, rank, snippet and the offsets of the matches in the snippet. Same as -format json")
+	searchFormat := searchFs.String("format", "text", "Write the results as text, json, csv or tsv. Tables start with a header")
+	searchTemplate := searchFs.String("template", "", "Write each pdf with the go text/template, like {{.ID}}\\t{{.Title}}. The fields are Library, ID, Path, Title, Pages, Rank, Snippet and Matches")
+	searchIn := searchFs.String("in", "", "Match the query against the columns only, comma separated, like title,path. The columns are text, abstract, keywords, toc, title and path")
+	keywordsOnly := searchFs.Bool("keywords", false, "Match the query against the keywords of pdfs only")
+	tocOnly := searchFs.Bool("toc", false, "Match the query against the headings of the tables of contents of pdfs only")
+	substring := searchFs.Bool("substr", false, "Match the query as a substring of words. Needs the trigram index, see db trigram")
+	correct := searchFs.Bool("correct", true, "If no pdfs match, correct the misspelled words of the query, like dijsktra to dijkstra, and search again")
+	searchAll := searchFs.String("all", "", "Find pdfs with all the words, like -all 'btree index'. A word ending in * matches as a prefix. Combined with the query and the other word flags with AND")
+	searchAny := searchFs.String("any", "", "Find pdfs with any of the words")
+	searchPhrase := searchFs.String("phrase", "", "Find pdfs with the words in sequence")
+	searchNot := searchFs.String("not", "", "Skip pdfs with any of the words")
+	searchNear := searchFs.String("near", "", "Find pdfs with the words close to each other, like -near 'btree split'")
+	searchWithin := searchFs.Int("within", 0, "The words of -near are at most that many words apart. The default is 10")
+	likeDoc := searchFs.String("like-doc", "", "Find pdfs like the pdf with the id, or label:id, by its keywords. Combined with the query with AND")
+	searchSaved := searchFs.String("saved", "", "Search the pdfs found by the saved search with the name, see save")
+	searchLast := searchFs.Int("last", 0, "Run again the nth latest search, see history search. Flags and a query given override those of the search")
+	recordHistory := searchFs.Bool("history", true, "Record the search in the history, see history search")
+	regex := searchFs.Bool("regex", false, "Match the query as a go regexp, like v1\\.\\d+, against the stored text of pdfs. Slower, the index is not used and the pdfs are listed in the order they were added")
+	searchSince := searchFs.String("since", "", "Search pdfs added on or after the date, like 2024-01-01")
+	searchUntil := searchFs.String("until", "", "Search pdfs added on or before the date, like 2024-12-31")
+	searchPages := searchFs.String("pages", "", "Search pdfs with a number of pages in the range, like 100..300, 100.. or ..300")
+	searchPath := searchFs.String("path", "", "Search pdfs with a path matching the sql like expression, like %/papers/%")
+	searchNotPath := searchFs.String("not-path", "", "Skip pdfs with a path matching the sql like expression, like %/slides/%")
+	searchRank := searchFs.String("rank", "", "Change the weights of the columns in ranking, like title=20,path=0. The columns and their default weights are text=1, abstract=5, keywords=2, toc=3, title=10 and path=2")
+	searchOrigin := searchFs.String("origin", "", "Search pdfs with an origin matching the sql like expression, see add -origin")
+	searchTag := searchFs.String("tag", "", "Search pdfs with the keyword, like the tags of import-calibre")
+	searchNotTag := searchFs.String("not-tag", "", "Skip pdfs with the keyword, like slides")
+	searchCmd := &ffcli.Command{
+		Name:       "search",
+		ShortUsage: "search [flags] query",
+		ShortHelp:  "Search pdfs for terms",
+		LongHelp:   "Search pdfs for terms. Check https://www.sqlite.org/fts5.html for query details. For each document display the id to be used with cover, the path of the file and the snippet with the term",
+		FlagSet:    searchFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if *searchLast > 0 && len(args) <= 1 {
+				query, err := rerunSearch(searchFs, *searchLast)
+				if err != nil {
+					return err
+				}
+				if len(args) == 0 {
+					args = []string{query}
+				}
+			}
+			if len(args) > 1 {
+				return flag.ErrHelp
+			}
+			userQuery := strings.Join(args, "")
+			likeID := 0
+			if *likeDoc != "" {
+				if *regex || *substring {
+					return errors.New("-like-doc works without -regex and -substr")
+				}
+				id, err := parseRef(*likeDoc)
+				if err != nil {
+					return err
+				}
+				query, err := similarQuery(id)
+				if err != nil {
+					return err
+				}
+				if query == "" {
+					return fmt.Errorf("pdf %d has no keywords", id)
+				}
+				if userQuery != "" {
+					query = "(" + userQuery + ") AND (" + query + ")"
+				}
+				args, likeID = []string{query}, id
+			}
+			terms := queryTerms{all: *searchAll, any: *searchAny, phrase: *searchPhrase, not: *searchNot, near: *searchNear, within: *searchWithin}
+			if terms != (queryTerms{}) {
+				if *regex || *substring {
+					return errors.New("-all, -any, -phrase, -not and -near build fts queries and work without -regex and -substr")
+				}
+				query, err := terms.build(strings.Join(args, ""))
+				if err != nil {
+					return err
+				}
+				args = []string{query}
+			}
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			f, err := newFilter(*searchSince, *searchUntil, *searchPages, *searchPath, *searchNotPath, *searchOrigin, *searchTag, *searchNotTag)
+			if err != nil {
+				return err
+			}
+			f.except = likeID
+			if *jsonOut {
+				*searchFormat = "json"
+			}
+			if err := checkFormat(*searchFormat); err != nil {
+				return err
+			}
+			tmpl, err := parseTemplate(*searchTemplate)
+			if err != nil {
+				return err
+			}
+			if tmpl != nil && *searchFormat != "text" {
+				return errors.New("-template works with the text format only")
+			}
+			offset, err := pageOffset(*searchOffset, *searchPage, *docsToFetch)
+			if err != nil {
+				return err
+			}
+			if *snippetTokens < 1 || *snippetTokens > 64 {
+				return errors.New("-snippet-tokens must be from 1 to 64")
+			}
+			if *searchContext != "snippet" && *searchContext != "paragraph" {
+				return errors.New("-context must be snippet or paragraph")
+			}
+			if *searchSnippets < 1 {
+				return errors.New("-snippets must be at least 1")
+			}
+			if *searchSnippets > 1 && *searchContext == "paragraph" {
+				return errors.New("use either -snippets or -context paragraph")
+			}
+			opts := searchOptions{limit: *docsToFetch, offset: offset, tokens: *snippetTokens, paragraph: *searchContext == "paragraph", snippets: *searchSnippets}
+			if *interactive && (len(libraries) > 0 || *searchFormat != "text") {
+				return errors.New("-i works with a single database and the text format")
+			}
+			highlight, err := highlightStyle(*searchColor, *searchStyle, os.Stdout)
+			if err != nil {
+				return err
+			}
+			if !*matchInBold {
+				highlight = ""
+			}
+			format := resultFormat{name: *searchFormat, namesOnly: *namesOnly || *nulNames, pathsOnly: !isTerminal(os.Stdout), nul: *nulNames, highlight: highlight, tmpl: tmpl}
+			if *recordHistory {
+				if err := recordSearch(searchArgs(searchFs, userQuery, "last", "history")); err != nil {
+					return fmt.Errorf("failed to record the search: %w", err)
+				}
+			}
+			if *regex {
+				if len(libraries) > 0 || *substring || *keywordsOnly || *tocOnly || *searchRank != "" || *searchSaved != "" {
+					return errors.New("regex search works with a single database and without -substr, -keywords, -toc, -rank and -saved")
+				}
+				re, err := regexp.Compile(args[0])
+				if err != nil {
+					return err
+				}
+				if *countOnly {
+					results, err := regexSearch(re, searchOptions{limit: math.MaxInt32, tokens: 1, snippets: 1}, f, io.Discard, format)
+					if err != nil {
+						return err
+					}
+					fmt.Println(len(results))
+					return nil
+				}
+				start := time.Now()
+				results, err := regexSearch(re, opts, f, os.Stdout, format)
+				if err != nil {
+					return err
+				}
+				if *explain {
+					explanation{sql: regexSearchSQL, query: re.String(), count: -1, elapsed: time.Since(start)}.write(os.Stderr, results)
+				}
+				if *interactive {
+					return pickResults(results, os.Stdin, os.Stdout)
+				}
+				return nil
+			}
+			query, stmt := args[0], searchStmt
+			rank := defaultRank
+			stmtSQL, countSQL := fmt.Sprintf(searchSQL, rank), searchCountSQL
+			if *searchRank != "" {
+				if rank, err = parseRank(*searchRank); err != nil {
+					return err
+				}
+				stmtSQL = fmt.Sprintf(searchSQL, rank)
+				if stmt, err = db.Prepare(stmtSQL); err != nil {
+					return err
+				}
+			}
+			if len(libraries) > 0 {
+				if *substring {
+					return errors.New("substring search works with a single database")
+				}
+				stmtSQL, countSQL = librariesSearchSQL(rank), librariesCountSQL()
+				if stmt, err = db.Prepare(stmtSQL); err != nil {
+					return fmt.Errorf("failed to search libraries: %w", err)
+				}
+			}
+			saved := ""
+			if *searchSaved != "" {
+				if *substring {
+					return errors.New("substring search works without saved searches")
+				}
+				if saved, err = savedSearch(*searchSaved); err != nil {
+					return err
+				}
+			}
+			if *searchIn != "" {
+				if *keywordsOnly || *tocOnly || *substring {
+					return errors.New("-in works without -keywords, -toc and -substr")
+				}
+				if _, err := inColumns("", *searchIn); err != nil {
+					return err
+				}
+			}
+			column := func(q string) string {
+				if *searchIn != "" {
+					q, _ = inColumns(q, *searchIn)
+				} else if *keywordsOnly {
+					q = "keywords : (" + q + ")"
+				} else if *tocOnly {
+					q = "toc : (" + q + ")"
+				}
+				if saved != "" {
+					q = "(" + saved + ") AND (" + q + ")"
+				}
+				return q
+			}
+			if *substring && !*keywordsOnly && !*tocOnly {
+				if trigramSearchStmt == nil {
+					return errors.New("the trigram index is not enabled, see db trigram")
+				}
+				query, stmt = ftsQuote(query), trigramSearchStmt
+				stmtSQL, countSQL, rank = trigramSearchSQL, trigramCountSQL, ""
+			}
+			if *countOnly {
+				n, err := searchCount(ctx, countSQL, column(query), f)
+				if err != nil {
+					return fmt.Errorf("failed to count for %q: %w", query, err)
+				}
+				fmt.Println(n)
+				return nil
+			}
+			start := time.Now()
+			results, err := search(ctx, stmt, column(query), opts, f, os.Stdout, format)
+			if err != nil {
+				return fmt.Errorf("failed to search for %q: %w", query, err)
+			}
+			if len(results) == 0 && offset == 0 && !*substring && *correct {
+				corrected, err := correctQuery(query)
+				if err != nil {
+					return err
+				}
+				if corrected != query {
+					fmt.Fprintf(os.Stderr, "no pdfs for %q, did you mean %q?\n", query, corrected)
+					if results, err = search(ctx, stmt, column(corrected), opts, f, os.Stdout, format); err != nil {
+						return fmt.Errorf("failed to search for %q: %w", corrected, err)
+					}
+					query = corrected
+				}
+			}
+			if *explain {
+				elapsed := time.Since(start)
+				n, err := searchCount(ctx, countSQL, column(query), f)
+				if err != nil {
+					return err
+				}
+				explanation{sql: stmtSQL, query: column(query), rank: rank, count: n, elapsed: elapsed}.write(os.Stderr, results)
+			}
+			if *interactive {
+				return pickResults(results, os.Stdin, os.Stdout)
+			}
+			return nil
+		},
+	}
+
+	listFs := flag.NewFlagSet("listFlags", flag.ExitOnError)
+	showKeywords := listFs.Bool("k", false, "Show the keywords of each pdf")
+	groupEditions := listFs.Bool("group", false, "Group volumes and editions of the same work")
+	listSince := listFs.String("since", "", "List pdfs added on or after the date, like 2024-01-01")
+	listUntil := listFs.String("until", "", "List pdfs added on or before the date, like 2024-12-31")
+	listPages := listFs.String("pages", "", "List pdfs with a number of pages in the range, like 100..300, 100.. or ..300")
+	listOrigin := listFs.String("origin", "", "List pdfs with an origin matching the sql like expression, see add -origin")
+	listNotPath := listFs.String("not-path", "", "Skip pdfs with a path matching the sql like expression, like %/slides/%")
+	listNotTag := listFs.String("not-tag", "", "Skip pdfs with the keyword, like slides")
+	listFormat := listFs.String("format", "text", "Write the pdfs as text, json, csv or tsv. Tables start with a header")
+	listTemplate := listFs.String("template", "", "Write each pdf with the go text/template, like {{.ID}}\\t{{.Title}}. The fields are ID, Path, Pages, Title, ISBN and Keywords")
+	listSaved := listFs.String("saved", "", "List the pdfs found by the saved search with the name, see save. Lists all of them if no expr is given")
+	listCmd := &ffcli.Command{
+		Name:       "list",
+		ShortUsage: "list [flags] expr..",
+		ShortHelp:  "List pdfs for paths matching sql like expressions",
+		LongHelp:   "List pdfs for paths matching sql like expressions",
+		FlagSet:    listFs,
+		Exec: func(ctx context.Context, args []string) error {
+			f, err := newFilter(*listSince, *listUntil, *listPages, "", *listNotPath, *listOrigin, "", *listNotTag)
+			if err != nil {
+				return err
+			}
+			if err := checkFormat(*listFormat); err != nil {
+				return err
+			}
+			tmpl, err := parseTemplate(*listTemplate)
+			if err != nil {
+				return err
+			}
+			if *groupEditions && (*listFormat != "text" || tmpl != nil) {
+				return errors.New("-group works with the text format only")
+			}
+			if tmpl != nil && *listFormat != "text" {
+				return errors.New("-template works with the text format only")
+			}
+			var match string
+			if *listSaved != "" {
+				if match, err = savedSearch(*listSaved); err != nil {
+					return err
+				}
+				if len(args) == 0 {
+					args = []string{"%"}
+				}
+			}
+			for _, expr := range args {
+				if err := list(expr, match, f, os.Stdout, resultFormat{name: *listFormat, keywords: *showKeywords, tmpl: tmpl}, *groupEditions); err != nil {
+					return fmt.Errorf("failed to list for %q: %w", expr, err)
+				}
+			}
+			return nil
+		},
+	}
+
+	infoCmd := &ffcli.Command{
+		Name:       "info",
+		ShortUsage: "info id",
+		ShortHelp:  "Show the details of pdf by id",
+		LongHelp:   "Show the details of pdf by id. The guessed title is shown normalized and as found in the text. The id may be label:id, as written by search over many databases.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			id, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			if err := info(id, os.Stdout); err != nil {
+				return fmt.Errorf("failed to show info for doc %d: %w", id, err)
+			}
+			return nil
+		},
+	}
+
+	similarFs := flag.NewFlagSet("similarFlags", flag.ExitOnError)
+	similarToFetch := similarFs.Int("n", 10, "Fetch at most n documents")
+	similarCmd := &ffcli.Command{
+		Name:       "similar",
+		ShortUsage: "similar [flags] id",
+		ShortHelp:  "List pdfs similar to pdf by id",
+		LongHelp:   "List pdfs similar to pdf by id. The keywords of the pdf are searched in the index and the best matches are listed. The id may be label:id, as written by search over many databases.",
+		FlagSet:    similarFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			id, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			if err := similar(id, *similarToFetch, os.Stdout); err != nil {
+				return fmt.Errorf("failed to find similar to doc %d: %w", id, err)
+			}
+			return nil
+		},
+	}
+
+	grepFs := flag.NewFlagSet("grepFlags", flag.ExitOnError)
+	grepIgnoreCase := grepFs.Bool("i", false, "Ignore case")
+	grepBold := grepFs.Bool("b", true, "Highlight the matches, see -color and -style")
+	grepColor := grepFs.String("color", "auto", "Highlight the matches always, never or auto, only if the output is a terminal")
+	grepStyle := grepFs.String("style", "bold", "The style of the matches, see search -style")
+	grepCmd := &ffcli.Command{
+		Name:       "grep",
+		ShortUsage: "grep [flags] id|path text",
+		ShortHelp:  "Show the lines of pdf with text",
+		LongHelp:   "Show the lines of pdf with text, with their pages. The stored text of the pdf is searched, the file is not read. The id may be label:id, as written by search over many databases.",
+		FlagSet:    grepFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return flag.ErrHelp
+			}
+			id, err := parseRefOrPath(args[0])
+			if err != nil {
+				return err
+			}
+			highlight, err := highlightStyle(*grepColor, *grepStyle, os.Stdout)
+			if err != nil {
+				return err
+			}
+			if !*grepBold {
+				highlight = ""
+			}
+			if err := grepPDF(id, grepPattern(args[1], *grepIgnoreCase), highlight, os.Stdout); err != nil {
+				return fmt.Errorf("failed to grep doc %d: %w", id, err)
+			}
+			return nil
+		},
+	}
+
+	saveFs := flag.NewFlagSet("saveFlags", flag.ExitOnError)
+	saveDelete := saveFs.Bool("d", false, "Delete the saved search with the name")
+	saveCmd := &ffcli.Command{
+		Name:       "save",
+		ShortUsage: "save [flags] [name query]",
+		ShortHelp:  "Save searches by name",
+		LongHelp:   "Save searches by name, like save dbs 'btree OR lsm'. A saved search is a collection of the pdfs it finds, evaluated on use, for list -saved and search -saved. Without arguments, show the saved searches.",
+		FlagSet:    saveFs,
+		Exec: func(ctx context.Context, args []string) error {
+			switch {
+			case *saveDelete && len(args) == 1:
+				return deleteSearch(args[0])
+			case !*saveDelete && len(args) == 2:
+				return saveSearch(args[0], args[1])
+			case !*saveDelete && len(args) == 0:
+				return savedSearches(os.Stdout)
+			}
+			return flag.ErrHelp
+		},
+	}
+
+	suggestFs := flag.NewFlagSet("suggestFlags", flag.ExitOnError)
+	suggestCount := suggestFs.Int("n", 10, "Show at most n words")
+	suggestCmd := &ffcli.Command{
+		Name:       "suggest",
+		ShortUsage: "suggest [flags] prefix",
+		ShortHelp:  "Show the words of the index with prefix",
+		LongHelp:   "Show the words of the index with prefix, the ones found in most pdfs first. For completion of queries in shells.",
+		FlagSet:    suggestFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			terms, err := suggest(args[0], *suggestCount)
+			if err != nil {
+				return fmt.Errorf("failed to suggest for %q: %w", args[0], err)
+			}
+			for _, t := range terms {
+				fmt.Println(t)
+			}
+			return nil
+		},
+	}
+
+	topicsFs := flag.NewFlagSet("topicsFlags", flag.ExitOnError)
+	topicsCount := topicsFs.Int("k", 8, "Number of topics")
+	topicsTerms := topicsFs.Int("terms", 5, "Number of representative terms shown for each topic")
+	topicsCmd := &ffcli.Command{
+		Name:       "topics",
+		ShortUsage: "topics [flags]",
+		ShortHelp:  "Cluster pdfs by topic",
+		LongHelp:   "Cluster pdfs by topic. The pdfs are grouped with k-means over their keywords and each group is shown with its most representative terms. Pdfs without keywords are skipped.",
+		FlagSet:    topicsFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 || *topicsCount < 1 {
+				return flag.ErrHelp
+			}
+			if err := topics(*topicsCount, *topicsTerms, os.Stdout); err != nil {
+				return fmt.Errorf("failed to find topics: %w", err)
+			}
+			return nil
+		},
+	}
+
+	dupesFs := flag.NewFlagSet("dupesFlags", flag.ExitOnError)
+	dupesFuzzy := dupesFs.Bool("fuzzy", false, "Report also probable near duplicates, like different scans of the same book")
+	dupesDistance := dupesFs.Int("d", 3, "With -fuzzy, the maximum number of bits the fingerprints of near duplicates differ")
+	dupesCmd := &ffcli.Command{
+		Name:       "dupes",
+		ShortUsage: "dupes [flags]",
+		ShortHelp:  "Report duplicate pdfs",
+		LongHelp:   "Report duplicate pdfs. Pdfs with identical files are never added twice, this finds pdfs with the same text. Each group is compared against its first pdf.",
+		FlagSet:    dupesFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			distance := 0
+			if *dupesFuzzy {
+				distance = *dupesDistance
+			}
+			if err := dupes(distance, os.Stdout); err != nil {
+				return fmt.Errorf("failed to find duplicates: %w", err)
+			}
+			return nil
+		},
+	}
+
+	dbTrigramCmd := &ffcli.Command{
+		Name:       "trigram",
+		ShortUsage: "db trigram on|off",
+		ShortHelp:  "Enable or disable the trigram index",
+		LongHelp:   "Enable or disable the trigram index. The trigram index matches substrings of words, like malloc in xmalloc_impl, with search -substr. It takes about three times the space of the full text index.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+				return flag.ErrHelp
+			}
+			if err := enableTrigram(args[0] == "on"); err != nil {
+				return fmt.Errorf("failed to turn trigram index %s: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	tokenizerFs := flag.NewFlagSet("tokenizerFlags", flag.ExitOnError)
+	removeDiacritics := tokenizerFs.Int("remove-diacritics", 1, "0 keeps diacritics, 1 removes them from latin characters, 2 removes them also from characters with several diacritics")
+	separators := tokenizerFs.String("separators", "", "Additional characters that separate words")
+	tokenChars := tokenizerFs.String("tokenchars", "", "Additional characters that are part of words, like - for hyphenated words")
+	porter := tokenizerFs.Bool("porter", false, "Stem english words with the porter stemmer, so that computers matches computing")
+	dbTokenizerCmd := &ffcli.Command{
+		Name:       "tokenizer",
+		ShortUsage: "db tokenizer [flags]",
+		ShortHelp:  "Show or change the tokenizer of the full text index",
+		LongHelp:   "Show or change the tokenizer of the full text index. Without flags it shows the current tokenizer. With flags it recreates the full text index with a unicode61 tokenizer with these options, optionally wrapped by the porter stemmer, and rebuilds it, which is instant for a new database. Check https://www.sqlite.org/fts5.html#tokenizers for details.",
+		FlagSet:    tokenizerFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			if tokenizerFs.NFlag() == 0 {
+				t, err := tokenizer()
+				if err != nil {
+					return fmt.Errorf("failed to get tokenizer: %w", err)
+				}
+				if t == "" {
+					t = "unicode61"
+				}
+				fmt.Println(t)
+				return nil
+			}
+			if *removeDiacritics < 0 || *removeDiacritics > 2 {
+				return flag.ErrHelp
+			}
+			opts := tokenizerOptions{
+				porter:           *porter,
+				removeDiacritics: *removeDiacritics,
+				separators:       *separators,
+				tokenChars:       *tokenChars,
+			}
+			if err := retokenize(opts.String()); err != nil {
+				return fmt.Errorf("failed to change tokenizer: %w", err)
+			}
+			return nil
+		},
+	}
+
+	dbBackupCmd := &ffcli.Command{
+		Name:       "backup",
+		ShortUsage: "db backup path",
+		ShortHelp:  "Write a snapshot of the database to path",
+		LongHelp:   "Write a snapshot of the database to path. The snapshot is consistent even if another booklice is adding pdfs at the same time. Path must not exist.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			if err := backupDatabase(args[0]); err != nil {
+				return fmt.Errorf("failed to backup to %q: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	dbRestoreCmd := &ffcli.Command{
+		Name:       "restore",
+		ShortUsage: "db restore path",
+		ShortHelp:  "Replace the database with the backup at path",
+		LongHelp:   "Replace the database with the backup at path. The backup must pass the integrity checks of sqlite3 and of the full text index. The replaced database is kept with the extension .bak.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			if err := restoreDatabase(args[0]); err != nil {
+				return fmt.Errorf("failed to restore from %q: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	dbCheckCmd := &ffcli.Command{
+		Name:       "check",
+		ShortUsage: "db check",
+		ShortHelp:  "Check the integrity of the database",
+		LongHelp:   "Check the integrity of the database and of the full text indexes. Report pdfs missing from the indexes and index entries without a pdf.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			return checkDatabase(os.Stdout)
 		},
 	}
 
-	addCmd := &ffcli.Command{
-		Name:       "add",
-		ShortUsage: "add paths...",
-		ShortHelp:  "Add adds the pdfs at paths to the index",
-		LongHelp:   "Add adds the pdfs at paths to the index. If path is a directory, it walks in it and adds all pdfs found.",
+	dbEncryptCmd := &ffcli.Command{
+		Name:       "encrypt",
+		ShortUsage: "db encrypt",
+		ShortHelp:  "Encrypt the pdfs added without a key",
+		LongHelp:   "Encrypt, with the key given with -k, the text and the covers of the pdfs added without a key. Pdfs added with -k are already encrypted. The fields left in plaintext are listed in the help of -k.",
 		Exec: func(ctx context.Context, args []string) error {
-			if len(args) == 0 {
+			if len(args) != 0 {
 				return flag.ErrHelp
 			}
-			for _, path := range args {
-				if err := addPath(path); err != nil {
-					return fmt.Errorf("failed to add path %q: %w", path, err)
-				}
+			return encryptDatabase(os.Stdout)
+		},
+	}
+
+	packCmd := &ffcli.Command{
+		Name:       "pack",
+		ShortUsage: "pack out.tar.gz",
+		ShortHelp:  "Write the database and the covers to an archive",
+		LongHelp:   "Write the database and the covers stored as files to a new gzipped tar archive, to move the index to another machine with unpack. The pdf files are not included.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			if err := pack(args[0]); err != nil {
+				return fmt.Errorf("failed to pack to %q: %w", args[0], err)
 			}
 			return nil
 		},
 	}
 
-	coverFs := flag.NewFlagSet("coverFlags", flag.ExitOnError)
-	coverViewer := coverFs.String("v", "evince", "the pdf viewer to use. Must be on PATH")
-	coverCmd := &ffcli.Command{
-		Name:       "cover",
-		ShortUsage: "cover [flags] name",
-		ShortHelp:  "Show cover of pdf by id",
-		LongHelp:   "Show cover of pdf by id.",
-		FlagSet:    coverFs,
+	unpackCmd := &ffcli.Command{
+		Name:       "unpack",
+		ShortUsage: "unpack in.tar.gz",
+		ShortHelp:  "Replace the database with the one in an archive",
+		LongHelp:   "Replace the database with the one in an archive written by pack, like db restore does. The covers in the archive are stored in the user cache dir.",
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) != 1 {
 				return flag.ErrHelp
 			}
-			id, err := strconv.Atoi(args[0])
-			if err != nil {
+			if err := unpack(args[0]); err != nil {
+				return fmt.Errorf("failed to unpack %q: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	historyFs := flag.NewFlagSet("historyFlags", flag.ExitOnError)
+	historyCount := historyFs.Int("n", 20, "Show at most n events")
+	historySince := historyFs.String("since", "", "Show events on or after the date, like 2024-01-01")
+	historyCmd := &ffcli.Command{
+		Name:       "history",
+		ShortUsage: "history [flags]",
+		ShortHelp:  "Show the latest changes to the database",
+		LongHelp:   "Show the latest changes to the database: pdfs added, removed, restored from the trash and deleted, with the time and the machine of each change.",
+		FlagSet:    historyFs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
 				return flag.ErrHelp
 			}
-			if err := showCover(id, *coverViewer); err != nil {
-				return fmt.Errorf("failed to display doc %d: %w", id, err)
+			since, err := newDateRange(*historySince, "")
+			if err != nil {
+				return err
 			}
-			return nil
+			return history(*historyCount, since.since, os.Stdout)
 		},
 	}
 
-	searchFs := flag.NewFlagSet("searchFlags", flag.ExitOnError)
-	matchInBold := searchFs.Bool("b", true, "Show matches in bold. Needs ANSI terminal")
-	docsToFetch := searchFs.Int("n", 10, "Fetch at most n documents")
-	namesOnly := searchFs.Bool("t", false, "Show pdf names only")
-	searchCmd := &ffcli.Command{
+	historySearchFs := flag.NewFlagSet("historySearchFlags", flag.ExitOnError)
+	historySearchCount := historySearchFs.Int("n", 20, "Show at most n searches")
+	historySearchCmd := &ffcli.Command{
 		Name:       "search",
-		ShortUsage: "search [flags] query",
-		ShortHelp:  "Search pdfs for terms",
-		LongHelp:   "Search pdfs for terms. Check https://www.sqlite.org/fts5.html for query details. For each document display the id to be used with cover, the path of the file and the snippet with the term",
-		FlagSet:    searchFs,
+		ShortUsage: "history search [flags]",
+		ShortHelp:  "Show the latest searches",
+		LongHelp:   "Show the latest searches, the latest first. Each is numbered for search -last, for example search -last 2 -n 50 runs the second latest search again for 50 pdfs.",
+		FlagSet:    historySearchFs,
 		Exec: func(ctx context.Context, args []string) error {
-			if len(args) != 1 {
+			if len(args) != 0 {
 				return flag.ErrHelp
 			}
-			query := args[0]
-			if err := search(query, *docsToFetch, *namesOnly, os.Stdout, *matchInBold); err != nil {
-				return fmt.Errorf("failed to search for %q: %w", query, err)
-			}
-			return nil
+			return searchHistory(*historySearchCount, os.Stdout)
 		},
 	}
+	historyCmd.Subcommands = []*ffcli.Command{historySearchCmd}
 
-	listFs := flag.NewFlagSet("listFlags", flag.ExitOnError)
-	listCmd := &ffcli.Command{
-		Name:       "list",
-		ShortUsage: "list [flags] expr..",
-		ShortHelp:  "List pdfs for paths matching sql like expressions",
-		LongHelp:   "List pdfs for paths matching sql like expressions",
-		FlagSet:    listFs,
+	serveFs := flag.NewFlagSet("serveFlags", flag.ExitOnError)
+	serveListen := serveFs.String("listen", "localhost:8080", "The address to listen on, or unix:path for a unix socket. Ignored if systemd passes a socket")
+	serveAnnounce := serveFs.String("announce", "", "The url of the server for browsers, like http://nas:8080, with the base path if any. Defaults to http://listen/base-path, or https://listen/base-path with -tls-cert")
+	serveBasePath := serveFs.String("base-path", "", "The path the server is served under by a reverse proxy, like /booklice/. The proxy must pass the path unchanged")
+	serveResolve := serveFs.String("resolve", "", "The url prefix of the pdf files, like http://nas/pdfs. The path of a pdf is appended to it. Defaults to /doc/{id} of the server")
+	serveReadTimeout := serveFs.Duration("read-timeout", 10*time.Second, "The time to read a request")
+	serveWriteTimeout := serveFs.Duration("write-timeout", time.Minute, "The time to write a response")
+	serveQueryTimeout := serveFs.Duration("query-timeout", 10*time.Second, "The time the queries of a request may take before it fails with 504 Gateway Timeout. 0 for no limit")
+	serveRate := serveFs.Float64("rate", 0, "The requests per second each client may make, 0 for no limit. Clients over it get 429 Too Many Requests")
+	serveBurst := serveFs.Int("burst", 20, "The requests a client may make at once with -rate")
+	serveMaxExpensive := serveFs.Int("max-expensive", 2, "The most expensive operations, like rendering old pdf covers and uploads, that run at once")
+	serveCORS := serveFs.String("cors", "", "The origins, comma separated, of the pages that may call the json api, like https://app.example.com, or * for any")
+	serveAccessLog := serveFs.String("access-log", "", "The file to log the requests to, a json object per line, or - for stderr")
+	serveTemplates := serveFs.String("templates", "", "A dir with .tmpl files that replace the templates of the web ui with the same names, and a static dir with files, like style.css, that replace its static files")
+	serveFeedSize := serveFs.Int("feed", 20, "The number of pdfs in the feed of the pdfs added last, /feed.xml")
+	serveReadOnly := serveFs.Bool("readonly", false, "Open the database read-only, to serve guests while another process adds the pdfs. Excludes -upload-dir")
+	serveUploadDir := serveFs.String("upload-dir", "", "Accept pdfs uploaded at /upload, save them in this dir and add them to the index. Raise -read-timeout for large pdfs")
+	servePDFjs := serveFs.String("pdfjs", "", "The dir of a pdf.js distribution, with web/viewer.html, to read the pdfs at /read/{id} with. Defaults to the pdf viewer of the browser")
+	serveTLSCert := serveFs.String("tls-cert", "", "The file of the certificate, with any intermediates, to serve https. Needs -tls-key")
+	serveTLSKey := serveFs.String("tls-key", "", "The file of the private key of -tls-cert")
+	serveCmd := &ffcli.Command{
+		Name:       "serve",
+		ShortUsage: "serve [flags]",
+		ShortHelp:  "Serve search over http",
+		LongHelp:   "Serve search over http. Browsers can add it as a search engine with OpenSearch. The server stops on SIGTERM or SIGINT after the requests in flight finish.",
+		FlagSet:    serveFs,
 		Exec: func(ctx context.Context, args []string) error {
-			for _, expr := range args {
-				if err := list(expr, os.Stdout); err != nil {
-					return fmt.Errorf("failed to list for %q: %w", expr, err)
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			if (*serveTLSCert == "") != (*serveTLSKey == "") {
+				return errors.New("-tls-cert and -tls-key go together")
+			}
+			if *serveReadOnly && *serveUploadDir != "" {
+				return errors.New("-readonly can't accept uploads, drop -upload-dir")
+			}
+			if *serveFeedSize < 1 {
+				return errors.New("-feed must be at least 1")
+			}
+			if *serveRate < 0 || *serveBurst < 1 || *serveMaxExpensive < 1 {
+				return errors.New("-rate must not be negative and -burst and -max-expensive must be at least 1")
+			}
+			basePath := strings.TrimSuffix(*serveBasePath, "/")
+			if basePath != "" && !strings.HasPrefix(basePath, "/") {
+				return errors.New("-base-path must start with /")
+			}
+			announce := *serveAnnounce
+			if announce == "" && (strings.HasPrefix(*serveListen, "unix:") || socketActivated()) {
+				return errors.New("-announce is needed to listen on a unix socket or a socket of systemd")
+			} else if announce == "" && *serveTLSCert != "" {
+				announce = "https://" + *serveListen + basePath
+			} else if announce == "" {
+				announce = "http://" + *serveListen + basePath
+			}
+			s := &server{announce: strings.TrimSuffix(announce, "/"), basePath: basePath, resolve: *serveResolve, feedSize: *serveFeedSize, queryTimeout: *serveQueryTimeout}
+			s.expensive = make(chan struct{}, *serveMaxExpensive)
+			if err := s.loadTemplates(*serveTemplates); err != nil {
+				return fmt.Errorf("can't load the templates: %w", err)
+			}
+			switch *serveAccessLog {
+			case "":
+			case "-":
+				s.accessLog = newAccessLog(os.Stderr)
+			default:
+				f, err := os.OpenFile(*serveAccessLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+				if err != nil {
+					return err
 				}
+				defer f.Close()
+				s.accessLog = newAccessLog(f)
 			}
-			return nil
+			for _, o := range strings.Split(*serveCORS, ",") {
+				if o = strings.TrimSuffix(strings.TrimSpace(o), "/"); o != "" {
+					s.corsOrigins = append(s.corsOrigins, o)
+				}
+			}
+			if *serveRate > 0 {
+				s.limiter = newRateLimiter(*serveRate, *serveBurst)
+			}
+			if *servePDFjs != "" {
+				if _, err := os.Stat(filepath.Join(*servePDFjs, "web", "viewer.html")); err != nil {
+					return fmt.Errorf("no pdf.js viewer in %s: %w", *servePDFjs, err)
+				}
+				s.pdfjs = *servePDFjs
+			}
+			if *serveUploadDir != "" {
+				dir, err := filepath.Abs(*serveUploadDir)
+				if err != nil {
+					return err
+				}
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					return err
+				}
+				pdfOrigin = "upload"
+				s.uploads = newUploads(dir)
+			}
+			opts := serveOptions{
+				listen:       *serveListen,
+				readTimeout:  *serveReadTimeout,
+				writeTimeout: *serveWriteTimeout,
+				tlsCert:      *serveTLSCert,
+				tlsKey:       *serveTLSKey,
+			}
+			return serve(ctx, s, opts)
+		},
+	}
+
+	dbCmd := &ffcli.Command{
+		Name:        "db",
+		ShortUsage:  "db subcommand [flags] <arguments>...",
+		ShortHelp:   "Manage the database",
+		LongHelp:    "Manage the database.",
+		Subcommands: []*ffcli.Command{dbTrigramCmd, dbTokenizerCmd, dbBackupCmd, dbRestoreCmd, dbCheckCmd, dbEncryptCmd},
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
 		},
 	}
 
-	rootCmd.Subcommands = []*ffcli.Command{addCmd, coverCmd, searchCmd, listCmd}
+	rootCmd.Subcommands = []*ffcli.Command{addCmd, importCalibreCmd, importZoteroCmd, importOPDSCmd, ingestMailCmd, exportZoteroCmd, exportSiteCmd, exportMarkdownCmd, exportTextCmd, syncCmd, relocateCmd, removeCmd, trashCmd, coverCmd, openCmd, searchCmd, listCmd, infoCmd, similarCmd, grepCmd, suggestCmd, saveCmd, topicsCmd, dupesCmd, historyCmd, serveCmd, mcpCmd, apiCmd, packCmd, unpackCmd, dbCmd}
 
 	if err := rootCmd.Parse(os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
+	readOnly = *serveReadOnly
 
 	if p, err := exec.LookPath(*gsName); err != nil {
 		log.Fatal(err)
@@ -135,12 +1319,23 @@ func main() {
 		gsExe = p
 	}
 
-	dbPath, err := pathFromName(*dbName)
-	if err != nil {
-		log.Fatal(err)
+	if *keyFile != "" {
+		if err := loadKey(*keyFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var dbPaths []string
+	for _, name := range strings.Split(*dbName, ",") {
+		p, err := pathFromName(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbPaths = append(dbPaths, p)
 	}
 
-	openDatabase(dbPath)
+	attachLibraries(dbPaths[1:])
+	openDatabase(dbPaths[0])
 	defer closeDatabase()
 
 	if err := rootCmd.Run(context.Background()); err != nil {
@@ -150,12 +1345,35 @@ func main() {
 
 // addPDF add the pdf file to the index
 func addPDF(path string) error {
+	return addPDFMeta(path, pdfMeta{})
+}
+
+// pdfMeta is what is known about a pdf from elsewhere, like a Calibre library. It
+// replaces what is guessed from the pdf.
+type pdfMeta struct {
+	title   string
+	authors string   // like Knuth, Donald E. & Patashnik, Oren
+	tags    []string // added before the keywords
+	cover   []byte   // a jpeg or png image of any size
+}
+
+// addPDFMeta adds the pdf file to the index with meta
+func addPDFMeta(path string, meta pdfMeta) error {
 	if !strings.HasSuffix(path, ".pdf") && !strings.HasSuffix(path, ".PDF") {
 		return nil
 	}
+	annex, err := annexKey(path)
+	if errors.Is(err, errAnnexMissing) {
+		log.Printf("Skipping %s: %v", path, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", path, err)
+	}
 
 	var (
-		contents, cover                         []byte
+		contents                                []string
+		cover                                   []byte
 		pages                                   int
 		sig                                     string
 		contentsErr, coverErr, pagesErr, sigErr error
@@ -169,11 +1387,30 @@ func addPDF(path string) error {
 	if sigErr != nil {
 		return sigErr
 	}
-	var exists int
-	if err := existsStmt.QueryRow(sig).Scan(&exists); err != nil {
+	var exists, trashed int
+	if err := existsStmt.QueryRow(sig).Scan(&exists, &trashed); err != nil {
 		return fmt.Errorf("failed to check existence %q: %w", path, err)
 	}
+	if trashed > 0 {
+		var id int
+		if err := db.QueryRow(trashedSigSQL, sig).Scan(&id); err != nil {
+			return fmt.Errorf("failed to restore %q from trash: %w", path, err)
+		}
+		if err := restorePDFs([]int{id}); err != nil {
+			return fmt.Errorf("failed to restore %q from trash: %w", path, err)
+		}
+		log.Printf("Restored from trash: %s", path)
+		return nil
+	}
 	if exists > 0 {
+		if storeOriginals {
+			// pdfs added before the files were stored
+			var id int
+			if err := db.QueryRow(sigIDSQL, sig).Scan(&id); err != nil {
+				return err
+			}
+			return storeOriginal(db, id, path)
+		}
 		log.Printf("Duplicate: %s", path)
 		return nil
 	}
@@ -208,91 +1445,407 @@ func addPDF(path string) error {
 		return pagesErr
 	}
 
-	_, err = insertStmt.Exec(path, pages, sig, contents, cover, time.Now())
-	return err
-}
+	var titleRaw string
+	if len(contents) > 0 {
+		titleRaw = guessTitle(contents[0])
+	}
+	title := normalizeTitle(titleRaw)
+	if meta.title != "" {
+		title = meta.title
+	}
+	contents = dehyphenate(cleanPages(contents))
+	text := joinPages(contents)
+	abstract := findAbstract(contents)
+	isbn := findISBNs(contents)
+	toc := findTOC(contents)
+	kws, err := keywords(text)
+	if err != nil {
+		return fmt.Errorf("failed to compute keywords of %q: %w", path, err)
+	}
+	kws = tagKeywords(meta.tags, kws)
+	if meta.cover != nil {
+		if thumb, err := thumbnail(meta.cover); err == nil {
+			cover = thumb
+		} else {
+			log.Printf("can't read the cover of %s, using its first page: %v", path, err)
+		}
+	}
 
-// showCover displays the cover of pdf with id. The viewer must be on $PATH
-func showCover(id int, viewer string) error {
-	var res sql.RawBytes
+	ext := coverExt(cover)
+	if cover, err = seal(cover); err != nil {
+		return fmt.Errorf("failed to encrypt cover of %q: %w", path, err)
+	}
+
+	var coverPath string
+	if coversDir != "" {
+		coverPath = filepath.Join(coversDir, sig+ext)
+		if err := os.WriteFile(coverPath, cover, 0644); err != nil {
+			return fmt.Errorf("failed to store cover of %q: %w", path, err)
+		}
+		cover = nil
+	}
+	var hash sql.NullString
+	if cover != nil {
+		hash.String, hash.Valid = coverHash(cover), true
+	}
+
+	var fingerprint sql.NullInt64
+	fingerprint.Int64, fingerprint.Valid = simhash(text)
+
+	var original string
+	if storeOriginals {
+		original = path
+	}
+
+	if err := insertPDF(hash.String, cover, original, path, pages, sig, text, hash, formatTimestamp(time.Now()), title, titleRaw, abstract, kws, isbn, fingerprint, toc, coverPath, pdfOrigin, sql.NullString{String: meta.authors, Valid: meta.authors != ""}, sql.NullString{String: annex, Valid: annex != ""}); err != nil {
+		if coverPath != "" {
+			os.Remove(coverPath)
+		}
+		return err
+	}
+	return nil
+}
 
-	rows, err := coverStmt.Query(id)
+// insertPDF inserts a pdf with the args of insertSQL and records its addition in the same
+// transaction, so that the history never misses a pdf or lists one that was not added.
+// If hash is not empty, the cover is stored with it, unless an identical one is stored.
+// If original is not empty, the file at it is stored as the original of the pdf.
+func insertPDF(hash string, cover []byte, original string, args ...interface{}) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	if !rows.Next() {
-		return fmt.Errorf("pdf with id %d not found", id)
+	if hash != "" {
+		if _, err := tx.Exec(insertCoverSQL, hash, cover); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.Stmt(insertStmt).Exec(args...)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if original != "" {
+		if err := storeOriginal(tx, int(id), original); err != nil {
+			return err
+		}
+	}
+	if err := recordEvent(tx, "add", int(id)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
 	}
+	runHook("on-add", int(id))
+	return nil
+}
 
-	if err := rows.Scan(&res); err != nil {
+// showCover displays the cover of pdf with id. The viewer must be on $PATH.
+// If viewer is empty, a default viewer for the type of the cover is used.
+func showCover(id int, viewer string) error {
+	data, coverPath, err := loadCover(context.Background(), id)
+	if err != nil {
 		return err
 	}
+	if coverPath != "" {
+		return view(coverPath, viewer)
+	}
 
-	fout, err := os.CreateTemp("", progName+"-*.pdf")
+	ext := coverExt(data)
+
+	fout, err := os.CreateTemp("", progName+"-*"+ext)
 	if err != nil {
 		return err
 	}
 	defer fout.Close()
 	defer os.Remove(fout.Name())
 
-	if _, err := fout.Write(res); err != nil {
+	if _, err := fout.Write(data); err != nil {
 		return err
 	}
+	return view(fout.Name(), viewer)
+}
+
+// errNotFound is wrapped by the errors for pdfs missing from the db
+var errNotFound = errors.New("not found")
+
+// loadCover returns the cover of the pdf with id, decrypted. If the cover is a plaintext
+// file, its path is returned too.
+func loadCover(ctx context.Context, id int) ([]byte, string, error) {
+	var (
+		res       sql.RawBytes
+		coverPath string
+	)
+
+	rows, err := coverStmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, "", fmt.Errorf("pdf with id %d %w", id, errNotFound)
+	}
+
+	if err := rows.Scan(&res, &coverPath); err != nil {
+		return nil, "", err
+	}
+
+	data := []byte(res)
+	if coverPath != "" {
+		if data, err = os.ReadFile(coverPath); err != nil {
+			return nil, "", err
+		}
+		if !isSealed(data) {
+			return data, coverPath, nil
+		}
+	}
+	data, err = unseal(data)
+	return data, "", err
+}
 
+// view displays the file at path with viewer. If viewer is empty, a default viewer
+// for the type of the file is used
+func view(path, viewer string) error {
+	if viewer == "" {
+		viewer = defaultViewers[filepath.Ext(path)]
+	}
 	vpath, err := exec.LookPath(viewer)
 	if err != nil {
 		return err
 	}
-	return exec.Command(vpath, fout.Name()).Run()
+	return exec.Command(vpath, path).Run()
+}
+
+// pageOffset returns the offset of the search results for the -offset and -page flags
+func pageOffset(offset, page, docsToFetch int) (int, error) {
+	switch {
+	case offset < 0:
+		return 0, errors.New("-offset must not be negative")
+	case page < 0:
+		return 0, errors.New("-page starts from 1")
+	case page > 0 && offset > 0:
+		return 0, errors.New("use either -offset or -page")
+	case page > 0:
+		return (page - 1) * docsToFetch, nil
+	}
+	return offset, nil
 }
 
-// search queries the index for pdfs, fetches at most docsToFetch and writes snippets to w
-// If w is an ANSI terminal use matchInBold to display the matched term in bold
-func search(query string, docsToFetch int, namesOnly bool, w io.Writer, matchInBold bool) error {
-	rows, err := searchStmt.Query(query, docsToFetch)
+// searchOptions are the page of the results search fetches and the size of their snippets
+type searchOptions struct {
+	limit, offset int
+	tokens        int  // the tokens of a snippet, at most 64
+	paragraph     bool // show the paragraph of the first match in the text instead of the snippet
+	snippets      int  // show snippets from up to that many pages of the text, if more than 1
+}
+
+// args returns the named parameters of searchOptions for searchSQL
+func (o searchOptions) args() []interface{} {
+	return []interface{}{sql.Named("limit", o.limit), sql.Named("offset", o.offset), sql.Named("tokens", o.tokens), sql.Named("highlight", o.paragraph || o.snippets > 1)}
+}
+
+// searchCount returns the number of pdfs selected by f that countSQL, like searchCountSQL,
+// finds for query
+func searchCount(ctx context.Context, countSQL, query string, f filter) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, countSQL, append([]interface{}{sql.Named("query", query)}, f.args()...)...).Scan(&n)
+	return n, err
+}
+
+// search queries the index for pdfs selected by f, fetches the page of opts, writes them
+// to w in format and returns them
+func search(ctx context.Context, stmt *sql.Stmt, query string, opts searchOptions, f filter, w io.Writer, format resultFormat) ([]searchResult, error) {
+	args := append([]interface{}{sql.Named("query", query)}, opts.args()...)
+	rows, err := stmt.QueryContext(ctx, append(args, f.args()...)...)
 	if err != nil {
-		return fmt.Errorf("search for %q failed: %w", query, err)
+		return nil, fmt.Errorf("search for %q failed: %w", query, err)
 	}
 	defer rows.Close()
 
-	repl := strings.NewReplacer("{{{", "\033[1m", "}}}", "\033[0m")
+	rw := newResultWriter(w, format)
+	var results []searchResult
 	for rows.Next() {
 		var (
-			id      int
-			name    string
-			pages   int
-			snippet string
+			r                searchResult
+			snippet, context string
 		)
-		if err := rows.Scan(&id, &name, &pages, &snippet); err != nil {
-			return fmt.Errorf("search for %q failed, can't scan row: %w", query, err)
+		if err := rows.Scan(&r.Library, &r.ID, &r.Path, &r.Pages, &r.Title, &r.Rank, &snippet, &context); err != nil {
+			return nil, fmt.Errorf("search for %q failed, can't scan row: %w", query, err)
 		}
-
-		if namesOnly {
-			fmt.Fprintf(w, "[%d] %s (#%d)\n", id, name, pages)
-		} else {
-			if matchInBold {
-				snippet = repl.Replace(snippet)
+		if opts.paragraph {
+			if p := paragraph(context); p != "" {
+				snippet = p
 			}
-			fmt.Fprintf(w, "[%d] %s (#%d)\n%s\n\n", id, name, pages, snippet)
+		} else if opts.snippets > 1 {
+			if s := pageSnippets(context, opts.snippets, opts.tokens); s != "" {
+				snippet = s
+			}
+		}
+		r.Snippet, r.Matches = parseSnippet(snippet)
+		results = append(results, r)
+		if err := rw.search(r); err != nil {
+			return nil, err
 		}
 	}
 	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("search for %q failed, can't fetch rows: %w", query, err)
+		return nil, fmt.Errorf("search for %q failed, can't fetch rows: %w", query, err)
 	}
 
-	return nil
+	return results, rw.flush()
+}
+
+// listEntry is a pdf listed by list
+type listEntry struct {
+	id    int
+	name  string
+	pages int
+	kws   string
+	title string
+	isbn  string
+}
+
+// write writes the entry to w, each line prefixed with indent
+func (e listEntry) write(w io.Writer, indent string, showKeywords bool) {
+	fmt.Fprintf(w, "%s[%d] %s (#%d)\n", indent, e.id, e.name, e.pages)
+	if showKeywords {
+		fmt.Fprintf(w, "%s    %s\n", indent, e.kws)
+	}
 }
 
-// list queries the index for pdfs with paths matching (sql like) expression
-func list(expr string, w io.Writer) error {
-	rows, err := listStmt.Query(expr)
+// list queries the index for pdfs with paths matching (sql like) expression and writes
+// them to w in format. Only the pdfs selected by f, and matching the fts query match if
+// not empty, are listed. If group is set, volumes and editions of the same work are listed
+// together.
+func list(expr, match string, f filter, w io.Writer, format resultFormat, group bool) error {
+	rows, err := listStmt.Query(append([]interface{}{sql.Named("expr", expr), sql.Named("match", match)}, f.args()...)...)
 	if err != nil {
 		return fmt.Errorf("like for %q failed: %w", expr, err)
 	}
 	defer rows.Close()
 
+	rw := newResultWriter(w, format)
+	var entries []listEntry
+	for rows.Next() {
+		var e listEntry
+		if err := rows.Scan(&e.id, &e.name, &e.pages, &e.kws, &e.title, &e.isbn); err != nil {
+			return fmt.Errorf("list for %q failed, can't scan row: %w", expr, err)
+		}
+
+		if group {
+			entries = append(entries, e)
+		} else if err := rw.list(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("list for %q failed, can't fetch rows: %w", expr, err)
+	}
+
+	if group {
+		writeGroups(w, groupSeries(entries), format.keywords)
+	}
+	return rw.flush()
+}
+
+// info writes the details of pdf with id to w
+func info(id int, w io.Writer) error {
+	var (
+		pages                                                         int
+		name, sig, addedAt, title, titleRaw, abstract, kws, isbn, toc string
+		deletedAt                                                     string
+		origin, authors, annex                                        string
+		stored                                                        bool
+	)
+	err := infoStmt.QueryRow(id).Scan(&id, &name, &pages, &sig, &addedAt, &title, &titleRaw, &abstract, &kws, &isbn, &toc, &deletedAt, &stored, &origin, &authors, &annex)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("pdf with id %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Id:        %d\n", id)
+	fmt.Fprintf(w, "Path:      %s\n", name)
+	if stored {
+		fmt.Fprintf(w, "Stored:    yes\n")
+	}
+	fmt.Fprintf(w, "Pages:     %d\n", pages)
+	fmt.Fprintf(w, "Title:     %s\n", title)
+	fmt.Fprintf(w, "Raw title: %s\n", titleRaw)
+	if authors != "" {
+		fmt.Fprintf(w, "Authors:   %s\n", authors)
+	}
+	fmt.Fprintf(w, "Signature: %s\n", sig)
+	if annex != "" {
+		fmt.Fprintf(w, "Annex key: %s\n", annex)
+	}
+	fmt.Fprintf(w, "Added at:  %s\n", addedAt)
+	if origin != "" {
+		fmt.Fprintf(w, "Origin:    %s\n", origin)
+	}
+	if deletedAt != "" {
+		fmt.Fprintf(w, "Trashed:   %s\n", deletedAt)
+	}
+	fmt.Fprintf(w, "Keywords:  %s\n", kws)
+	if isbn != "" {
+		fmt.Fprintf(w, "ISBN:      %s\n", isbn)
+	}
+	if toc != "" {
+		fmt.Fprintf(w, "Contents:\n")
+		for _, heading := range strings.Split(toc, "\n") {
+			fmt.Fprintf(w, "    %s\n", heading)
+		}
+	}
+	if abstract != "" {
+		fmt.Fprintf(w, "Abstract:  %s\n", abstract)
+	}
+	return nil
+}
+
+// similarQuery returns the query for the keywords of pdf with id, or "" if it has none
+func similarQuery(id int) (string, error) {
+	var kws, text string
+	err := termsStmt.QueryRow(id).Scan(&kws, &text)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("pdf with id %d not found", id)
+	}
+	if err != nil {
+		return "", err
+	}
+	if kws == "" {
+		// indexed before keywords were stored
+		if kws, err = keywords(text); err != nil {
+			return "", err
+		}
+	}
+
+	terms := strings.Fields(kws)
+	for i, t := range terms {
+		terms[i] = ftsQuote(t)
+	}
+	return strings.Join(terms, " OR "), nil
+}
+
+// similar writes to w at most docsToFetch pdfs that match best the keywords of pdf with id
+func similar(id int, docsToFetch int, w io.Writer) error {
+	query, err := similarQuery(id)
+	if err != nil || query == "" {
+		return err
+	}
+
+	rows, err := similarStmt.Query(query, id, docsToFetch)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
 		var (
 			id    int
@@ -300,18 +1853,23 @@ func list(expr string, w io.Writer) error {
 			pages int
 		)
 		if err := rows.Scan(&id, &name, &pages); err != nil {
-			return fmt.Errorf("list for %q failed, can't scan row: %w", expr, err)
+			return fmt.Errorf("similar failed, can't scan row: %w", err)
 		}
 
 		fmt.Fprintf(w, "[%d] %s (#%d)\n", id, name, pages)
 	}
 	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("list for %q failed, can't fetch rows: %w", expr, err)
+		return fmt.Errorf("similar failed, can't fetch rows: %w", err)
 	}
 
 	return nil
 }
 
+// ftsQuote quotes s as an fts5 string, to be matched literally
+func ftsQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
 // addPath adds the files at path to index. If path is a dir it is recursively scanned for pdfs.
 // During scanning dirs it just logs errors and continues to add as much files as possible.
 func addPath(path string) error {
@@ -331,6 +1889,10 @@ func scanFunc(path string, d fs.DirEntry, err error) error {
 		return nil
 	}
 	if d.IsDir() {
+		// git keeps the contents of annexed files under .git/annex/objects
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
 		return nil
 	}
 	if err := addPDF(path); err != nil {
@@ -340,6 +1902,43 @@ func scanFunc(path string, d fs.DirEntry, err error) error {
 	return nil
 }
 
+// parseIDs parses the pdf ids given as arguments
+func parseIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, flag.ErrHelp
+	}
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad id %q: %w", arg, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// userCoversDir returns the dir for storing the covers of the database as files in the
+// user's cache dir (see os.UserCacheDir). Each database has its own dir, so that removing
+// the covers of one never touches another. The dir is created if it does not exist.
+func userCoversDir() (string, error) {
+	cachePath, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(databasePath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+
+	dir := filepath.Join(cachePath, progName, "covers", fmt.Sprintf("%s-%x", libraryLabel(abs), sum[:4]))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
 // pathFromName returns a db path for name. If name contains a slash, it is returned as is,
 // otherwise a dir with this name is created in user's config dir (see os.UserConfigDir)
 func pathFromName(name string) (string, error) {
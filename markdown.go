@@ -0,0 +1,137 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// exportMarkdown writes to dir a Markdown file for each pdf that is not in the trash, with
+// its details in YAML front matter, for static site generators like Hugo and Jekyll. The
+// covers are written to coversDir, if not empty, and linked in the front matter with
+// coverURL and their names.
+func exportMarkdown(ctx context.Context, dir, coversDir, coverURL string) error {
+	for _, d := range []string{dir, coversDir} {
+		if d == "" {
+			continue
+		}
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+	docs, err := siteDocs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range docs {
+		var start string
+		if err := db.QueryRowContext(ctx, markdownTextSQL, d.ID).Scan(&start); err != nil {
+			return err
+		}
+		pages := strings.Split(start, pageSeparator)
+		if coversDir != "" {
+			if name, err := writeCover(ctx, coversDir, d.ID); err != nil {
+				log.Printf("cover error %d: %v", d.ID, err)
+			} else {
+				d.Cover = coverURL + name
+			}
+		}
+		md := markdownDoc(d, findYear(pages), findDOI(pages))
+		if err := os.WriteFile(filepath.Join(dir, markdownName(d)), []byte(md), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownName returns the name of the Markdown file of d, its id and the words of its
+// name, like 12-the-go-programming-language.md
+func markdownName(d siteDoc) string {
+	name := strings.TrimSuffix(d.Name(), filepath.Ext(d.Path))
+	slug := strings.Trim(nonAlnum.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if r := []rune(slug); len(r) > 60 {
+		slug = strings.TrimRight(string(r[:60]), "-")
+	}
+	if slug == "" {
+		return strconv.Itoa(d.ID) + ".md"
+	}
+	return strconv.Itoa(d.ID) + "-" + slug + ".md"
+}
+
+// markdownDoc returns the Markdown file of d: the front matter and the abstract and table
+// of contents as the content
+func markdownDoc(d siteDoc, year, doi string) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(d.Name()))
+	if authors := splitAuthors(d.Authors); len(authors) > 0 {
+		fmt.Fprintf(&b, "authors: %s\n", yamlList(authors))
+	}
+	fmt.Fprintf(&b, "tags: %s\n", yamlList(d.Keywords))
+	if year != "" {
+		fmt.Fprintf(&b, "year: %s\n", year)
+	}
+	fmt.Fprintf(&b, "date: %s\n", yamlString(d.AddedAt))
+	fmt.Fprintf(&b, "pages: %d\n", d.Pages)
+	if d.ISBN != "" {
+		fmt.Fprintf(&b, "isbn: %s\n", yamlList(strings.Fields(d.ISBN)))
+	}
+	if doi != "" {
+		fmt.Fprintf(&b, "doi: %s\n", yamlString(doi))
+	}
+	if d.Cover != "" {
+		fmt.Fprintf(&b, "cover: %s\n", yamlString(d.Cover))
+	}
+	fmt.Fprintf(&b, "booklice_id: %d\n", d.ID)
+	b.WriteString("---\n")
+	if abstract := strings.TrimSpace(d.Abstract); abstract != "" {
+		b.WriteString("\n" + abstract + "\n")
+	}
+	if len(d.TOC) > 0 {
+		b.WriteString("\n## Contents\n\n")
+		for _, line := range d.TOC {
+			if line = strings.TrimSpace(line); line != "" {
+				b.WriteString("- " + line + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// splitAuthors returns the authors of a pdf, separated by &
+func splitAuthors(authors string) []string {
+	var names []string
+	for _, a := range strings.Split(authors, "&") {
+		if a = strings.TrimSpace(a); a != "" {
+			names = append(names, a)
+		}
+	}
+	return names
+}
+
+// yamlString returns s quoted for YAML. JSON strings are YAML strings too.
+func yamlString(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// yamlList returns ss as a YAML flow sequence of strings
+func yamlList(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = yamlString(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+const markdownTextSQL = `SELECT substr(IFNULL(inflate(text), ''), 1, 20000) FROM pdfs WHERE id = ?`
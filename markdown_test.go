@@ -0,0 +1,69 @@
+//go:build fts5
+
+package main
+
+import "testing"
+
+func TestMarkdownName(t *testing.T) {
+	tests := []struct {
+		d    siteDoc
+		want string
+	}{
+		{siteDoc{ID: 12, Title: "The Go Programming Language"}, "12-the-go-programming-language.md"},
+		{siteDoc{ID: 3, Path: "/pdfs/Über Go (2nd ed).pdf"}, "3-über-go-2nd-ed.md"},
+		{siteDoc{ID: 4, Title: "C++"}, "4-c.md"},
+		{siteDoc{ID: 5, Title: "???"}, "5.md"},
+	}
+	for _, tt := range tests {
+		if got := markdownName(tt.d); got != tt.want {
+			t.Errorf("markdownName(%q) = %q, want %q", tt.d.Name(), got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownDoc(t *testing.T) {
+	tests := []struct {
+		d         siteDoc
+		year, doi string
+		want      string
+	}{
+		{
+			siteDoc{
+				ID: 7, Title: `Go: the "good" parts`, Authors: "Donovan, Alan & Kernighan, Brian", Pages: 380,
+				Keywords: []string{"go", "concurrency"}, ISBN: "9780134190440", Abstract: "A book about Go.\n",
+				TOC: []string{"1 Tutorial", "", "2 Program Structure"}, AddedAt: "2024-03-01T10:00:00Z", Cover: "/covers/7.jpg",
+			},
+			"2015", "10.1000/xyz",
+			"---\n" +
+				"title: \"Go: the \\\"good\\\" parts\"\n" +
+				"authors: [\"Donovan, Alan\", \"Kernighan, Brian\"]\n" +
+				"tags: [\"go\", \"concurrency\"]\n" +
+				"year: 2015\n" +
+				"date: \"2024-03-01T10:00:00Z\"\n" +
+				"pages: 380\n" +
+				"isbn: [\"9780134190440\"]\n" +
+				"doi: \"10.1000/xyz\"\n" +
+				"cover: \"/covers/7.jpg\"\n" +
+				"booklice_id: 7\n" +
+				"---\n" +
+				"\nA book about Go.\n" +
+				"\n## Contents\n\n- 1 Tutorial\n- 2 Program Structure\n",
+		},
+		{
+			siteDoc{ID: 8, Path: "/pdfs/notes.pdf", Pages: 2, AddedAt: "2024-03-02T10:00:00Z"},
+			"", "",
+			"---\n" +
+				"title: \"notes.pdf\"\n" +
+				"tags: []\n" +
+				"date: \"2024-03-02T10:00:00Z\"\n" +
+				"pages: 2\n" +
+				"booklice_id: 8\n" +
+				"---\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := markdownDoc(tt.d, tt.year, tt.doi); got != tt.want {
+			t.Errorf("markdownDoc(%d) = %q, want %q", tt.d.ID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+//go:build fts5
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+)
+
+const (
+	// mcpProtocolVersion is the version of the Model Context Protocol answered to clients
+	// that don't ask for one
+	mcpProtocolVersion = "2024-11-05"
+
+	// mcpMaxResults is the most results of the search tool
+	mcpMaxResults = 50
+
+	// mcpMaxPages is the most pages returned by the page_text tool at once
+	mcpMaxPages = 10
+)
+
+// mcpTool is a tool of the server, as listed by tools/list
+type mcpTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// mcpContent is the text of the result of a tool
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "search",
+		Description: "Search the full text of the pdfs of the library. The query is an SQLite fts5 query: words match all of them, \"quoted phrases\" match in sequence, OR, NOT, prefix* and NEAR(a b) work too. Returns the id, title, path, pages and a snippet of each pdf, the best first.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"the fts5 query"},"limit":{"type":"integer","description":"the most results, 10 if missing, at most 50"}},"required":["query"]}`),
+	},
+	{
+		Name:        "info",
+		Description: "Show the details of a pdf of the library by id: path, pages, title, authors, keywords, ISBNs, table of contents and abstract.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"id":{"type":"integer","description":"the id of the pdf"}},"required":["id"]}`),
+	},
+	{
+		Name:        "page_text",
+		Description: "Return the text of pages of a pdf of the library by id, to read what a search found. Pages start at 1.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"id":{"type":"integer","description":"the id of the pdf"},"page":{"type":"integer","description":"the first page"},"count":{"type":"integer","description":"the number of pages, 1 if missing, at most 10"}},"required":["id","page"]}`),
+	},
+}
+
+// serveMCP serves the tools of mcpTools over the Model Context Protocol, reading JSON-RPC
+// messages from r and writing the responses to w, one per line, until r ends
+func serveMCP(ctx context.Context, r io.Reader, w io.Writer) error {
+	return serveJSONRPC(ctx, r, w, handleMCP)
+}
+
+// handleMCP returns the result of the method called with params
+func handleMCP(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &p)
+		if p.ProtocolVersion == "" {
+			p.ProtocolVersion = mcpProtocolVersion
+		}
+		version := "(devel)"
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			version = bi.Main.Version
+		}
+		return map[string]interface{}{
+			"protocolVersion": p.ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": progName, "version": version},
+		}, nil
+	case "ping", "notifications/initialized", "notifications/cancelled":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.Arguments) == 0 {
+			p.Arguments = json.RawMessage("{}")
+		}
+		text, err := callMCPTool(ctx, p.Name, p.Arguments)
+		if errors.Is(err, errUnknownTool) {
+			return nil, err
+		}
+		if err != nil {
+			return mcpToolResult{Content: []mcpContent{{"text", err.Error()}}, IsError: true}, nil
+		}
+		return mcpToolResult{Content: []mcpContent{{"text", text}}}, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, "unknown method " + method}
+}
+
+// errUnknownTool is returned by callMCPTool for tools not in mcpTools
+var errUnknownTool = errors.New("unknown tool")
+
+// callMCPTool returns the text of the tool name called with args
+func callMCPTool(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	var a struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+		ID    int    `json:"id"`
+		Page  int    `json:"page"`
+		Count int    `json:"count"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("bad arguments: %w", err)
+	}
+	var buf bytes.Buffer
+	switch name {
+	case "search":
+		if strings.TrimSpace(a.Query) == "" {
+			return "", errors.New("missing query")
+		}
+		if a.Limit <= 0 {
+			a.Limit = 10
+		}
+		if a.Limit > mcpMaxResults {
+			a.Limit = mcpMaxResults
+		}
+		opts := searchOptions{limit: a.Limit, tokens: 32, snippets: 1}
+		results, err := search(ctx, searchStmt, a.Query, opts, filter{}, io.Discard, resultFormat{})
+		if err != nil {
+			return "", err
+		}
+		if len(results) == 0 {
+			return "no pdfs found", nil
+		}
+		for _, r := range results {
+			fmt.Fprintf(&buf, "[%d] %s\n%s, %d pages\n%s\n\n", r.ID, resultView{searchResult: r}.Name(), r.Path, r.Pages, strings.TrimSpace(r.Snippet))
+		}
+	case "info":
+		if err := info(a.ID, &buf); err != nil {
+			return "", err
+		}
+	case "page_text":
+		if a.Count <= 0 {
+			a.Count = 1
+		}
+		if a.Count > mcpMaxPages {
+			a.Count = mcpMaxPages
+		}
+		pages, err := pageTexts(a.ID)
+		if err != nil {
+			return "", err
+		}
+		if a.Page < 1 || a.Page > len(pages) {
+			return "", fmt.Errorf("pdf %d has pages 1 to %d", a.ID, len(pages))
+		}
+		for i := a.Page; i < a.Page+a.Count && i <= len(pages); i++ {
+			fmt.Fprintf(&buf, "--- page %d of %d ---\n%s\n", i, len(pages), strings.TrimSpace(pages[i-1]))
+		}
+	default:
+		return "", fmt.Errorf("%w %s", errUnknownTool, name)
+	}
+	return buf.String(), nil
+}
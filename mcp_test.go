@@ -0,0 +1,46 @@
+//go:build fts5
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestServeMCP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"ping"}`, `{"jsonrpc":"2.0","id":1,"result":{}}`},
+		{`{"jsonrpc":"2.0","method":"notifications/initialized"}`, ``},
+		{`{"jsonrpc":"2.0","id":"a","method":"resources/list"}`, `{"jsonrpc":"2.0","id":"a","error":{"code":-32601,"message":"unknown method resources/list"}}`},
+		{`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"rm"}}`, `{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"unknown tool rm"}}`},
+		{`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"search","arguments":{"query":" "}}}`, `{"jsonrpc":"2.0","id":3,"result":{"content":[{"type":"text","text":"missing query"}],"isError":true}}`},
+		{`{"id":4,"method":"ping"}`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`},
+		{`[1, 2]`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := serveMCP(context.Background(), strings.NewReader(tt.in+"\n"), &out); err != nil {
+			t.Errorf("serveMCP(%s) failed: %v", tt.in, err)
+			continue
+		}
+		if got := strings.TrimSpace(out.String()); got != tt.want {
+			t.Errorf("serveMCP(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	var out bytes.Buffer
+	in := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}` + "\n" + `{"jsonrpc":"2.0","id":2,"method":"tools/list"}` + "\n{bad"
+	if err := serveMCP(context.Background(), strings.NewReader(in), &out); err == nil {
+		t.Error("serveMCP() of bad json succeeded")
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"protocolVersion":"`+mcpProtocolVersion+`"`) ||
+		!strings.Contains(lines[1], `"name":"page_text"`) || !strings.Contains(lines[2], `"code":-32700`) {
+		t.Errorf("serveMCP() = %s", out.String())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets of the request durations
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey is a route and a status code
+type requestKey struct {
+	route string
+	code  int
+}
+
+// histogram counts durations in durationBuckets
+type histogram struct {
+	buckets []int64 // not cumulative, the last is +Inf
+	sum     float64
+	count   int64
+}
+
+// requestMetrics counts the requests and their durations by route, in the Prometheus
+// text format
+type requestMetrics struct {
+	route func(r *http.Request) string // the route of a request, like /pdf/
+
+	mu        sync.Mutex
+	requests  map[requestKey]int64
+	durations map[string]*histogram
+}
+
+func newRequestMetrics(route func(r *http.Request) string) *requestMetrics {
+	return &requestMetrics{route: route, requests: make(map[requestKey]int64), durations: make(map[string]*histogram)}
+}
+
+// measure counts the requests to h
+func (m *requestMetrics) measure(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		m.observe(m.route(r), sw.status, time.Since(start))
+	})
+}
+
+// observe counts a request to route that was answered with code after d
+func (m *requestMetrics) observe(route string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{route, code}]++
+	hist := m.durations[route]
+	if hist == nil {
+		hist = &histogram{buckets: make([]int64, len(durationBuckets)+1)}
+		m.durations[route] = hist
+	}
+	secs := d.Seconds()
+	hist.buckets[sort.SearchFloat64s(durationBuckets, secs)]++
+	hist.sum += secs
+	hist.count++
+}
+
+// write writes the metrics to w, sorted so that scrapes are easy to diff
+func (m *requestMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].code < keys[j].code
+	})
+	metricHeader(w, "booklice_http_requests_total", "counter", "The http requests served, by route and status code.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "booklice_http_requests_total{route=%s,code=\"%d\"} %d\n", labelValue(k.route), k.code, m.requests[k])
+	}
+
+	routes := make([]string, 0, len(m.durations))
+	for r := range m.durations {
+		routes = append(routes, r)
+	}
+	sort.Strings(routes)
+	metricHeader(w, "booklice_http_request_duration_seconds", "histogram", "The time to serve the http requests, by route.")
+	for _, r := range routes {
+		hist := m.durations[r]
+		var n int64
+		for i, le := range durationBuckets {
+			n += hist.buckets[i]
+			fmt.Fprintf(w, "booklice_http_request_duration_seconds_bucket{route=%s,le=\"%s\"} %d\n", labelValue(r), formatFloat(le), n)
+		}
+		fmt.Fprintf(w, "booklice_http_request_duration_seconds_bucket{route=%s,le=\"+Inf\"} %d\n", labelValue(r), hist.count)
+		fmt.Fprintf(w, "booklice_http_request_duration_seconds_sum{route=%s} %s\n", labelValue(r), formatFloat(hist.sum))
+		fmt.Fprintf(w, "booklice_http_request_duration_seconds_count{route=%s} %d\n", labelValue(r), hist.count)
+	}
+}
+
+// metricHeader writes the help and the type of the metric name
+func metricHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeMetric writes a metric without labels
+func writeMetric(w io.Writer, name, typ, help string, value float64) {
+	metricHeader(w, name, typ, help)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+// labelValue quotes s as the value of a label
+func labelValue(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	m := newRequestMetrics(func(r *http.Request) string { return r.URL.Path })
+	m.observe("/search", 200, 3*time.Millisecond)
+	m.observe("/search", 200, 300*time.Millisecond)
+	m.observe("/search", 504, 20*time.Second)
+	h := m.measure(http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", `/a"b`, nil))
+
+	var b bytes.Buffer
+	m.write(&b)
+	for _, want := range []string{
+		`booklice_http_requests_total{route="/a\"b",code="404"} 1`,
+		`booklice_http_requests_total{route="/search",code="200"} 2`,
+		`booklice_http_requests_total{route="/search",code="504"} 1`,
+		`booklice_http_request_duration_seconds_bucket{route="/search",le="0.005"} 1`,
+		`booklice_http_request_duration_seconds_bucket{route="/search",le="0.25"} 1`,
+		`booklice_http_request_duration_seconds_bucket{route="/search",le="0.5"} 2`,
+		`booklice_http_request_duration_seconds_bucket{route="/search",le="10"} 2`,
+		`booklice_http_request_duration_seconds_bucket{route="/search",le="+Inf"} 3`,
+		`booklice_http_request_duration_seconds_sum{route="/search"} 20.303`,
+		`booklice_http_request_duration_seconds_count{route="/search"} 3`,
+		"# TYPE booklice_http_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("no %s in\n%s", want, b.String())
+		}
+	}
+}
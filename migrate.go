@@ -0,0 +1,239 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations bring a database to the current schema. The version of a database is the
+// number of migrations applied to it, each in its own transaction. Never edit or reorder
+// a migration, append a new one instead.
+var migrations = []func(tx *sql.Tx) error{
+	migrateUnversioned,
+	execMigration(`ALTER TABLE pdfs ADD COLUMN cover_path TEXT`),
+	execMigration(compressTextSQL),
+	migrateTimestamps,
+	execMigration(`ALTER TABLE pdfs ADD COLUMN deleted_at TEXT`),
+	execMigration(eventsSQL),
+	// texts without terms were fingerprinted 0 and reported as duplicates of each other
+	execMigration(`UPDATE pdfs SET simhash = NULL WHERE simhash = 0`),
+	migrateCovers,
+	execMigration(originalsSQL),
+	execMigration(`ALTER TABLE pdfs ADD COLUMN origin TEXT`),
+	migrateFTSTitle,
+	execMigration(searchesSQL),
+	execMigration(savedSearchesTableSQL),
+	execMigration(`ALTER TABLE pdfs ADD COLUMN authors TEXT`),
+	execMigration(`ALTER TABLE pdfs ADD COLUMN annex_key TEXT`),
+	execMigration(ftsUpdateTriggerSQL),
+}
+
+// migrate applies to d the migrations it is missing. If the db is read-only, it fails
+// if there are any.
+func migrate(d *sql.DB) error {
+	if !readOnly {
+		if _, err := d.Exec(schemaVersionSQL); err != nil {
+			return err
+		}
+	}
+
+	var version int
+	if err := d.QueryRow(getVersionSQL).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than the supported %d", version, len(migrations))
+	}
+	if readOnly && version < len(migrations) {
+		return fmt.Errorf("database schema version %d is older than %d, open it once without -readonly to migrate it", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := d.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[version](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+		if _, err := tx.Exec(setVersionSQL, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execMigration returns a migration that executes statements
+func execMigration(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// migrateUnversioned creates the schema of version 1. Databases created before the
+// schema was versioned get the columns and the fts table they are missing.
+func migrateUnversioned(tx *sql.Tx) error {
+	if _, err := tx.Exec(schemaSQL); err != nil {
+		return err
+	}
+
+	columns := []struct{ name, decl string }{
+		{"title", "TEXT"},
+		{"title_raw", "TEXT"},
+		{"abstract", "TEXT"},
+		{"keywords", "TEXT"},
+		{"isbn", "TEXT"},
+		{"simhash", "INTEGER"},
+		{"toc", "TEXT"},
+	}
+	for _, c := range columns {
+		var exists int
+		if err := tx.QueryRow(columnExistsSQL, c.name).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE pdfs ADD COLUMN " + c.name + " " + c.decl); err != nil {
+			return err
+		}
+	}
+
+	// the fts table can't be altered, it is recreated and rebuilt from pdfs
+	var upToDate int
+	if err := tx.QueryRow(ftsColumnExistsSQL, "toc").Scan(&upToDate); err != nil {
+		return err
+	}
+	if upToDate == 0 {
+		if _, err := tx.Exec(dropFTSSQL); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaSQL); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(rebuildFTSSQL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTimestamps converts the timestamps stored by older versions to timestampLayout.
+// Timestamps that can't be parsed are kept as they are.
+func migrateTimestamps(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, added_at FROM pdfs WHERE added_at IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	converted := make(map[int]string)
+	for rows.Next() {
+		var (
+			id      int
+			addedAt string
+		)
+		if err := rows.Scan(&id, &addedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if t, err := parseLegacyTimestamp(addedAt); err == nil {
+			converted[id] = formatTimestamp(t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, addedAt := range converted {
+		if _, err := tx.Exec(`UPDATE pdfs SET added_at = ? WHERE id = ?`, addedAt, id); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS pdfs_added_at ON pdfs(added_at)`)
+	return err
+}
+
+const (
+	schemaVersionSQL = `CREATE TABLE IF NOT EXISTS schema_version(version INTEGER NOT NULL)`
+
+	getVersionSQL = `SELECT IFNULL(MAX(version), 0) FROM schema_version`
+
+	setVersionSQL = `DELETE FROM schema_version; INSERT INTO schema_version(version) VALUES(?)`
+
+	columnExistsSQL = `SELECT COUNT(*) FROM pragma_table_info('pdfs') WHERE name = ?`
+
+	ftsColumnExistsSQL = `SELECT COUNT(*) FROM pragma_table_info('pdfs_fts') WHERE name = ?`
+
+	rebuildFTSSQL = `INSERT INTO pdfs_fts(pdfs_fts) VALUES('rebuild')`
+
+	dropFTSSQL = `DROP TRIGGER IF EXISTS pdfs_ai;
+DROP TRIGGER IF EXISTS pdfs_ad;
+DROP TABLE IF EXISTS pdfs_fts;`
+)
+
+// migrateFTSTitle adds the title and the path of the pdfs to the full text index. The
+// index is recreated with the tokenizer it had.
+func migrateFTSTitle(tx *sql.Tx) error {
+	var def string
+	if err := tx.QueryRow(ftsDefinitionSQL).Scan(&def); err != nil {
+		return err
+	}
+	_, err := tx.Exec(dropFTSSQL + ftsTitleSQL + ftsTableDef(definedTokenizer(def)) + ";\n" + ftsTitleTriggersSQL + rebuildFTSSQL)
+	return err
+}
+
+const (
+	ftsTitleSQL = `
+DROP VIEW pdfs_text;
+
+CREATE VIEW pdfs_text AS SELECT id, inflate(text) AS text, abstract, keywords, toc, title, path FROM pdfs;
+
+`
+
+	ftsTitleTriggersSQL = `
+CREATE TRIGGER pdfs_ai AFTER INSERT ON pdfs BEGIN
+	INSERT INTO pdfs_fts(rowid, text, abstract, keywords, toc, title, path) VALUES (new.id, inflate(new.text), new.abstract, new.keywords, new.toc, new.title, new.path);
+END;
+
+CREATE TRIGGER pdfs_ad AFTER DELETE ON pdfs BEGIN
+	INSERT INTO pdfs_fts(pdfs_fts, rowid, text, abstract, keywords, toc, title, path) VALUES('delete', old.id, inflate(old.text), old.abstract, old.keywords, old.toc, old.title, old.path);
+END;
+
+`
+)
+
+// ftsUpdateTriggerSQL keeps the full text index in sync with updates of the indexed
+// columns, like the paths changed by relocate
+const ftsUpdateTriggerSQL = `
+CREATE TRIGGER pdfs_au AFTER UPDATE OF text, abstract, keywords, toc, title, path ON pdfs BEGIN
+	INSERT INTO pdfs_fts(pdfs_fts, rowid, text, abstract, keywords, toc, title, path) VALUES('delete', old.id, inflate(old.text), old.abstract, old.keywords, old.toc, old.title, old.path);
+	INSERT INTO pdfs_fts(rowid, text, abstract, keywords, toc, title, path) VALUES (new.id, inflate(new.text), new.abstract, new.keywords, new.toc, new.title, new.path);
+END;
+`
+
+// compressTextSQL compresses the stored texts. The fts table reads them uncompressed
+// from the view pdfs_text.
+const compressTextSQL = dropFTSSQL + `
+UPDATE pdfs SET text = deflate(text);
+
+CREATE VIEW pdfs_text AS SELECT id, inflate(text) AS text, abstract, keywords, toc FROM pdfs;
+
+CREATE VIRTUAL TABLE pdfs_fts USING fts5(text, abstract, keywords, toc, content=pdfs_text, content_rowid=id);
+
+CREATE TRIGGER pdfs_ai AFTER INSERT ON pdfs BEGIN
+	INSERT INTO pdfs_fts(rowid, text, abstract, keywords, toc) VALUES (new.id, inflate(new.text), new.abstract, new.keywords, new.toc);
+END;
+
+CREATE TRIGGER pdfs_ad AFTER DELETE ON pdfs BEGIN
+	INSERT INTO pdfs_fts(pdfs_fts, rowid, text, abstract, keywords, toc) VALUES('delete', old.id, inflate(old.text), old.abstract, old.keywords, old.toc);
+END;
+
+` + rebuildFTSSQL
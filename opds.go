@@ -0,0 +1,211 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// opdsPageSize is the number of pdfs in a page of an acquisition feed
+	opdsPageSize = 50
+
+	opdsNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+)
+
+// atomFeed is an Atom feed, as used by OPDS catalogs
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Authors []atomPerson `xml:"author"`
+	Updated string       `xml:"updated"`
+	Links   []atomLink   `xml:"link"`
+	Content *atomText    `xml:"content,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+// handleOPDSRoot writes the root catalog, that links to the recently added pdfs and search
+func (s *server) handleOPDSRoot(w http.ResponseWriter, r *http.Request) {
+	now := formatTimestamp(time.Now())
+	feed := s.opdsFeed("/opds", "booklice", now, opdsNavigationType)
+	feed.Entries = []atomEntry{{
+		ID:      s.announce + "/opds/new",
+		Title:   "Recently added",
+		Updated: now,
+		Links:   []atomLink{{Rel: "subsection", Href: s.announce + "/opds/new", Type: opdsAcquisitionType}},
+		Content: &atomText{Type: "text", Text: "The pdfs added last"},
+	}}
+	writeFeed(w, feed, opdsNavigationType)
+}
+
+// handleOPDSNew writes the pdfs added last, the newest first, in pages
+func (s *server) handleOPDSNew(w http.ResponseWriter, r *http.Request) {
+	page := webPage{Page: pageParam(r)}
+	if err := db.QueryRowContext(r.Context(), browseCountSQL, sql.Named("match", "")).Scan(&page.Total); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	rows, err := db.QueryContext(r.Context(), recentSQL, opdsPageSize, (page.Page-1)*opdsPageSize)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	feed := s.opdsFeed("/opds/new", "Recently added", formatTimestamp(time.Now()), opdsAcquisitionType)
+	for rows.Next() {
+		var (
+			res      searchResult
+			added    string
+			abstract string
+		)
+		if err := rows.Scan(&res.ID, &res.Path, &res.Pages, &res.Title, &added, &abstract); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		feed.Entries = append(feed.Entries, s.opdsEntry(res, added, abstract))
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	page.paginate(r, opdsPageSize)
+	s.pageLinks(&feed, page)
+	writeFeed(w, feed, opdsAcquisitionType)
+}
+
+// handleOPDSSearch writes the results of the query in the parameter q, in pages
+func (s *server) handleOPDSSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.FormValue("q"))
+	if query == "" {
+		http.Error(w, "missing query q", http.StatusBadRequest)
+		return
+	}
+	s.searches.Add(1)
+	page := webPage{Query: query, Page: pageParam(r)}
+	var err error
+	if page.Total, err = searchCount(r.Context(), searchCountSQL, query, filter{}); timedOut(r) {
+		serverError(w, r, err)
+		return
+	} else if err != nil {
+		http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := searchOptions{limit: opdsPageSize, offset: (page.Page - 1) * opdsPageSize, tokens: 16, snippets: 1}
+	results, err := search(r.Context(), searchStmt, query, opts, filter{}, io.Discard, resultFormat{})
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	now := formatTimestamp(time.Now())
+	feed := s.opdsFeed("/opds/search?q="+url.QueryEscape(query), "Search for "+query, now, opdsAcquisitionType)
+	for _, res := range results {
+		feed.Entries = append(feed.Entries, s.opdsEntry(res, now, strings.TrimSpace(res.Snippet)))
+	}
+	page.paginate(r, opdsPageSize)
+	s.pageLinks(&feed, page)
+	writeFeed(w, feed, opdsAcquisitionType)
+}
+
+// handleOPDSOpenSearch writes the OpenSearch description of the search of the catalog
+func (s *server) handleOPDSOpenSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	fmt.Fprintf(w, openSearchXML, html.EscapeString(s.announce+"/opds/search"), opdsAcquisitionType)
+}
+
+// opdsFeed returns a feed of the catalog at path, with the links every feed has
+func (s *server) opdsFeed(path, title, updated, typ string) atomFeed {
+	return atomFeed{
+		ID:      s.announce + path,
+		Title:   title,
+		Updated: updated,
+		Author:  atomPerson{Name: progName},
+		Links: []atomLink{
+			{Rel: "self", Href: s.announce + path, Type: typ},
+			{Rel: "start", Href: s.announce + "/opds", Type: opdsNavigationType},
+			{Rel: "search", Href: s.announce + "/opds/opensearch.xml", Type: "application/opensearchdescription+xml"},
+		},
+	}
+}
+
+// opdsEntry returns the entry of the pdf r, added at added, with content as its summary
+func (s *server) opdsEntry(r searchResult, added, content string) atomEntry {
+	id := strconv.Itoa(r.ID)
+	e := atomEntry{
+		ID:      s.announce + "/pdf/" + id,
+		Title:   resultView{searchResult: r}.Name(),
+		Updated: added,
+		Links: []atomLink{
+			{Rel: "http://opds-spec.org/acquisition", Href: s.absURL(s.link(r)), Type: "application/pdf"},
+			{Rel: "http://opds-spec.org/image", Href: s.announce + "/cover/" + id, Type: "image/jpeg"},
+			{Rel: "http://opds-spec.org/image/thumbnail", Href: s.announce + "/cover/" + id, Type: "image/jpeg"},
+			{Rel: "alternate", Href: s.announce + "/pdf/" + id, Type: "text/html"},
+		},
+	}
+	if content != "" {
+		e.Content = &atomText{Type: "text", Text: content}
+	}
+	return e
+}
+
+// pageLinks adds to feed the links to the pages before and after page
+func (s *server) pageLinks(feed *atomFeed, page webPage) {
+	if page.Prev != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "previous", Href: s.announce + page.Prev, Type: opdsAcquisitionType})
+	}
+	if page.Next != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "next", Href: s.announce + page.Next, Type: opdsAcquisitionType})
+	}
+}
+
+// writeFeed writes feed as xml of type typ
+func writeFeed(w http.ResponseWriter, feed atomFeed, typ string) {
+	w.Header().Set("Content-Type", typ)
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("failed to write feed %s: %v", feed.ID, err)
+	}
+}
+
+// recentSQL lists the pdfs added last, the newest first
+const recentSQL = `SELECT pdfs.id, pdfs.path, pdfs.pages, IFNULL(pdfs.title, ''), pdfs.added_at, IFNULL(pdfs.abstract, '') ` +
+	`FROM pdfs WHERE ` + liveSQL + ` ORDER BY pdfs.id DESC LIMIT ? OFFSET ?`
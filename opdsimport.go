@@ -0,0 +1,229 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDownloadSize is the largest pdf downloaded from a catalog
+	maxDownloadSize = 1 << 30
+
+	// maxCoverDownloadSize is the largest cover downloaded from a catalog
+	maxCoverDownloadSize = 10 << 20
+)
+
+// opdsPublication is a pdf of an OPDS catalog
+type opdsPublication struct {
+	title   string
+	authors string // separated by &
+	href    string // the url of the pdf
+	cover   string // the url of the cover image, if any
+}
+
+// opdsFilter selects the publications to import from a catalog
+type opdsFilter struct {
+	match *regexp.Regexp // the titles to import, nil for all
+	max   int            // the most publications to import, 0 for all
+}
+
+// opdsClient is the client of the catalogs, with a timeout for each request
+var opdsClient = &http.Client{Timeout: 10 * time.Minute}
+
+// importOPDS downloads to dir the pdfs of the OPDS catalog at start, and of the catalogs
+// it links to, that pass f, and adds them with the titles, authors and covers of the
+// catalog. A pdf is not downloaded again if its file is in dir, so that a catalog can
+// be mirrored by importing it again.
+func importOPDS(ctx context.Context, start, dir string, f opdsFilter) error {
+	pubs, err := crawlOPDS(ctx, start, f)
+	if err != nil {
+		return err
+	}
+	for _, p := range pubs {
+		path := filepath.Join(dir, publicationFile(p))
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := download(ctx, p.href, path, maxDownloadSize); err != nil {
+				log.Printf("download error %s: %v", p.href, err)
+				continue
+			}
+		}
+		meta := pdfMeta{title: p.title, authors: p.authors}
+		if p.cover != "" {
+			if meta.cover, err = fetch(ctx, p.cover, maxCoverDownloadSize); err != nil {
+				log.Printf("cover download error %s: %v", p.cover, err)
+			}
+		}
+		if err := addPDFMeta(path, meta); err != nil {
+			log.Printf("add error %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// crawlOPDS returns the pdfs that pass f in the catalog at start, in its next pages and
+// in the catalogs it links to
+func crawlOPDS(ctx context.Context, start string, f opdsFilter) ([]opdsPublication, error) {
+	var pubs []opdsPublication
+	queue := []string{start}
+	seen := map[string]bool{start: true}
+	for len(queue) > 0 && (f.max == 0 || len(pubs) < f.max) {
+		feedURL := queue[0]
+		queue = queue[1:]
+		feed, base, err := fetchFeed(ctx, feedURL)
+		if err != nil {
+			if feedURL == start {
+				return nil, err
+			}
+			log.Printf("crawl error %s: %v", feedURL, err)
+			continue
+		}
+		follow := func(l atomLink) {
+			if u, err := base.Parse(l.Href); err == nil && !seen[u.String()] {
+				seen[u.String()] = true
+				queue = append(queue, u.String())
+			}
+		}
+		for _, l := range feed.Links {
+			if l.Rel == "next" {
+				follow(l)
+			}
+		}
+		for _, e := range feed.Entries {
+			p := opdsPublication{title: strings.TrimSpace(e.Title)}
+			var names []string
+			for _, a := range e.Authors {
+				names = append(names, strings.TrimSpace(a.Name))
+			}
+			p.authors = strings.Join(names, " & ")
+			for _, l := range e.Links {
+				u, err := base.Parse(l.Href)
+				if err != nil {
+					continue
+				}
+				switch {
+				case strings.HasPrefix(l.Rel, "http://opds-spec.org/acquisition") && l.Type == "application/pdf":
+					p.href = u.String()
+				case l.Rel == "http://opds-spec.org/image":
+					p.cover = u.String()
+				case strings.HasPrefix(l.Type, "application/atom+xml"):
+					follow(l)
+				}
+			}
+			if p.href == "" || f.match != nil && !f.match.MatchString(p.title) {
+				continue
+			}
+			if f.max > 0 && len(pubs) >= f.max {
+				break
+			}
+			pubs = append(pubs, p)
+		}
+	}
+	return pubs, nil
+}
+
+// fetchFeed returns the feed at u and its url, the base of its relative links
+func fetchFeed(ctx context.Context, u string) (atomFeed, *url.URL, error) {
+	data, err := fetch(ctx, u, maxOutputSize)
+	if err != nil {
+		return atomFeed{}, nil, err
+	}
+	base, err := url.Parse(u)
+	if err != nil {
+		return atomFeed{}, nil, err
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return atomFeed{}, nil, fmt.Errorf("%s is not an OPDS feed: %w", u, err)
+	}
+	return feed, base, nil
+}
+
+// fetch returns the body of u, up to max bytes
+func fetch(ctx context.Context, u string, max int64) ([]byte, error) {
+	body, err := get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, max+1))
+	if err == nil && int64(len(data)) > max {
+		err = fmt.Errorf("%s is larger than %d bytes", u, max)
+	}
+	return data, err
+}
+
+// download saves the body of u, up to max bytes, to the file at path
+func download(ctx context.Context, u, path string, max int64) error {
+	body, err := get(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return saveBody(body, u, path, max)
+}
+
+// saveBody saves body, the response of u, up to max bytes, to the new file at path
+func saveBody(body io.Reader, u, path string, max int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(body, max+1))
+	if err == nil && n > max {
+		err = fmt.Errorf("%s is larger than %d bytes", u, max)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// get requests u and returns the body of a successful response
+func get(ctx context.Context, u string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", progName)
+	resp, err := opdsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// publicationFile returns the name of the file of p, the name in its url if it is a pdf,
+// or else its title. Catalogs like calibre-web have urls like /download/5/pdf.
+func publicationFile(p opdsPublication) string {
+	if u, err := url.Parse(p.href); err == nil {
+		if name := path.Base(u.Path); strings.EqualFold(path.Ext(name), ".pdf") {
+			return name
+		}
+	}
+	name := strings.Trim(nonAlnum.ReplaceAllString(p.title, "-"), "-")
+	if name == "" {
+		name = "publication"
+	}
+	return name + ".pdf"
+}
@@ -0,0 +1,84 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+const testCatalog = `<feed xmlns="http://www.w3.org/2005/Atom">
+<link rel="start" href="/opds" type="application/atom+xml;profile=opds-catalog;kind=navigation"/>
+%s
+</feed>`
+
+func TestCrawlOPDS(t *testing.T) {
+	feeds := map[string]string{
+		"/opds": `<entry><title>New</title><link rel="subsection" href="new" type="application/atom+xml;profile=opds-catalog;kind=acquisition"/></entry>`,
+		"/new": `<link rel="next" href="/new2" type="application/atom+xml"/>
+<entry><title>The Art of SQL</title><author><name>Faroult</name></author><author><name>Robson</name></author>
+<link rel="http://opds-spec.org/acquisition" href="/files/sql.pdf" type="application/pdf"/>
+<link rel="http://opds-spec.org/image" href="/covers/1.jpg" type="image/jpeg"/></entry>
+<entry><title>An epub</title><link rel="http://opds-spec.org/acquisition" href="/files/a.epub" type="application/epub+zip"/></entry>`,
+		"/new2": `<entry><title>Go at Google</title><link rel="http://opds-spec.org/acquisition/open-access" href="http://other.example/go.pdf" type="application/pdf"/></entry>
+<entry><title>Back to the root</title><link rel="start" href="/opds" type="application/atom+xml"/></entry>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries, ok := feeds[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, testCatalog, entries)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		f    opdsFilter
+		want []opdsPublication
+	}{
+		{opdsFilter{}, []opdsPublication{
+			{"The Art of SQL", "Faroult & Robson", srv.URL + "/files/sql.pdf", srv.URL + "/covers/1.jpg"},
+			{"Go at Google", "", "http://other.example/go.pdf", ""},
+		}},
+		{opdsFilter{match: regexp.MustCompile(`(?i)\bgo\b`)}, []opdsPublication{
+			{"Go at Google", "", "http://other.example/go.pdf", ""},
+		}},
+		{opdsFilter{max: 1}, []opdsPublication{
+			{"The Art of SQL", "Faroult & Robson", srv.URL + "/files/sql.pdf", srv.URL + "/covers/1.jpg"},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := crawlOPDS(context.Background(), srv.URL+"/opds", tt.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("crawlOPDS with %+v = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+
+	if _, err := crawlOPDS(context.Background(), srv.URL+"/missing", opdsFilter{}); err == nil {
+		t.Error("crawl of a missing catalog succeeded")
+	}
+}
+
+func TestPublicationFile(t *testing.T) {
+	tests := []struct {
+		p    opdsPublication
+		want string
+	}{
+		{opdsPublication{title: "SQL", href: "http://h/files/The%20Art.pdf"}, "The Art.pdf"},
+		{opdsPublication{title: "The Art of SQL: 2nd ed.", href: "http://h/opds/download/5/pdf/"}, "The-Art-of-SQL-2nd-ed.pdf"},
+		{opdsPublication{title: "", href: "http://h/get?id=5"}, "publication.pdf"},
+	}
+	for _, tt := range tests {
+		if got := publicationFile(tt.p); got != tt.want {
+			t.Errorf("publicationFile(%+v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
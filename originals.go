@@ -0,0 +1,78 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// storeOriginals, if set, stores the pdf files in the db, so that they can be opened
+// even if the files are moved or deleted
+var storeOriginals bool
+
+// storeOriginal stores the pdf file at path as the original of the pdf with id, if it
+// is not already stored
+func storeOriginal(ex execer, id int, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec(storeOriginalSQL, id, data)
+	return err
+}
+
+// openPDF opens the pdf with id with viewer. The file at the stored path is opened, or
+// the stored original if the file is missing.
+func openPDF(id int, viewer string) error {
+	var (
+		path   string
+		stored bool
+	)
+	err := db.QueryRow(pdfPathSQL, id).Scan(&path, &stored)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("pdf with id %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil || !stored {
+		return view(path, viewer)
+	}
+
+	var data []byte
+	if err := db.QueryRow(originalSQL, id).Scan(&data); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", progName+"-*.pdf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return view(f.Name(), viewer)
+}
+
+const (
+	// originalsSQL stores the pdf files, compressed, apart from pdfs to keep its rows small
+	originalsSQL = `CREATE TABLE originals(pdf_id INTEGER PRIMARY KEY, data BLOB NOT NULL);
+
+CREATE TRIGGER pdfs_originals_ad AFTER DELETE ON pdfs BEGIN
+	DELETE FROM originals WHERE pdf_id = old.id;
+END;`
+
+	storeOriginalSQL = `INSERT OR IGNORE INTO originals(pdf_id, data) VALUES(?, deflate(?))`
+
+	sigIDSQL = `SELECT id FROM pdfs WHERE sig = ? LIMIT 1`
+
+	pdfPathSQL = `SELECT path, EXISTS(SELECT 1 FROM originals WHERE pdf_id = pdfs.id) FROM pdfs WHERE id = ?`
+
+	originalSQL = `SELECT inflate(data) FROM originals WHERE pdf_id = ?`
+)
@@ -0,0 +1,274 @@
+//go:build fts5
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	packDatabaseName = "booklice.db"
+	packManifestName = "manifest.json"
+	packCoversDir    = "covers"
+)
+
+// packManifest describes a pack
+type packManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Host      string    `json:"host"`
+	PDFs      int       `json:"pdfs"`
+	Covers    int       `json:"covers"`
+}
+
+// pack writes to the new file at out a gzipped tar with a snapshot of the db and the
+// covers stored as files. The original pdfs are not included.
+func pack(out string) error {
+	tmp, err := os.MkdirTemp("", progName+"-pack-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	snapshot := filepath.Join(tmp, packDatabaseName)
+	if err := backupDatabase(snapshot); err != nil {
+		return err
+	}
+
+	covers, err := queryStrings(`SELECT DISTINCT cover_path FROM pdfs WHERE IFNULL(cover_path, '') != ''`)
+	if err != nil {
+		return err
+	}
+	manifest := packManifest{Version: len(migrations), CreatedAt: time.Now().UTC(), Host: hostname, Covers: len(covers)}
+	if err := db.QueryRow(countSQL).Scan(&manifest.PDFs); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tarBytes(tw, packManifestName, data); err != nil {
+		return err
+	}
+	if err := tarFile(tw, packDatabaseName, snapshot); err != nil {
+		return err
+	}
+	for _, cover := range covers {
+		if err := tarFile(tw, path.Join(packCoversDir, filepath.Base(cover)), cover); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// unpack replaces the db with the database in the pack at in. The covers in the pack are
+// stored in the user covers dir, see userCoversDir, only after the database is restored.
+func unpack(in string) error {
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+
+	tmp, err := os.MkdirTemp("", progName+"-unpack-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	staged := filepath.Join(tmp, packCoversDir)
+	if err := os.Mkdir(staged, 0700); err != nil {
+		return err
+	}
+
+	var (
+		manifest *packManifest
+		hasDB    bool
+		covers   []string
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch dir, name := path.Split(hdr.Name); {
+		case hdr.Name == packManifestName:
+			manifest = new(packManifest)
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return fmt.Errorf("bad manifest: %w", err)
+			}
+		case hdr.Name == packDatabaseName:
+			if err := untarFile(tr, filepath.Join(tmp, packDatabaseName)); err != nil {
+				return err
+			}
+			hasDB = true
+		case dir == packCoversDir+"/" && name != "" && name != "." && name != "..":
+			if err := untarFile(tr, filepath.Join(staged, name)); err != nil {
+				return err
+			}
+			covers = append(covers, name)
+		}
+	}
+	if manifest == nil || !hasDB {
+		return errors.New("not a booklice pack")
+	}
+	if manifest.Version > len(migrations) {
+		return fmt.Errorf("pack schema version %d is newer than the supported %d", manifest.Version, len(migrations))
+	}
+
+	if err := restoreDatabase(filepath.Join(tmp, packDatabaseName)); err != nil {
+		return err
+	}
+	if len(covers) == 0 {
+		return nil
+	}
+
+	coversDir, err := userCoversDir()
+	if err != nil {
+		return err
+	}
+	for _, name := range covers {
+		if err := moveFile(filepath.Join(staged, name), filepath.Join(coversDir, name)); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, name := range covers {
+		if _, err := tx.Exec(relocateCoverSQL, filepath.Join(coversDir, name), name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// moveFile moves the file at src to dst. If they are on different file systems, the file
+// is copied.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// queryStrings returns the strings selected by query
+func queryStrings(query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// tarBytes writes data to tw as the file name
+func tarBytes(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// tarFile writes the file at src to tw as the file name
+func tarFile(tw *tar.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// untarFile writes the current file of tr to dst
+func untarFile(tr *tar.Reader, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// relocateCoverSQL points the covers with a file name to their unpacked location
+const relocateCoverSQL = `UPDATE pdfs SET cover_path = ?1 WHERE cover_path LIKE '%/' || ?2 OR cover_path = ?2`
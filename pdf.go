@@ -4,24 +4,32 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
-	_ "embed"
+	"errors"
 	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
-const maxOutputSize = 100 * 1024 * 1024 // 100MB
+const (
+	maxOutputSize = 100 * 1024 * 1024 // 100MB
 
-var (
-	gsExe = "gs"
-
-	//go:embed emptypage.pdf
-	emptyPage []byte
+	// covers are jpeg thumbnails of this size in pixels
+	coverWidth   = 300
+	coverHeight  = 400
+	coverQuality = 75
 )
 
+var gsExe = "gs"
+
 // PDF is a handle for a pdf file
 type PDF struct {
 	path string
@@ -47,42 +55,112 @@ func (p PDF) Data() io.Reader {
 	return bytes.NewBuffer(p.data)
 }
 
-// FullText uses ghostscript to extract the full text of the pdf
-func (p PDF) FullText(ctx context.Context) ([]byte, error) {
+// FullText uses ghostscript to extract the full text of the pdf, one string per page.
+// It returns no pages if the text is larger than maxOutputSize. Ghostscript writes a
+// file per page and is stopped as soon as the files get larger than that.
+func (p PDF) FullText(ctx context.Context) ([]string, error) {
+	dir, err := os.MkdirTemp("", progName+"-text-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get full text of %q: %w", p.Path(), err)
+	}
+	defer os.RemoveAll(dir)
+
 	args := []string{
 		"-dNOPAUSE",
 		"-dBATCH",
 		"-dSAFER",
 		"-dQUIET",
 		"-sDEVICE=txtwrite",
-		"-sOutputFile=-",
+		"-sOutputFile=" + filepath.Join(dir, "page-%d.txt"),
 		"-",
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	cmd := exec.CommandContext(ctx, gsExe, args...)
 	cmd.Stdin = p.Data()
-	b := newBoundedBuffer(maxOutputSize)
-	cmd.Stdout = b
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to get full text of %q: %w", p.Path(), err)
 	}
-	if err := cmd.Wait(); err != nil {
+
+	exceeded := make(chan bool, 1)
+	go func() {
+		exceeded <- watchDirSize(ctx, dir, maxOutputSize, cancel)
+	}()
+	err = cmd.Wait()
+	cancel()
+	if <-exceeded {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to get full text of %q: %w", p.Path(), err)
 	}
 
-	if !b.filled {
-		return b.buf.Bytes(), nil
+	var (
+		pages []string
+		size  int
+	)
+	for i := 1; ; i++ {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("page-%d.txt", i)))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get full text of %q: %w", p.Path(), err)
+		}
+		if size += len(data); size > maxOutputSize {
+			return nil, nil
+		}
+		pages = append(pages, string(data))
 	}
-	return nil, nil
+	return pages, nil
 }
 
-// FullText uses ghostscript to extract the cover of the pdf
+// watchDirSize checks periodically, until ctx is done, the total size of the files in dir.
+// If it exceeds limit, it calls stop and reports true.
+func watchDirSize(ctx context.Context, dir string, limit int64, stop func()) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return dirSize(dir) > limit
+		case <-ticker.C:
+			if dirSize(dir) > limit {
+				stop()
+				return true
+			}
+		}
+	}
+}
+
+// dirSize returns the total size of the files in dir
+func dirSize(dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// Cover uses ghostscript to render the first page of the pdf as a jpeg thumbnail,
+// scaled to fit in coverWidth x coverHeight pixels
 func (p PDF) Cover(ctx context.Context) ([]byte, error) {
 	args := []string{
 		"-dNOPAUSE",
 		"-dBATCH",
 		"-dSAFER",
 		"-dQUIET",
-		"-sDEVICE=pdfwrite",
+		"-sDEVICE=jpeg",
+		fmt.Sprintf("-dJPEGQ=%d", coverQuality),
+		fmt.Sprintf("-g%dx%d", coverWidth, coverHeight),
+		"-dFIXEDMEDIA",
+		"-dPDFFitPage",
 		"-sOutputFile=-",
 		"-dFirstPage=1",
 		"-dLastPage=1",
@@ -102,7 +180,27 @@ func (p PDF) Cover(ctx context.Context) ([]byte, error) {
 	if !b.filled {
 		return b.buf.Bytes(), nil
 	}
-	return emptyPage, nil
+	return blankCover()
+}
+
+// blankCover returns a white jpeg of the size of covers
+func blankCover() ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, coverWidth, coverHeight))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: coverQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// coverExt returns the file extension for a stored cover. Covers are jpeg thumbnails,
+// except for pdfs indexed by older versions whose cover is a single page pdf.
+func coverExt(cover []byte) string {
+	if bytes.HasPrefix(cover, []byte("%PDF")) {
+		return ".pdf"
+	}
+	return ".jpg"
 }
 
 // Pages uses ghostscript to count the pages of the pdf
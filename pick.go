@@ -0,0 +1,50 @@
+//go:build fts5
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// pickResults lists the results numbered on out and opens, in a loop, the pdf or the cover
+// of the result whose number is read from in, until an empty line or EOF is read
+func pickResults(results []searchResult, in io.Reader, out io.Writer) error {
+	if len(results) == 0 {
+		return nil
+	}
+	fmt.Fprintln(out)
+	for i, r := range results {
+		fmt.Fprintf(out, "%3d [%s] %s\n", i+1, r.ref(), r.Path)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "open 1-%d, c<number> for the cover, enter to quit: ", len(results))
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		if answer == "" {
+			return nil
+		}
+		cover := strings.HasPrefix(answer, "c")
+		n, err := strconv.Atoi(strings.TrimPrefix(answer, "c"))
+		if err != nil || n < 1 || n > len(results) {
+			fmt.Fprintf(out, "no result %s\n", answer)
+			continue
+		}
+		if cover {
+			err = showCover(results[n-1].ID, "")
+		} else {
+			err = openPDF(results[n-1].ID, "")
+		}
+		if err != nil {
+			fmt.Fprintf(out, "failed to open %s: %v\n", results[n-1].Path, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+//go:build fts5
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// progressFailures is the number of recent failures in the progress
+	progressFailures = 5
+
+	// progressKeepAlive is how often the progress stream sends a comment when nothing
+	// changes, so that proxies don't close it
+	progressKeepAlive = 30 * time.Second
+)
+
+// uploadProgress is what adding the uploaded pdfs is doing
+type uploadProgress struct {
+	Adding   string      `json:"adding,omitempty"` // the file being added
+	Queued   int         `json:"queued"`           // the number of pdfs waiting to be added
+	Added    int         `json:"added"`            // the number of pdfs added or found duplicates
+	Failures []uploadJob `json:"failures"`         // the latest failures, the latest first
+}
+
+// progress returns the progress of u and a channel that is closed when it changes
+func (u *uploads) progress() (uploadProgress, <-chan struct{}) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p := uploadProgress{Failures: []uploadJob{}}
+	for i := len(u.jobs) - 1; i >= 0; i-- {
+		switch j := u.jobs[i]; j.Status {
+		case "adding":
+			p.Adding = j.File
+		case "queued":
+			p.Queued++
+		case "added", "duplicate":
+			p.Added++
+		case "failed":
+			if len(p.Failures) < progressFailures {
+				p.Failures = append(p.Failures, *j)
+			}
+		}
+	}
+	return p, u.changed
+}
+
+// handleProgress streams as server-sent events the progress of the uploads, an event
+// with the progress as json every time it changes, until the client goes away
+func (s *server) handleProgress(w http.ResponseWriter, r *http.Request) {
+	if s.uploads == nil {
+		http.NotFound(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	p, changed := s.uploads.progress()
+	if !writeProgress(w, p) {
+		return
+	}
+	keepAlive := time.NewTicker(progressKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-changed:
+			p, changed = s.uploads.progress()
+			if !writeProgress(w, p) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeProgress writes p as an event of the stream w and reports whether it could
+func writeProgress(w http.ResponseWriter, p uploadProgress) bool {
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("failed to write progress: %v", err)
+		return false
+	}
+	if _, err := fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data); err != nil {
+		return false
+	}
+	w.(http.Flusher).Flush()
+	return true
+}
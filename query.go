@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// queryTerms are the words of the flags of search that build an fts5 query, for users
+// who don't know the query syntax. Words are matched literally, except for a trailing *
+// that matches them as prefixes.
+type queryTerms struct {
+	all    string // pdfs with all the words
+	any    string // pdfs with any of the words
+	phrase string // pdfs with the words in sequence
+	not    string // pdfs without any of the words
+	near   string // pdfs with the words close to each other
+	within int    // how many words apart the near words may be, 0 is the fts5 default of 10
+}
+
+// build returns query, that may be empty, and the terms as one fts5 query
+func (t queryTerms) build(query string) (string, error) {
+	var parts []string
+	if query != "" {
+		parts = append(parts, "("+query+")")
+	}
+	if words := ftsWords(t.all); len(words) > 0 {
+		parts = append(parts, strings.Join(words, " AND "))
+	}
+	if words := ftsWords(t.any); len(words) > 0 {
+		parts = append(parts, "("+strings.Join(words, " OR ")+")")
+	}
+	if phrase := strings.Join(strings.Fields(t.phrase), " "); phrase != "" {
+		parts = append(parts, ftsQuote(phrase))
+	}
+	switch words := ftsWords(t.near); {
+	case t.within < 0:
+		return "", errors.New("-within must not be negative")
+	case t.within > 0 && len(words) == 0:
+		return "", errors.New("-within needs -near")
+	case len(words) == 1:
+		return "", errors.New("-near needs at least two words")
+	case len(words) > 1 && t.within > 0:
+		parts = append(parts, "NEAR("+strings.Join(words, " ")+", "+strconv.Itoa(t.within)+")")
+	case len(words) > 1:
+		parts = append(parts, "NEAR("+strings.Join(words, " ")+")")
+	}
+
+	q := strings.Join(parts, " AND ")
+	if words := ftsWords(t.not); len(words) > 0 {
+		if q == "" {
+			return "", errors.New("-not needs words to find")
+		}
+		q = "(" + q + ") NOT (" + strings.Join(words, " OR ") + ")"
+	}
+	if q == "" {
+		return "", errors.New("no query")
+	}
+	return q, nil
+}
+
+// ftsWords returns the words of s quoted as fts5 strings. A trailing * is kept out of
+// the quotes, so that the word is matched as a prefix.
+func ftsWords(s string) []string {
+	var words []string
+	for _, w := range strings.Fields(s) {
+		if stem := strings.TrimSuffix(w, "*"); stem != w && stem != "" {
+			words = append(words, ftsQuote(stem)+"*")
+		} else {
+			words = append(words, ftsQuote(w))
+		}
+	}
+	return words
+}
+
+// inColumns returns query restricted to the columns of the full text index in cols, a
+// comma separated list like title,path
+func inColumns(query, cols string) (string, error) {
+	var names []string
+	for _, c := range strings.Split(cols, ",") {
+		c = strings.TrimSpace(c)
+		if indexOf(rankColumns, c) < 0 {
+			return "", fmt.Errorf("unknown column %q, use %s", c, strings.Join(rankColumns, ", "))
+		}
+		names = append(names, c)
+	}
+	return "{" + strings.Join(names, " ") + "} : (" + query + ")", nil
+}
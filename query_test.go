@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestQueryTermsBuild(t *testing.T) {
+	tests := []struct {
+		query string
+		terms queryTerms
+		want  string
+	}{
+		{"golang", queryTerms{}, `(golang)`},
+		{"", queryTerms{all: "btree  index"}, `"btree" AND "index"`},
+		{"", queryTerms{any: "btree lsm"}, `("btree" OR "lsm")`},
+		{"", queryTerms{phrase: " write  ahead log "}, `"write ahead log"`},
+		{"", queryTerms{all: `data* "quoted"`}, `"data"* AND """quoted"""`},
+		{"", queryTerms{all: "* a"}, `"*" AND "a"`},
+		{"golang", queryTerms{any: "gc alloc", not: "java c++"}, `((golang) AND ("gc" OR "alloc")) NOT ("java" OR "c++")`},
+		{"", queryTerms{all: "AND", phrase: "NOT x"}, `"AND" AND "NOT x"`},
+		{"", queryTerms{near: "btree  split"}, `NEAR("btree" "split")`},
+		{"", queryTerms{near: "btree split* merge", within: 3}, `NEAR("btree" "split"* "merge", 3)`},
+		{"lsm", queryTerms{near: "a b", within: 5}, `(lsm) AND NEAR("a" "b", 5)`},
+	}
+	for _, tt := range tests {
+		got, err := tt.terms.build(tt.query)
+		if err != nil {
+			t.Errorf("build(%q) with %+v: %v", tt.query, tt.terms, err)
+		} else if got != tt.want {
+			t.Errorf("build(%q) with %+v = %s, want %s", tt.query, tt.terms, got, tt.want)
+		}
+	}
+
+	for _, bad := range []queryTerms{{}, {not: "java"}, {all: " "}, {near: "btree"}, {within: 5, all: "a"}, {near: "a b", within: -1}} {
+		if _, err := bad.build(""); err == nil {
+			t.Errorf("build with %+v succeeded", bad)
+		}
+	}
+}
+
+func TestInColumns(t *testing.T) {
+	got, err := inColumns("handbook OR manual", "title, path")
+	if want := "{title path} : (handbook OR manual)"; err != nil || got != want {
+		t.Errorf("inColumns = %q, %v, want %q", got, err, want)
+	}
+	for _, bad := range []string{"notes", "", "title,"} {
+		if _, err := inColumns("handbook", bad); err == nil {
+			t.Errorf("inColumns(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// rankColumns are the columns of the full text index, in the order of their bm25 weights
+var rankColumns = []string{"text", "abstract", "keywords", "toc", "title", "path"}
+
+// defaultRank are the bm25 weights of rankColumns. A match in the title weighs ten times,
+// in the abstract five times, in the toc three times and in the keywords and the path
+// twice a match in the text.
+const defaultRank = "1, 5, 2, 3, 10, 2"
+
+// parseRank returns the bm25 weights of defaultRank changed by s, a comma separated list
+// of column=weight like title=20,path=0
+func parseRank(s string) (string, error) {
+	weights := strings.Split(defaultRank, ", ")
+	for _, kv := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return "", fmt.Errorf("bad weight %q, use column=weight like title=20", kv)
+		}
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || w < 0 {
+			return "", fmt.Errorf("bad weight %q, use a number >= 0", kv)
+		}
+		i := indexOf(rankColumns, name)
+		if i < 0 {
+			return "", fmt.Errorf("unknown column %q, use one of %s", name, strings.Join(rankColumns, ", "))
+		}
+		weights[i] = strconv.FormatFloat(w, 'f', -1, 64)
+	}
+	return strings.Join(weights, ", "), nil
+}
+
+// indexOf returns the index of s in ss or -1
+func indexOf(ss []string, s string) int {
+	for i, x := range ss {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParseRank(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"title=20", "1, 5, 2, 3, 20, 2"},
+		{"title=20,path=0", "1, 5, 2, 3, 20, 0"},
+		{" text=0.5 , toc=4", "0.5, 5, 2, 4, 10, 2"},
+	}
+	for _, tt := range tests {
+		got, err := parseRank(tt.in)
+		if err != nil {
+			t.Errorf("parseRank(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("parseRank(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "title", "title=x", "title=-1", "author=2", "title=1;drop"} {
+		if _, err := parseRank(bad); err == nil {
+			t.Errorf("parseRank(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		client string
+		after  time.Duration
+		want   bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false}, // burst spent
+		{"b", 0, true},  // clients have their own buckets
+		{"a", 400 * time.Millisecond, false},
+		{"a", 100 * time.Millisecond, true}, // a token after half a second
+		{"a", 0, false},
+		{"a", 10 * time.Second, true}, // refilled up to burst
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+	}
+	for i, s := range steps {
+		now = now.Add(s.after)
+		if got := l.allow(s.client, now); got != s.want {
+			t.Errorf("step %d: allow(%q) = %v, want %v", i, s.client, got, s.want)
+		}
+	}
+}
+
+func TestRateLimiterForget(t *testing.T) {
+	l := newRateLimiter(1, 1)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.allow("idle", now)
+	l.allow("busy", now.Add(time.Second))
+	l.forget(now.Add(1500 * time.Millisecond))
+	if _, ok := l.clients["idle"]; ok {
+		t.Error("idle client not forgotten")
+	}
+	if _, ok := l.clients["busy"]; !ok {
+		t.Error("busy client forgotten")
+	}
+}
@@ -0,0 +1,67 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// regexSearch scans the stored text of the pdfs selected by f for matches of re, fetches
+// the page of opts, writes them to w in format and returns them. The pdfs are read one at
+// a time in the order they were added and ranked by the negated count of the matches. The
+// index is not used, so it is slower than search but matches what fts can't, like
+// identifiers or version strings.
+func regexSearch(re *regexp.Regexp, opts searchOptions, f filter, w io.Writer, format resultFormat) ([]searchResult, error) {
+	rows, err := db.Query(regexSearchSQL, f.args()...)
+	if err != nil {
+		return nil, fmt.Errorf("regex search for %q failed: %w", re, err)
+	}
+	defer rows.Close()
+
+	rw := newResultWriter(w, format)
+	var results []searchResult
+	skipped := 0
+	for len(results) < opts.limit && rows.Next() {
+		var (
+			r    searchResult
+			text string
+		)
+		if err := rows.Scan(&r.ID, &r.Path, &r.Pages, &r.Title, &text); err != nil {
+			return nil, fmt.Errorf("regex search for %q failed, can't scan row: %w", re, err)
+		}
+		matches := re.FindAllStringIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if skipped < opts.offset {
+			skipped++
+			continue
+		}
+
+		// mark the matches like the fts5 highlight function
+		marked := re.ReplaceAllString(text, "{{{$0}}}")
+		var snippet string
+		if opts.paragraph {
+			snippet = paragraph(marked)
+		} else {
+			snippet = pageSnippets(marked, opts.snippets, opts.tokens)
+		}
+		r.Rank = -float64(len(matches))
+		r.Snippet, r.Matches = parseSnippet(snippet)
+		results = append(results, r)
+		if err := rw.search(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("regex search for %q failed, can't fetch rows: %w", re, err)
+	}
+
+	return results, rw.flush()
+}
+
+const regexSearchSQL = `SELECT pdfs.id, pdfs.path, pdfs.pages, IFNULL(pdfs.title, ''), IFNULL(inflate(pdfs.text), '') ` +
+	`FROM pdfs WHERE ` + liveSQL + ` AND ` + filterSQL + ` ORDER BY pdfs.id`
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// searchResult is a pdf found by search
+type searchResult struct {
+	Library string   `json:"library,omitempty"`
+	ID      int      `json:"id"`
+	Path    string   `json:"path"`
+	Title   string   `json:"title"`
+	Pages   int      `json:"pages"`
+	Rank    float64  `json:"rank"`
+	Snippet string   `json:"snippet"`
+	Matches [][2]int `json:"matches"` // the byte offsets, start and end, of the matches in Snippet
+}
+
+// resultFormats are the formats of resultFormat
+var resultFormats = []string{"text", "json", "csv", "tsv"}
+
+// resultFormat is how search and list write the pdfs
+type resultFormat struct {
+	name      string             // one of resultFormats, empty is text
+	namesOnly bool               // for text, write the names only
+	pathsOnly bool               // with namesOnly, write the paths without the ids and pages
+	nul       bool               // with namesOnly, write the paths separated by NUL
+	highlight string             // for text, the ANSI escape that starts a match, see highlightStyle
+	keywords  bool               // for text, write the keywords of listed pdfs
+	tmpl      *template.Template // for text, write each pdf with the template instead
+}
+
+// checkFormat returns an error if name is not one of resultFormats
+func checkFormat(name string) error {
+	if indexOf(resultFormats, name) < 0 {
+		return fmt.Errorf("unknown format %q, use one of %s", name, strings.Join(resultFormats, ", "))
+	}
+	return nil
+}
+
+// parseTemplate parses the template of -template. The escapes \t and \n are replaced
+// by a tab and a newline so that they can be given in the shell without quoting.
+// It returns nil for an empty template.
+func parseTemplate(s string) (*template.Template, error) {
+	if s == "" {
+		return nil, nil
+	}
+	s = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(s)
+	return template.New("result").Parse(s)
+}
+
+// matchStyles are the names of the ANSI styles for highlightStyle
+var matchStyles = map[string]string{
+	"bold": "1", "underline": "4", "reverse": "7",
+	"red": "31", "green": "32", "yellow": "33", "blue": "34", "magenta": "35", "cyan": "36",
+}
+
+// highlightStyle returns the ANSI escape that starts a match for the -color and -style
+// flags, or "" if matches are not highlighted. color is always, never or auto, that
+// highlights only if out is a terminal. style is a comma separated list of names of
+// matchStyles or ANSI codes, like bold,red or 1;38;5;208.
+func highlightStyle(color, style string, out *os.File) (string, error) {
+	var codes []string
+	for _, s := range strings.Split(style, ",") {
+		s = strings.TrimSpace(s)
+		if code, ok := matchStyles[s]; ok {
+			codes = append(codes, code)
+		} else if s != "" && strings.Trim(s, "0123456789;") == "" {
+			codes = append(codes, s)
+		} else {
+			return "", fmt.Errorf("unknown style %q", s)
+		}
+	}
+	switch color {
+	case "never":
+		return "", nil
+	case "auto":
+		if !isTerminal(out) {
+			return "", nil
+		}
+	case "always":
+	default:
+		return "", fmt.Errorf("unknown color %q, use always, never or auto", color)
+	}
+	return "\033[" + strings.Join(codes, ";") + "m", nil
+}
+
+// isTerminal reports whether f is a terminal and not a pipe or a file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ref returns the id of r as given to cover and info. Ids are unique within a library.
+func (r searchResult) ref() string {
+	if r.Library != "" {
+		return r.Library + ":" + strconv.Itoa(r.ID)
+	}
+	return strconv.Itoa(r.ID)
+}
+
+// searchHeader is the header of the csv and tsv results of search
+var searchHeader = []string{"library", "id", "path", "title", "pages", "rank", "snippet"}
+
+// record returns r as a row of searchHeader
+func (r searchResult) record() []string {
+	return []string{r.Library, strconv.Itoa(r.ID), r.Path, r.Title, strconv.Itoa(r.Pages), strconv.FormatFloat(r.Rank, 'g', -1, 64), r.Snippet}
+}
+
+// listHeader is the header of the csv and tsv results of list
+var listHeader = []string{"id", "path", "pages", "title", "isbn", "keywords"}
+
+// listResult is a pdf listed by list, written as json
+type listResult struct {
+	ID       int    `json:"id"`
+	Path     string `json:"path"`
+	Pages    int    `json:"pages"`
+	Title    string `json:"title"`
+	ISBN     string `json:"isbn"`
+	Keywords string `json:"keywords"`
+}
+
+// result returns e as written in json and given to templates
+func (e listEntry) result() listResult {
+	return listResult{e.id, e.name, e.pages, e.title, e.isbn, e.kws}
+}
+
+// resultWriter writes the results of search and list in a format. csv and tsv start with
+// a header. Call flush after the last result.
+type resultWriter struct {
+	w      io.Writer
+	format resultFormat
+	table  *csv.Writer // for csv and tsv
+	header bool        // whether the header is written
+}
+
+// newResultWriter returns a resultWriter that writes to w in format
+func newResultWriter(w io.Writer, format resultFormat) *resultWriter {
+	rw := &resultWriter{w: w, format: format}
+	switch format.name {
+	case "csv":
+		rw.table = csv.NewWriter(w)
+	case "tsv":
+		rw.table = csv.NewWriter(w)
+		rw.table.Comma = '\t'
+	}
+	return rw
+}
+
+// writeRow writes a row of a table, after the header if it is the first
+func (rw *resultWriter) writeRow(header, record []string) error {
+	if !rw.header {
+		if err := rw.table.Write(header); err != nil {
+			return err
+		}
+		rw.header = true
+	}
+	return rw.table.Write(record)
+}
+
+// execute writes data with the template of the format, followed by a newline
+func (rw *resultWriter) execute(data interface{}) error {
+	if err := rw.format.tmpl.Execute(rw.w, data); err != nil {
+		return err
+	}
+	_, err := io.WriteString(rw.w, "\n")
+	return err
+}
+
+// search writes a result of search
+func (rw *resultWriter) search(r searchResult) error {
+	switch {
+	case rw.table != nil:
+		return rw.writeRow(searchHeader, r.record())
+	case rw.format.name == "json":
+		return json.NewEncoder(rw.w).Encode(r)
+	case rw.format.tmpl != nil:
+		return rw.execute(r)
+	case rw.format.namesOnly && rw.format.nul:
+		_, err := fmt.Fprintf(rw.w, "%s\x00", r.Path)
+		return err
+	case rw.format.namesOnly && rw.format.pathsOnly:
+		_, err := fmt.Fprintf(rw.w, "%s\n", r.Path)
+		return err
+	case rw.format.namesOnly:
+		_, err := fmt.Fprintf(rw.w, "[%s] %s (#%d)\n", r.ref(), r.Path, r.Pages)
+		return err
+	}
+	snippet := r.Snippet
+	if rw.format.highlight != "" {
+		var b strings.Builder
+		prev := 0
+		for _, m := range r.Matches {
+			b.WriteString(snippet[prev:m[0]])
+			b.WriteString(rw.format.highlight + snippet[m[0]:m[1]] + "\033[0m")
+			prev = m[1]
+		}
+		b.WriteString(snippet[prev:])
+		snippet = b.String()
+	}
+	_, err := fmt.Fprintf(rw.w, "[%s] %s (#%d)\n%s\n\n", r.ref(), r.Path, r.Pages, snippet)
+	return err
+}
+
+// list writes a result of list
+func (rw *resultWriter) list(e listEntry) error {
+	switch {
+	case rw.table != nil:
+		return rw.writeRow(listHeader, []string{strconv.Itoa(e.id), e.name, strconv.Itoa(e.pages), e.title, e.isbn, e.kws})
+	case rw.format.name == "json":
+		return json.NewEncoder(rw.w).Encode(e.result())
+	case rw.format.tmpl != nil:
+		return rw.execute(e.result())
+	}
+	e.write(rw.w, "", rw.format.keywords)
+	return nil
+}
+
+// flush writes any buffered results
+func (rw *resultWriter) flush() error {
+	if rw.table == nil {
+		return nil
+	}
+	rw.table.Flush()
+	return rw.table.Error()
+}
+
+// paragraph returns the paragraph with the first match in text, as returned by the fts5
+// highlight function with the matches between {{{ and }}}. Paragraphs are separated by
+// empty lines or pages. It returns "" if there is no match.
+func paragraph(text string) string {
+	i := strings.Index(text, "{{{")
+	if i < 0 {
+		return ""
+	}
+	start, end := 0, len(text)
+	for _, sep := range []string{"\n\n", pageSeparator} {
+		if j := strings.LastIndex(text[:i], sep); j >= 0 && j+len(sep) > start {
+			start = j + len(sep)
+		}
+		if j := strings.Index(text[i:], sep); j >= 0 && i+j < end {
+			end = i + j
+		}
+	}
+	return strings.TrimSpace(text[start:end])
+}
+
+// pageSnippets returns snippets of about tokens words around the first match in each of
+// the first n pages of text with matches, one per line and labelled with the page. text
+// is as returned by the fts5 highlight function. It returns "" if there is no match.
+func pageSnippets(text string, n, tokens int) string {
+	var lines []string
+	for i, page := range strings.Split(text, pageSeparator) {
+		if len(lines) == n {
+			break
+		}
+		words := strings.Fields(page)
+		k := 0
+		for k < len(words) && !strings.Contains(words[k], "{{{") {
+			k++
+		}
+		if k == len(words) {
+			continue
+		}
+		start, end := k-tokens/2, k+(tokens+1)/2
+		if start < 0 {
+			start = 0
+		}
+		if end > len(words) {
+			end = len(words)
+		}
+		// do not cut a match of many words
+		open := 0
+		for _, w := range words[start:end] {
+			open += strings.Count(w, "{{{") - strings.Count(w, "}}}")
+		}
+		for ; open > 0 && end < len(words); end++ {
+			open += strings.Count(words[end], "{{{") - strings.Count(words[end], "}}}")
+		}
+		s := strings.Join(words[start:end], " ")
+		if start > 0 {
+			s = "..." + s
+		}
+		if end < len(words) {
+			s += "..."
+		}
+		lines = append(lines, fmt.Sprintf("p. %d: %s", i+1, s))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSnippet returns the snippet, as returned by the fts5 snippet function with the
+// matches between {{{ and }}}, without the marks and with pages separated by newlines,
+// and the offsets of the matches in it
+func parseSnippet(s string) (string, [][2]int) {
+	s = strings.ReplaceAll(s, pageSeparator, "\n")
+	var (
+		b       strings.Builder
+		matches [][2]int
+	)
+	for {
+		i := strings.Index(s, "{{{")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(s[i+3:], "}}}")
+		if j < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		start := b.Len()
+		b.WriteString(s[i+3 : i+3+j])
+		matches = append(matches, [2]int{start, b.Len()})
+		s = s[i+3+j+3:]
+	}
+	b.WriteString(s)
+	return b.String(), matches
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseSnippet(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		matches [][2]int
+	}{
+		{"no matches", "no matches", nil},
+		{"...the {{{go}}} language", "...the go language", [][2]int{{7, 9}}},
+		{"{{{a}}} and {{{b}}}", "a and b", [][2]int{{0, 1}, {6, 7}}},
+		{"page one\f{{{καλημέρα}}}", "page one\nκαλημέρα", [][2]int{{9, 25}}},
+		{"broken {{{mark", "broken {{{mark", nil},
+	}
+	for _, tt := range tests {
+		got, matches := parseSnippet(tt.in)
+		if got != tt.want || !reflect.DeepEqual(matches, tt.matches) {
+			t.Errorf("parseSnippet(%q) = %q, %v, want %q, %v", tt.in, got, matches, tt.want, tt.matches)
+		}
+	}
+}
+
+func TestSearchResultWrite(t *testing.T) {
+	snippet, matches := parseSnippet("the {{{go}}} book")
+	r := searchResult{Library: "home", ID: 12, Path: "/pdfs/go.pdf", Pages: 3, Snippet: snippet, Matches: matches}
+	tests := []struct {
+		format resultFormat
+		want   string
+	}{
+		{resultFormat{}, "[home:12] /pdfs/go.pdf (#3)\nthe go book\n\n"},
+		{resultFormat{highlight: "\033[1m"}, "[home:12] /pdfs/go.pdf (#3)\nthe \033[1mgo\033[0m book\n\n"},
+		{resultFormat{namesOnly: true}, "[home:12] /pdfs/go.pdf (#3)\n"},
+		{resultFormat{namesOnly: true, pathsOnly: true}, "/pdfs/go.pdf\n"},
+		{resultFormat{namesOnly: true, nul: true}, "/pdfs/go.pdf\x00"},
+		{resultFormat{name: "json"}, `{"library":"home","id":12,"path":"/pdfs/go.pdf","title":"","pages":3,"rank":0,"snippet":"the go book","matches":[[4,6]]}` + "\n"},
+		{resultFormat{name: "csv"}, "library,id,path,title,pages,rank,snippet\nhome,12,/pdfs/go.pdf,,3,0,the go book\nhome,12,/pdfs/go.pdf,,3,0,the go book\n"},
+		{resultFormat{name: "tsv"}, "library\tid\tpath\ttitle\tpages\trank\tsnippet\nhome\t12\t/pdfs/go.pdf\t\t3\t0\tthe go book\nhome\t12\t/pdfs/go.pdf\t\t3\t0\tthe go book\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		rw := newResultWriter(&b, tt.format)
+		if err := rw.search(r); err != nil {
+			t.Fatal(err)
+		}
+		if tt.format.name == "csv" || tt.format.name == "tsv" {
+			// the header is written once
+			if err := rw.search(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rw.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("write with %+v = %q, want %q", tt.format, b.String(), tt.want)
+		}
+	}
+}
+
+func TestSearchResultWriteQuoted(t *testing.T) {
+	r := searchResult{ID: 1, Path: "/pdfs/a, b.pdf", Title: `the "a" book`, Snippet: "two\nlines"}
+	var b bytes.Buffer
+	rw := newResultWriter(&b, resultFormat{name: "csv"})
+	if err := rw.search(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "library,id,path,title,pages,rank,snippet\n,1,\"/pdfs/a, b.pdf\",\"the \"\"a\"\" book\",0,0,\"two\nlines\"\n"
+	if b.String() != want {
+		t.Errorf("csv = %q, want %q", b.String(), want)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{.ID}}\t{{.Title}}`, "12\tGo\n"},
+		{`{{.Path}} {{len .Matches}}`, "/pdfs/go.pdf 1\n"},
+		{`{{.ref}}`, ""},
+	}
+	r := searchResult{ID: 12, Path: "/pdfs/go.pdf", Title: "Go", Matches: [][2]int{{0, 2}}}
+	for _, tt := range tests {
+		tmpl, err := parseTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		err = newResultWriter(&b, resultFormat{tmpl: tmpl}).search(r)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("template %q succeeded, want error", tt.tmpl)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("template %q = %q, want %q", tt.tmpl, b.String(), tt.want)
+		}
+	}
+	if _, err := parseTemplate("{{.ID"); err == nil {
+		t.Error("parse of an unclosed action succeeded")
+	}
+}
+
+func TestParagraph(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"no match", ""},
+		{"intro\n\nthe {{{go}}} book\nsecond line\n\nend", "the {{{go}}} book\nsecond line"},
+		{"page one\fthe {{{go}}} book\fpage three", "the {{{go}}} book"},
+		{"{{{go}}}\n\n{{{go}}} again", "{{{go}}}"},
+	}
+	for _, tt := range tests {
+		if got := paragraph(tt.text); got != tt.want {
+			t.Errorf("paragraph(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPageSnippets(t *testing.T) {
+	tests := []struct {
+		text   string
+		n      int
+		tokens int
+		want   string
+	}{
+		{"no match", 2, 4, ""},
+		{"a b {{{go}}} c d e f\fnone\fx {{{go}}}", 2, 4, "p. 1: a b {{{go}}} c...\np. 3: x {{{go}}}"},
+		{"z a b {{{go}}} c", 1, 2, "p. 1: ...b {{{go}}}..."},
+		{"{{{go}}}\f{{{go}}}\f{{{go}}}", 2, 4, "p. 1: {{{go}}}\np. 2: {{{go}}}"},
+		{"a {{{the go book}}} b c", 1, 2, "p. 1: a {{{the go book}}}..."},
+	}
+	for _, tt := range tests {
+		if got := pageSnippets(tt.text, tt.n, tt.tokens); got != tt.want {
+			t.Errorf("pageSnippets(%q, %d, %d) = %q, want %q", tt.text, tt.n, tt.tokens, got, tt.want)
+		}
+	}
+}
+
+func TestHighlightStyle(t *testing.T) {
+	tests := []struct {
+		color, style string
+		want         string
+	}{
+		{"always", "bold", "\033[1m"},
+		{"always", "bold, red", "\033[1;31m"},
+		{"always", "1;38;5;208", "\033[1;38;5;208m"},
+		{"never", "bold", ""},
+		{"auto", "bold", ""}, // stdout of tests is not a terminal
+	}
+	for _, tt := range tests {
+		got, err := highlightStyle(tt.color, tt.style, os.Stdout)
+		if err != nil {
+			t.Errorf("highlightStyle(%q, %q): %v", tt.color, tt.style, err)
+		} else if got != tt.want {
+			t.Errorf("highlightStyle(%q, %q) = %q, want %q", tt.color, tt.style, got, tt.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"sometimes", "bold"}, {"always", "blink"}, {"always", ""}, {"always", "1m"}} {
+		if _, err := highlightStyle(bad[0], bad[1], os.Stdout); err == nil {
+			t.Errorf("highlightStyle(%q, %q) succeeded", bad[0], bad[1])
+		}
+	}
+}
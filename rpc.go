@@ -0,0 +1,275 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// the JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// rpcRequest is a JSON-RPC 2.0 request, or a notification if it has no id
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// serveJSONRPC reads JSON-RPC messages from r, calls handle with their methods and params
+// and writes the responses to w, one per line, until r ends. Errors of handle that are not
+// rpcErrors are returned as invalid params.
+func serveJSONRPC(ctx context.Context, r io.Reader, w io.Writer, handle func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)) error {
+	dec := json.NewDecoder(r)
+	enc := json.NewEncoder(w)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			// the stream can't be resynchronized after bad json
+			enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			return err
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+			if err := enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcInvalidRequest, "invalid request"}}); err != nil {
+				return err
+			}
+			continue
+		}
+		result, err := handle(ctx, req.Method, req.Params)
+		if len(req.ID) == 0 {
+			continue
+		}
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+		if err != nil {
+			resp.Result = nil
+			if !errors.As(err, &resp.Error) {
+				resp.Error = &rpcError{rpcInvalidParams, err.Error()}
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// rpcAdded is the result of adding a path with the api
+type rpcAdded struct {
+	Path      string `json:"path"`
+	ID        int    `json:"id,omitempty"` // of the pdf, if the path is a file
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// rpcSearchResult is a page of the results of a search with the api
+type rpcSearchResult struct {
+	Total   int            `json:"total"`
+	Results []searchResult `json:"results"`
+}
+
+// rpcCover is the cover of a pdf, base64 encoded in json
+type rpcCover struct {
+	Type string `json:"type"`
+	Data []byte `json:"data"`
+}
+
+// rpcServer answers the methods of the api, see handle
+type rpcServer struct {
+	addMu sync.Mutex // adds run one at a time, like the uploads of serve
+}
+
+// serveAPI serves the api on the unix socket at path, or the socket passed by systemd,
+// until ctx is done or the process is interrupted. Each connection sends JSON-RPC 2.0
+// requests, one per line, and gets the responses in the same way.
+func serveAPI(ctx context.Context, path string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := listen("unix:" + path)
+	if err != nil {
+		return err
+	}
+	if !socketActivated() {
+		defer os.Remove(path)
+		// the api adds any file of the user, so only the user may connect
+		if err := os.Chmod(path, 0600); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	log.Printf("serving the api on %s", ln.Addr())
+
+	s := &rpcServer{}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			go func() {
+				<-ctx.Done()
+				conn.Close()
+			}()
+			if err := serveJSONRPC(ctx, conn, conn, s.handle); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("api connection error: %v", err)
+			}
+		}()
+	}
+}
+
+// apiSocketPath returns the default path of the socket of the api, in $XDG_RUNTIME_DIR
+// or else the temporary dir, named after the database
+func apiSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	name := strings.TrimSuffix(filepath.Base(databasePath), filepath.Ext(databasePath))
+	return filepath.Join(dir, progName+"-"+name+".sock")
+}
+
+// handle returns the result of the api method called with params. The methods are:
+//
+//	add {"paths": [...]}                       adds files and directories
+//	search {"query": q, "limit": n, "offset": n} searches like the search command
+//	cover {"id": n}                            returns the cover of a pdf
+//	ping                                       returns {}
+func (s *rpcServer) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Paths  []string `json:"paths"`
+		Query  string   `json:"query"`
+		Limit  int      `json:"limit"`
+		Offset int      `json:"offset"`
+		ID     int      `json:"id"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	switch method {
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "add":
+		if len(p.Paths) == 0 {
+			return nil, errors.New("missing paths")
+		}
+		return s.add(p.Paths), nil
+	case "search":
+		if strings.TrimSpace(p.Query) == "" {
+			return nil, errors.New("missing query")
+		}
+		if p.Limit <= 0 || p.Limit > apiMaxPageSize {
+			p.Limit = apiPageSize
+		}
+		if p.Offset < 0 {
+			return nil, errors.New("negative offset")
+		}
+		var res rpcSearchResult
+		var err error
+		if res.Total, err = searchCount(ctx, searchCountSQL, p.Query, filter{}); err != nil {
+			return nil, fmt.Errorf("bad query: %w", err)
+		}
+		opts := searchOptions{limit: p.Limit, offset: p.Offset, tokens: 16, snippets: 1}
+		if res.Results, err = search(ctx, searchStmt, p.Query, opts, filter{}, io.Discard, resultFormat{}); err != nil {
+			return nil, err
+		}
+		if res.Results == nil {
+			res.Results = []searchResult{}
+		}
+		return res, nil
+	case "cover":
+		data, _, err := loadCover(ctx, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		if coverExt(data) == ".pdf" {
+			pdf := PDF{path: fmt.Sprintf("cover of %d", p.ID), data: data}
+			if data, err = pdf.Cover(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return rpcCover{Type: mime.TypeByExtension(coverExt(data)), Data: data}, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, "unknown method " + method}
+}
+
+// add adds the files and directories at paths, that must be absolute, and returns how
+// adding each went
+func (s *rpcServer) add(paths []string) []rpcAdded {
+	s.addMu.Lock()
+	defer s.addMu.Unlock()
+	added := make([]rpcAdded, len(paths))
+	for i, path := range paths {
+		added[i].Path = path
+		if !filepath.IsAbs(path) {
+			added[i].Error = "path is not absolute"
+			continue
+		}
+		fi, err := os.Stat(path)
+		switch {
+		case err != nil:
+		case fi.IsDir():
+			err = addPath(path)
+		case !strings.EqualFold(filepath.Ext(path), ".pdf"):
+			err = errors.New("not a pdf")
+		default:
+			if err = addPDF(path); err == nil {
+				added[i].ID, added[i].Duplicate, err = indexedPath(path)
+			}
+		}
+		if err != nil {
+			added[i].Error = err.Error()
+		}
+	}
+	return added
+}
@@ -0,0 +1,44 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRPCServerHandle(t *testing.T) {
+	tests := []struct {
+		method string
+		params string
+		want   interface{}
+		code   int // of the rpcError, or 0 for other errors
+		err    bool
+	}{
+		{"ping", ``, map[string]interface{}{}, 0, false},
+		{"delete", `{"id":1}`, nil, rpcMethodNotFound, true},
+		{"add", `{}`, nil, 0, true},
+		{"add", `{"paths":["rel/a.pdf"]}`, []rpcAdded{{Path: "rel/a.pdf", Error: "path is not absolute"}}, 0, false},
+		{"add", `{"paths":["/a.txt"]}`, []rpcAdded{{Path: "/a.txt", Error: "stat /a.txt: no such file or directory"}}, 0, false},
+		{"search", `{"query":"  "}`, nil, 0, true},
+		{"search", `{"query":"go","offset":-1}`, nil, 0, true},
+		{"search", `{"query":1}`, nil, 0, true},
+	}
+	s := &rpcServer{}
+	for _, tt := range tests {
+		got, err := s.handle(context.Background(), tt.method, json.RawMessage(tt.params))
+		if tt.err {
+			var rerr *rpcError
+			if err == nil || errors.As(err, &rerr) != (tt.code != 0) || rerr != nil && rerr.Code != tt.code {
+				t.Errorf("handle(%s, %s) = %v, %v, want error with code %d", tt.method, tt.params, got, err, tt.code)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("handle(%s, %s) = %v, %v, want %v", tt.method, tt.params, got, err, tt.want)
+		}
+	}
+}
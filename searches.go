@@ -0,0 +1,181 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// searchArgs returns the flags set in fs, except skip, and the query as arguments of search
+func searchArgs(fs *flag.FlagSet, query string, skip ...string) []string {
+	var args []string
+	fs.Visit(func(f *flag.Flag) {
+		if indexOf(skip, f.Name) < 0 {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return append(args, query)
+}
+
+// recordSearch records the arguments of a search in the searches table
+func recordSearch(args []string) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(recordSearchSQL, formatTimestamp(time.Now()), hostname, string(data))
+	return err
+}
+
+// lastSearch returns the arguments of the nth latest search, starting from 1
+func lastSearch(n int) ([]string, error) {
+	var data string
+	err := db.QueryRow(lastSearchSQL, n-1).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no search %d in the history", n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	err = json.Unmarshal([]byte(data), &args)
+	return args, err
+}
+
+// rerunSearch sets the flags of fs from the nth latest search, except those set already,
+// and returns its query
+func rerunSearch(fs *flag.FlagSet, n int) (string, error) {
+	args, err := lastSearch(n)
+	if err != nil {
+		return "", err
+	}
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	for name, value := range set {
+		if err := fs.Set(name, value); err != nil {
+			return "", err
+		}
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("search %d in the history has no query", n)
+	}
+	return fs.Arg(0), nil
+}
+
+// searchHistory writes to w the latest n searches, numbered as used by search -last
+func searchHistory(n int, w io.Writer) error {
+	rows, err := db.Query(searchHistorySQL, n)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for i := 1; rows.Next(); i++ {
+		var at, host, data string
+		if err := rows.Scan(&at, &host, &data); err != nil {
+			return err
+		}
+		var args []string
+		if err := json.Unmarshal([]byte(data), &args); err != nil {
+			return err
+		}
+		for j, a := range args {
+			if a == "" || strings.ContainsAny(a, " \t\"'\\") {
+				args[j] = fmt.Sprintf("%q", a)
+			}
+		}
+		fmt.Fprintf(w, "%3d %s %s %s\n", i, at, host, strings.Join(args, " "))
+	}
+	return rows.Err()
+}
+
+// saveSearch saves query with name, replacing the query saved with it before. The query
+// is checked by running it.
+func saveSearch(name, query string) error {
+	var n int
+	if err := dfStmt.QueryRow(query).Scan(&n); err != nil {
+		return fmt.Errorf("bad query %q: %w", query, err)
+	}
+	_, err := db.Exec(saveSearchSQL, name, query, formatTimestamp(time.Now()))
+	return err
+}
+
+// deleteSearch deletes the search saved with name
+func deleteSearch(name string) error {
+	res, err := db.Exec(deleteSavedSearchSQL, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("no saved search %q", name)
+	}
+	return err
+}
+
+// savedSearch returns the query saved with name
+func savedSearch(name string) (string, error) {
+	var query string
+	err := db.QueryRow(savedSearchSQL, name).Scan(&query)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("no saved search %q, see save", name)
+	}
+	return query, err
+}
+
+// savedSearches writes to w the saved searches by name
+func savedSearches(w io.Writer) error {
+	rows, err := db.Query(savedSearchesSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, query string
+		if err := rows.Scan(&name, &query); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, query)
+	}
+	return rows.Err()
+}
+
+const (
+	searchesSQL = `CREATE TABLE searches(
+	id   INTEGER PRIMARY KEY,
+	at   TEXT NOT NULL,
+	host TEXT NOT NULL,
+	args TEXT NOT NULL
+);`
+
+	recordSearchSQL = `INSERT INTO searches(at, host, args) VALUES(?, ?, ?)`
+
+	lastSearchSQL = `SELECT args FROM searches ORDER BY id DESC LIMIT 1 OFFSET ?`
+
+	searchHistorySQL = `SELECT at, host, args FROM searches ORDER BY id DESC LIMIT ?`
+
+	savedSearchesTableSQL = `CREATE TABLE saved_searches(
+	name     TEXT PRIMARY KEY,
+	query    TEXT NOT NULL,
+	saved_at TEXT NOT NULL
+);`
+
+	saveSearchSQL = `INSERT OR REPLACE INTO saved_searches(name, query, saved_at) VALUES(?, ?, ?)`
+
+	deleteSavedSearchSQL = `DELETE FROM saved_searches WHERE name = ?`
+
+	savedSearchSQL = `SELECT query FROM saved_searches WHERE name = ?`
+
+	savedSearchesSQL = `SELECT name, query FROM saved_searches ORDER BY name`
+)
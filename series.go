@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	// isbnPages is the number of pages at the start and at the end of the text searched for ISBNs
+	isbnPages = 5
+
+	// minSeriesKeyWords is the number of words of a title needed to compare it with other titles.
+	// Shorter titles, like the name of a publisher, are shared by unrelated pdfs.
+	minSeriesKeyWords = 2
+)
+
+var (
+	isbnPattern = regexp.MustCompile(`(?i)\bISBN(?:-1[03])?:?\s*([0-9][0-9 -]{8,15}[0-9X])\b`)
+
+	// editionMarker matches the parts of a title that differ between volumes and editions
+	editionMarker = regexp.MustCompile(`(?i)(\b\d+(st|nd|rd|th)\s+ed(ition|\.)?|\b(first|second|third|fourth|fifth|sixth|seventh|eighth|ninth|tenth|revised|updated|expanded)\s+edition|\bed(ition|\.)\s*\d+|\b(vol(ume|\.)?|part|book|tome)\s*([0-9]+|[ivxlc]+)\b)`)
+	nonAlnum      = regexp.MustCompile(`[^\pL\pN]+`)
+
+	// frontMatter are the guessed titles of pdfs whose first line is not their title
+	frontMatter = map[string]bool{
+		"contents": true, "table of contents": true, "preface": true, "foreword": true,
+		"copyright": true, "all rights reserved": true, "title page": true, "half title": true,
+		"front matter": true, "acknowledgments": true, "acknowledgements": true,
+		"this page intentionally left blank": true, "lecture notes": true, "course notes": true,
+	}
+)
+
+// findISBNs returns the valid ISBNs found in the first and last pages of a pdf,
+// converted to ISBN-13 and separated by spaces
+func findISBNs(pages []string) string {
+	var candidates []string
+	for i, page := range pages {
+		if i >= isbnPages && i < len(pages)-isbnPages {
+			continue
+		}
+		for _, m := range isbnPattern.FindAllStringSubmatch(page, -1) {
+			candidates = append(candidates, m[1])
+		}
+	}
+
+	var isbns []string
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		isbn := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(c))
+		if len(isbn) == 10 && validISBN10(isbn) {
+			isbn = isbn10To13(isbn)
+		} else if len(isbn) != 13 || !validISBN13(isbn) {
+			continue
+		}
+		if !seen[isbn] {
+			seen[isbn] = true
+			isbns = append(isbns, isbn)
+		}
+	}
+	return strings.Join(isbns, " ")
+}
+
+func validISBN10(isbn string) bool {
+	sum := 0
+	for i, r := range isbn {
+		d := int(r - '0')
+		if r == 'X' && i == 9 {
+			d = 10
+		} else if d < 0 || d > 9 {
+			return false
+		}
+		sum += (10 - i) * d
+	}
+	return sum%11 == 0
+}
+
+func validISBN13(isbn string) bool {
+	sum := 0
+	for i, r := range isbn {
+		d := int(r - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func isbn10To13(isbn string) string {
+	isbn = "978" + isbn[:9]
+	sum := 0
+	for i, r := range isbn {
+		d := int(r - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return fmt.Sprintf("%s%d", isbn, (10-sum%10)%10)
+}
+
+// seriesKey returns the title without volume and edition markers, to compare the
+// titles of the volumes and editions of a work. It returns an empty key for titles
+// too short or too common to identify a work.
+func seriesKey(title string) string {
+	key := editionMarker.ReplaceAllString(strings.ToLower(title), " ")
+	key = strings.TrimSpace(nonAlnum.ReplaceAllString(key, " "))
+	if len(strings.Fields(key)) < minSeriesKeyWords || frontMatter[key] {
+		return ""
+	}
+	return key
+}
+
+// groupSeries groups entries that look like volumes or editions of the same work: their
+// titles are the same except for volume and edition markers, or they share an ISBN.
+// An ISBN prefix identifies a publisher, not a work, so ISBNs must match exactly.
+// Groups are returned in the order of their first entry.
+func groupSeries(entries []listEntry) [][]listEntry {
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		if ri, rj := find(i), find(j); ri != rj {
+			if ri < rj {
+				parent[rj] = ri
+			} else {
+				parent[ri] = rj
+			}
+		}
+	}
+
+	byKey := make(map[string]int)
+	for i, e := range entries {
+		if key := seriesKey(e.title); key != "" {
+			if j, ok := byKey[key]; ok {
+				union(i, j)
+			} else {
+				byKey[key] = i
+			}
+		}
+		for _, isbn := range strings.Fields(e.isbn) {
+			key := "isbn:" + isbn
+			if j, ok := byKey[key]; ok {
+				union(i, j)
+			} else {
+				byKey[key] = i
+			}
+		}
+	}
+
+	var groups [][]listEntry
+	index := make(map[int]int)
+	for i, e := range entries {
+		root := find(i)
+		if g, ok := index[root]; ok {
+			groups[g] = append(groups[g], e)
+		} else {
+			index[root] = len(groups)
+			groups = append(groups, []listEntry{e})
+		}
+	}
+	return groups
+}
+
+// writeGroups writes to w the groups of entries. Groups with more than one entry are
+// written under the title of their first entry.
+func writeGroups(w io.Writer, groups [][]listEntry, showKeywords bool) {
+	for _, g := range groups {
+		if len(g) == 1 {
+			g[0].write(w, "", showKeywords)
+			continue
+		}
+		fmt.Fprintf(w, "%s (%d volumes or editions)\n", g[0].title, len(g))
+		for _, e := range g {
+			e.write(w, "  ", showKeywords)
+		}
+	}
+}
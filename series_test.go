@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindISBNs(t *testing.T) {
+	tests := []struct {
+		pages []string
+		want  string
+	}{
+		{[]string{"ISBN 0-13-110362-8"}, "9780131103627"},
+		{[]string{"ISBN-13: 978-0-13-110362-7\nISBN-10: 0131103628"}, "9780131103627"},
+		{[]string{"ISBN 0-13-110362-9"}, ""},
+		{[]string{"isbn: 0-8044-2957-X"}, "9780804429573"},
+		{[]string{"Call 978-0-13-110362-7"}, ""},
+	}
+	for _, tt := range tests {
+		if got := findISBNs(tt.pages); got != tt.want {
+			t.Errorf("findISBNs(%q) = %q, want %q", tt.pages, got, tt.want)
+		}
+	}
+}
+
+func TestISBN10(t *testing.T) {
+	tests := []struct {
+		isbn   string
+		valid  bool
+		isbn13 string
+	}{
+		{"0131103628", true, "9780131103627"},
+		{"080442957X", true, "9780804429573"},
+		{"0131103629", false, ""},
+		{"01311036X8", false, ""},
+	}
+	for _, tt := range tests {
+		if got := validISBN10(tt.isbn); got != tt.valid {
+			t.Errorf("validISBN10(%q) = %v, want %v", tt.isbn, got, tt.valid)
+		}
+		if tt.valid {
+			if got := isbn10To13(tt.isbn); got != tt.isbn13 {
+				t.Errorf("isbn10To13(%q) = %q, want %q", tt.isbn, got, tt.isbn13)
+			}
+			if !validISBN13(tt.isbn13) {
+				t.Errorf("validISBN13(%q) = false", tt.isbn13)
+			}
+		}
+	}
+}
+
+func TestGroupSeries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []listEntry
+		want    [][]int
+	}{
+		{
+			name: "volumes",
+			entries: []listEntry{
+				{id: 1, title: "The Art of Computer Programming Volume 1"},
+				{id: 2, title: "Compilers"},
+				{id: 3, title: "The Art of Computer Programming, Vol. 3"},
+			},
+			want: [][]int{{1, 3}, {2}},
+		},
+		{
+			name: "editions",
+			entries: []listEntry{
+				{id: 1, title: "Operating System Concepts, 9th Edition"},
+				{id: 2, title: "Operating System Concepts Second Edition"},
+			},
+			want: [][]int{{1, 2}},
+		},
+		{
+			name: "same publisher block",
+			entries: []listEntry{
+				{id: 1, title: "The C Programming Language", isbn: "9780131103627"},
+				{id: 2, title: "Unix Network Programming", isbn: "9780131411555"},
+				{id: 3, title: "A Scan", isbn: "9780131103627"},
+			},
+			want: [][]int{{1, 3}, {2}},
+		},
+		{
+			name: "front matter and short titles",
+			entries: []listEntry{
+				{id: 1, title: "Contents"},
+				{id: 2, title: "Contents"},
+				{id: 3, title: "Springer"},
+				{id: 4, title: "Springer"},
+				{id: 5, title: "Table of Contents"},
+				{id: 6, title: "Table of Contents"},
+			},
+			want: [][]int{{1}, {2}, {3}, {4}, {5}, {6}},
+		},
+	}
+	for _, tt := range tests {
+		var got [][]int
+		for _, g := range groupSeries(tt.entries) {
+			var ids []int
+			for _, e := range g {
+				ids = append(ids, e.id)
+			}
+			got = append(got, ids)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: groupSeries = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+//go:build fts5
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// server serves the search of the db over http to browsers, that can add it as a search
+// engine with OpenSearch
+type server struct {
+	announce string   // the url of the server for its clients, like http://nas:8080 or https://example.com/booklice
+	basePath string   // the path under which a reverse proxy serves the server, like /booklice, empty for the root
+	resolve  string   // the url prefix of the pdf files, the path of a pdf is appended to it. If empty the server serves them
+	feedSize int      // the number of pdfs in the feed of the pdfs added last
+	uploads  *uploads // the uploaded pdfs, nil if the server does not accept uploads
+	pdfjs    string   // the dir of pdf.js to read the pdfs with, if empty the viewer of the browser is used
+
+	queryTimeout time.Duration // how long the queries of a request may take, 0 for no limit
+	limiter      *rateLimiter  // the limit of the requests of each client, nil for no limit
+	expensive    chan struct{} // the slots of the expensive operations, like rendering covers and uploads
+	corsOrigins  []string      // the origins of the pages that may call the api, * for any
+	accessLog    *accessLog    // where the requests are logged, nil for nowhere
+
+	templates *template.Template // the pages of the web ui, see loadTemplates
+	static    http.Handler       // the static files of the web ui
+
+	metrics  *requestMetrics // the requests served, written at /metrics
+	searches atomic.Int64    // the searches run by the web ui, the api and OPDS
+}
+
+// serveOptions are how serve listens
+type serveOptions struct {
+	listen       string // the address to listen on, see listen
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	tlsCert      string // the file of the tls certificate, if empty the server serves http
+	tlsKey       string // the file of the key of the tls certificate
+}
+
+// serve runs a server as set by opts until ctx is done or SIGTERM or SIGINT is received.
+// Then it waits for the requests in flight to finish.
+func serve(ctx context.Context, s *server, opts serveOptions) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := listen(opts.listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:      s.routes(),
+		ReadTimeout:  opts.readTimeout,
+		WriteTimeout: opts.writeTimeout,
+		TLSConfig:    &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if opts.tlsCert != "" {
+			errc <- srv.ServeTLS(ln, opts.tlsCert, opts.tlsKey)
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+	log.Printf("serving on %s as %s", ln.Addr(), s.announce)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// routes returns the handler of all the pages of s
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleBrowse)
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/pdf/", s.handlePDF)
+	mux.HandleFunc("/opensearch.xml", s.handleOpenSearch)
+	mux.Handle("/static/", s.static)
+	mux.HandleFunc("/doc/", s.handleDoc)
+	mux.HandleFunc("/read/", s.handleRead)
+	if s.pdfjs != "" {
+		pdfjs := http.StripPrefix("/pdfjs/", http.FileServer(http.Dir(s.pdfjs)))
+		mux.Handle("/pdfjs/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+			pdfjs.ServeHTTP(w, r)
+		}))
+	}
+	mux.HandleFunc("/cover/", s.handleCover)
+	mux.HandleFunc("/api/search", s.handleAPISearch)
+	mux.HandleFunc("/api/docs/", s.handleAPIDoc)
+	mux.HandleFunc("/api/tags", s.handleAPITags)
+	mux.HandleFunc("/feed.xml", s.handleFeed)
+	mux.HandleFunc("/upload", s.handleUpload)
+	mux.HandleFunc("/upload/", s.handleUploadStatus)
+	mux.HandleFunc("/opds", s.handleOPDSRoot)
+	mux.HandleFunc("/opds/new", s.handleOPDSNew)
+	mux.HandleFunc("/opds/search", s.handleOPDSSearch)
+	mux.HandleFunc("/opds/opensearch.xml", s.handleOPDSOpenSearch)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	// the progress stream lasts as long as the client wants, so it has no query timeout
+	root := http.NewServeMux()
+	root.Handle("/", withTimeout(mux, s.queryTimeout))
+	root.HandleFunc("/progress", s.handleProgress)
+	s.metrics = newRequestMetrics(func(r *http.Request) string {
+		if _, p := root.Handler(r); p != "/" {
+			return p
+		}
+		_, p := mux.Handler(r)
+		return p
+	})
+	h := s.metrics.measure(withGzip(s.cors(root)))
+	if s.basePath != "" {
+		h = s.underBasePath(h)
+	}
+	if s.limiter != nil {
+		h = s.limiter.limit(h)
+	}
+	if s.accessLog != nil {
+		h = s.accessLog.log(h)
+	}
+	return h
+}
+
+// underBasePath serves with h the paths under the base path, without it
+func (s *server) underBasePath(h http.Handler) http.Handler {
+	strip := http.StripPrefix(s.basePath, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == s.basePath {
+			http.Redirect(w, r, s.basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, s.basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		strip.ServeHTTP(w, r)
+	})
+}
+
+// acquire waits for a slot for an expensive operation and returns the func that frees it.
+// It returns false if r is canceled or times out first.
+func (s *server) acquire(r *http.Request) (func(), bool) {
+	if s.expensive == nil {
+		return func() {}, true
+	}
+	select {
+	case s.expensive <- struct{}{}:
+		return func() { <-s.expensive }, true
+	case <-r.Context().Done():
+		return nil, false
+	}
+}
+
+// handleOpenSearch writes the OpenSearch description of the server
+func (s *server) handleOpenSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	fmt.Fprintf(w, openSearchXML, html.EscapeString(s.announce+"/search"), "text/html")
+}
+
+// handleMetrics writes in the Prometheus text format the metrics of the requests, the
+// searches, the index and the uploads
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var pdfs, pages, trashed int64
+	if err := db.QueryRowContext(r.Context(), indexSizeSQL).Scan(&pdfs, &pages, &trashed); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	var size int64
+	for _, suffix := range []string{"", "-wal"} {
+		if fi, err := os.Stat(databasePath + suffix); err == nil {
+			size += fi.Size()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w)
+	writeMetric(w, "booklice_searches_total", "counter", "The searches run by the web ui, the api and OPDS.", float64(s.searches.Load()))
+	writeMetric(w, "booklice_index_pdfs", "gauge", "The pdfs in the index, without the trash.", float64(pdfs))
+	writeMetric(w, "booklice_index_pages", "gauge", "The pages of the pdfs in the index.", float64(pages))
+	writeMetric(w, "booklice_index_trashed_pdfs", "gauge", "The pdfs in the trash.", float64(trashed))
+	writeMetric(w, "booklice_index_size_bytes", "gauge", "The size of the database file and its write ahead log.", float64(size))
+	if s.uploads == nil {
+		return
+	}
+	statuses := map[string]int{}
+	for _, j := range s.uploads.list() {
+		statuses[j.Status]++
+	}
+	writeMetric(w, "booklice_uploads_queued", "gauge", "The uploaded pdfs waiting to be added.", float64(statuses["queued"]+statuses["adding"]))
+	metricHeader(w, "booklice_uploads_total", "counter", "The uploaded pdfs, by how adding them went.")
+	for _, st := range []string{"added", "duplicate", "failed"} {
+		fmt.Fprintf(w, "booklice_uploads_total{status=%s} %d\n", labelValue(st), statuses[st])
+	}
+}
+
+// handleDoc writes the pdf with the id in the path /doc/{id}. The file at the stored path
+// is written, or the stored original if the file is missing. Range requests are supported.
+func (s *server) handleDoc(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/doc/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var (
+		path, sig string
+		stored    bool
+	)
+	err = db.QueryRowContext(r.Context(), docSQL, id).Scan(&path, &sig, &stored)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filepath.Base(path)}))
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			http.ServeContent(w, r, path, fi.ModTime(), f)
+			return
+		}
+	}
+	if !stored {
+		http.Error(w, fmt.Sprintf("the file of pdf %d is missing", id), http.StatusNotFound)
+		return
+	}
+	if cached(w, r, sig) {
+		return
+	}
+	var data []byte
+	if err := db.QueryRowContext(r.Context(), originalSQL, id).Scan(&data); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	http.ServeContent(w, r, path, time.Time{}, bytes.NewReader(data))
+}
+
+// handleCover writes the cover of the pdf with the id in the path /cover/{id} as a jpeg.
+// The single page pdf covers of older indexes are rendered with ghostscript.
+func (s *server) handleCover(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/cover/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveCover(w, r, id)
+}
+
+// serveCover writes the cover of the pdf with id
+func (s *server) serveCover(w http.ResponseWriter, r *http.Request, id int) {
+	var sig string
+	err := db.QueryRowContext(r.Context(), sigSQL, id).Scan(&sig)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if cached(w, r, sig) {
+		return
+	}
+	data, _, err := loadCover(r.Context(), id)
+	if errors.Is(err, errNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if coverExt(data) == ".pdf" {
+		release, ok := s.acquire(r)
+		if !ok {
+			serverError(w, r, r.Context().Err())
+			return
+		}
+		defer release()
+		pdf := PDF{path: fmt.Sprintf("cover of %d", id), data: data}
+		if data, err = pdf.Cover(r.Context()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// cached sets the validators of a response that depends only on the pdf with sig, and
+// writes 304 Not Modified and returns true if the client has it already
+func cached(w http.ResponseWriter, r *http.Request, sig string) bool {
+	etag := `"` + sig + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if t = strings.TrimSpace(t); t == etag || t == "W/"+etag || t == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// link returns the url of the pdf of r
+func (s *server) link(r searchResult) string {
+	if s.resolve == "" {
+		return "/doc/" + strconv.Itoa(r.ID)
+	}
+	u := url.URL{Path: r.Path}
+	return strings.TrimSuffix(s.resolve, "/") + u.EscapedPath()
+}
+
+// href returns the link u of the server as written in pages, under the base path
+func (s *server) href(u string) string {
+	if strings.HasPrefix(u, "/") {
+		return s.basePath + u
+	}
+	return u
+}
+
+// absURL returns the absolute url of the link u of the server
+func (s *server) absURL(u string) string {
+	if strings.HasPrefix(u, "/") {
+		return s.announce + u
+	}
+	return u
+}
+
+// serverError logs err and writes an internal server error, or a gateway timeout if
+// the request took longer than the query timeout
+func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("%s: %v", r.URL, err)
+	status := http.StatusInternalServerError
+	if timedOut(r) {
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// timedOut reports whether r took longer than the query timeout
+func timedOut(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.DeadlineExceeded)
+}
+
+// withTimeout cancels the queries of the requests to h that take longer than timeout
+func withTimeout(h http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+const (
+	docSQL = `SELECT path, sig, EXISTS(SELECT 1 FROM originals WHERE pdf_id = pdfs.id) FROM pdfs WHERE id = ? AND ` + liveSQL
+
+	sigSQL = `SELECT sig FROM pdfs WHERE id = ? AND ` + liveSQL
+
+	indexSizeSQL = `SELECT COUNT(*) FILTER (WHERE ` + liveSQL + `), IFNULL(SUM(pages) FILTER (WHERE ` + liveSQL + `), 0), ` +
+		`COUNT(*) FILTER (WHERE NOT ` + liveSQL + `) FROM pdfs`
+)
+
+const openSearchXML = `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+<ShortName>booklice</ShortName>
+<Description>Full text search of pdfs</Description>
+<InputEncoding>UTF-8</InputEncoding>
+<Url type="%[2]s" method="get" template="%[1]s?q={searchTerms}"/>
+</OpenSearchDescription>
+`
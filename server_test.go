@@ -0,0 +1,66 @@
+//go:build fts5
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServerPDFPages(t *testing.T) {
+	openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	dir := t.TempDir()
+	for i, name := range []string{"go", "trashed"} {
+		path := filepath.Join(dir, name+".pdf")
+		cover := filepath.Join(dir, name+".jpg")
+		for p, data := range map[string]string{path: "%PDF-1.4 " + name, cover: "\xff\xd8\xff " + name} {
+			if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := insertStmt.Exec(path, 2, fmt.Sprint("sig", i), "Go is a language\fabout channels", nil, "2024-03-01T10:00:00Z", "The Go Programming Language", "", "", "go channels", "", nil, "", cover, "add", "Donovan, Alan", "SHA256E-s1--abc.pdf"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE pdfs SET deleted_at = '2024-03-02T10:00:00Z' WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{announce: "http://localhost:8080"}
+	if err := s.loadTemplates(""); err != nil {
+		t.Fatal(err)
+	}
+	h := s.routes()
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/pdf/1", http.StatusOK, "Donovan, Alan"},
+		{"/read/1?q=channels", http.StatusOK, "#page=2"},
+		{"/api/docs/1", http.StatusOK, `"authors": "Donovan, Alan"`},
+		{"/doc/1", http.StatusOK, "%PDF-1.4 go"},
+		{"/cover/1", http.StatusOK, "\xff\xd8\xff go"},
+		{"/pdf/2", http.StatusNotFound, ""},
+		{"/read/2", http.StatusNotFound, ""},
+		{"/api/docs/2", http.StatusNotFound, ""},
+		{"/doc/2", http.StatusNotFound, ""},
+		{"/cover/2", http.StatusNotFound, ""},
+		{"/pdf/3", http.StatusNotFound, ""},
+		{"/doc/3", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("GET %s = %d %q, want %d with %q", tt.path, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+//go:build fts5
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// siteDoc is a pdf of a static site
+type siteDoc struct {
+	ID       int
+	Path     string
+	Title    string
+	Authors  string
+	Pages    int
+	Keywords []string
+	ISBN     string
+	Abstract string
+	TOC      []string
+	AddedAt  string
+	Cover    string // the path of the cover in the site, if any
+	File     string // the path of the pdf in the site, if copied
+}
+
+// Name returns the title of the pdf, or the name of its file if it has none
+func (d siteDoc) Name() string {
+	if d.Title != "" {
+		return d.Title
+	}
+	return filepath.Base(d.Path)
+}
+
+// sitePage is the data of the templates of the site
+type sitePage struct {
+	Root string // the relative path to the root of the site, like ../
+	Docs []siteDoc
+	Doc  siteDoc
+}
+
+// exportSite writes to dir a static site of the pdfs that are not in the trash: an index
+// page with their covers and titles, that a script filters by the words of the titles,
+// authors and keywords, and a page for each pdf. If files, the pdf files, or their stored
+// originals, are copied to the site too.
+func exportSite(ctx context.Context, dir string, files bool) error {
+	t, err := template.ParseFS(webFiles, "web/site/*.tmpl")
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{"pdf", "covers", "static", "files"} {
+		if sub == "files" && !files {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+
+	docs, err := siteDocs(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range docs {
+		d := &docs[i]
+		name, err := writeCover(ctx, filepath.Join(dir, "covers"), d.ID)
+		if err != nil {
+			log.Printf("cover error %d: %v", d.ID, err)
+		} else {
+			d.Cover = "covers/" + name
+		}
+		if files {
+			if d.File, err = exportFile(dir, d.ID, d.Path); err != nil {
+				log.Printf("file error %d: %v", d.ID, err)
+			}
+		}
+	}
+	for _, d := range docs {
+		if err := writeTemplate(t, "site-pdf", filepath.Join(dir, "pdf", strconv.Itoa(d.ID)+".html"), sitePage{Root: "../", Doc: d}); err != nil {
+			return err
+		}
+	}
+	if err := writeTemplate(t, "site-index", filepath.Join(dir, "index.html"), sitePage{Docs: docs}); err != nil {
+		return err
+	}
+
+	index, err := json.Marshal(map[string]interface{}{"terms": siteIndex(docs)})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "static", "index.js"), append(append([]byte("var bookliceIndex = "), index...), ";\n"...), 0644); err != nil {
+		return err
+	}
+	for name, src := range map[string]string{"style.css": "web/static/style.css", "search.js": "web/site/search.js"} {
+		data, err := webFiles.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "static", name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// siteDocs returns the pdfs that are not in the trash, the newest first
+func siteDocs(ctx context.Context) ([]siteDoc, error) {
+	rows, err := db.QueryContext(ctx, siteSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var docs []siteDoc
+	for rows.Next() {
+		var (
+			d        siteDoc
+			kws, toc string
+		)
+		if err := rows.Scan(&d.ID, &d.Path, &d.Title, &d.Authors, &d.Pages, &kws, &d.ISBN, &d.Abstract, &toc, &d.AddedAt); err != nil {
+			return nil, err
+		}
+		d.Keywords = strings.Fields(kws)
+		if toc != "" {
+			d.TOC = strings.Split(toc, "\n")
+		}
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// writeCover writes the cover of the pdf with id to dir, named by the id, and returns the
+// name of the file
+func writeCover(ctx context.Context, dir string, id int) (string, error) {
+	data, _, err := loadCover(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if coverExt(data) == ".pdf" {
+		pdf := PDF{path: fmt.Sprintf("cover of %d", id), data: data}
+		if data, err = pdf.Cover(ctx); err != nil {
+			return "", err
+		}
+	}
+	name := strconv.Itoa(id) + coverExt(data)
+	return name, os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+// exportFile copies the pdf with id at path, or its stored original if the file is
+// missing, to the files dir of the site in dir and returns its path in the site
+func exportFile(dir string, id int, path string) (string, error) {
+	name := "files/" + strconv.Itoa(id) + ".pdf"
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+	src, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		var data []byte
+		if err := db.QueryRow(originalSQL, id).Scan(&data); err != nil {
+			return "", fmt.Errorf("%s is missing and not stored", path)
+		}
+		return name, os.WriteFile(dst, data, 0644)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return "", err
+	}
+	return name, f.Close()
+}
+
+// writeTemplate writes the template name of t with page to the file at path
+func writeTemplate(t *template.Template, name, path string, page sitePage) error {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, page); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// siteIndex returns the ids of docs by the words of their titles, authors and keywords,
+// lowercase, for the search of the site
+func siteIndex(docs []siteDoc) map[string][]int {
+	index := make(map[string][]int)
+	for _, d := range docs {
+		seen := make(map[string]bool)
+		text := d.Name() + " " + d.Authors + " " + strings.Join(d.Keywords, " ")
+		for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+			if len([]rune(w)) < 2 || seen[w] {
+				continue
+			}
+			seen[w] = true
+			index[w] = append(index[w], d.ID)
+		}
+	}
+	return index
+}
+
+const siteSQL = `SELECT id, path, IFNULL(title, ''), IFNULL(authors, ''), pages, IFNULL(keywords, ''), IFNULL(isbn, ''), IFNULL(abstract, ''), ` +
+	`IFNULL(toc, ''), added_at FROM pdfs WHERE ` + liveSQL + ` ORDER BY id DESC`
@@ -0,0 +1,24 @@
+//go:build fts5
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSiteIndex(t *testing.T) {
+	docs := []siteDoc{
+		{ID: 1, Title: "The Go Programming Language", Authors: "Donovan, Alan & Kernighan, Brian", Keywords: []string{"go", "channels"}},
+		{ID: 2, Path: "/pdfs/Über-Go.pdf", Keywords: []string{"compilers"}},
+		{ID: 3, Title: "C++ in 7 days", Keywords: []string{"c++"}},
+	}
+	want := map[string][]int{
+		"the": {1}, "go": {1, 2}, "programming": {1}, "language": {1}, "donovan": {1}, "alan": {1},
+		"kernighan": {1}, "brian": {1}, "channels": {1}, "über": {2}, "pdf": {2}, "compilers": {2},
+		"in": {3}, "days": {3},
+	}
+	if got := siteIndex(docs); !reflect.DeepEqual(got, want) {
+		t.Errorf("siteIndex() = %v, want %v", got, want)
+	}
+}
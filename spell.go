@@ -0,0 +1,141 @@
+//go:build fts5
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// queryWord matches the words of a query that may be misspelled. Operators and column
+// names are matched too and skipped by correctQuery.
+var queryWord = regexp.MustCompile(`[\pL\pN_]+`)
+
+// correctQuery returns query with each word not in the index replaced by the most frequent
+// word of the index at the smallest edit distance, if any is close enough. It returns
+// query unchanged if no word needs correction.
+func correctQuery(query string) (string, error) {
+	var err error
+	corrected := queryWord.ReplaceAllStringFunc(query, func(word string) string {
+		if err != nil || isQueryKeyword(word) {
+			return word
+		}
+		var s string
+		s, err = correctWord(word)
+		return s
+	})
+	return corrected, err
+}
+
+// isQueryKeyword reports whether word is an fts5 operator or a column name
+func isQueryKeyword(word string) bool {
+	switch word {
+	case "AND", "OR", "NOT", "NEAR":
+		return true
+	}
+	return indexOf(rankColumns, word) >= 0
+}
+
+// correctWord returns the word of the index closest to word, or word if it is in the index
+// or no word is close enough
+func correctWord(word string) (string, error) {
+	if n, err := documentFrequency(word); err != nil || n > 0 {
+		return word, err
+	}
+	lower := []rune(strings.ToLower(word))
+	maxDist := maxEditDistance(len(lower))
+	if maxDist == 0 {
+		return word, nil
+	}
+
+	rows, err := db.Query(vocabSQL, len(lower)-maxDist, len(lower)+maxDist)
+	if err != nil {
+		return word, err
+	}
+	defer rows.Close()
+	best, bestDist, bestDocs := word, maxDist+1, 0
+	for rows.Next() {
+		var (
+			term string
+			docs int
+		)
+		if err := rows.Scan(&term, &docs); err != nil {
+			return word, err
+		}
+		d := editDistance(lower, []rune(term))
+		if d < bestDist || (d == bestDist && docs > bestDocs) {
+			best, bestDist, bestDocs = term, d, docs
+		}
+	}
+	return best, rows.Err()
+}
+
+// maxEditDistance returns the most edits a misspelled word of n letters may have
+func maxEditDistance(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+// editDistance returns the optimal string alignment distance of a and b, that is the number
+// of insertions, deletions, substitutions and transpositions of adjacent letters that turn
+// a into b, with no substring edited twice
+func editDistance(a, b []rune) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && prev2[j-2]+1 < cur[j] {
+				cur[j] = prev2[j-2] + 1
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+// suggest returns at most n words of the index that start with prefix, the ones found in
+// most pdfs first
+func suggest(prefix string, n int) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	rows, err := db.Query(suggestSQL, prefix, prefix+"\uffff", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var terms []string
+	for rows.Next() {
+		var term string
+		if err := rows.Scan(&term); err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	return terms, rows.Err()
+}
+
+const (
+	vocabSQL = `SELECT term, doc FROM pdfs_vocab WHERE length(term) BETWEEN ? AND ?`
+
+	suggestSQL = `SELECT term FROM pdfs_vocab WHERE term >= ? AND term < ? ORDER BY doc DESC, term LIMIT ?`
+)
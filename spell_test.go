@@ -0,0 +1,92 @@
+//go:build fts5
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"dijsktra", "dijkstra", 1},
+		{"kitten", "sitting", 3},
+		{"café", "cafe", 1},
+		{"ca", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCorrectQuery(t *testing.T) {
+	openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	for i, text := range []string{"dijkstra shortest paths", "dijkstra on goto", "graph algorithms"} {
+		if _, err := insertStmt.Exec(fmt.Sprintf("/doc%d.pdf", i), 1, fmt.Sprint(i), text, nil, "", "", "", "", "", "", nil, "", "", "add", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"dijkstra", "dijkstra"},
+		{"Dijsktra", "dijkstra"},
+		{"Dijsktra AND grahp", "dijkstra AND graph"},
+		{"text : algoritms", "text : algorithms"},
+		{"\"shortest pahts\"", "\"shortest paths\""},
+		{"xyzzy", "xyzzy"},
+		{"gto", "gto"},
+	}
+	for _, tt := range tests {
+		got, err := correctQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("correctQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	for i, text := range []string{"graph grammar", "graph", "grapes"} {
+		if _, err := insertStmt.Exec(fmt.Sprintf("/doc%d.pdf", i), 1, fmt.Sprint(i), text, nil, "", "", "", "", "", "", nil, "", "", "add", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		n      int
+		want   string
+	}{
+		{"gra", 10, "graph grammar grapes"},
+		{"Grap", 1, "graph"},
+		{"x", 10, ""},
+	}
+	for _, tt := range tests {
+		terms, err := suggest(tt.prefix, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(terms, " "); got != tt.want {
+			t.Errorf("suggest(%q, %d) = %q, want %q", tt.prefix, tt.n, got, tt.want)
+		}
+	}
+}
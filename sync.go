@@ -0,0 +1,260 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syncStats are the changes of a sync in one direction
+type syncStats struct {
+	pdfs      int64 // copied
+	trash     int64 // moved to or out of the trash
+	originals int64 // stored files copied
+}
+
+// syncDatabase merges the db and the database at path, that is migrated first. The pdfs
+// of each, by signature, missing from the other are copied to it, with their covers and,
+// if files, their stored files. A pdf trashed or restored in one is trashed or restored
+// in the other if that was its latest change, and so are saved searches. If pull, only
+// the db is changed. The changes are written to w with name for the database.
+func syncDatabase(ctx context.Context, path, name string, pull, files bool, w io.Writer) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	other, err := sql.Open(driverName, databaseDSN(path))
+	if err != nil {
+		return err
+	}
+	err = migrate(other)
+	other.Close()
+	if err != nil {
+		return fmt.Errorf("can't migrate schema of %s: %w", path, err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE "+sqlQuote(path)+" AS sync"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE sync")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	in, err := syncInto(tx, "main", "sync", files)
+	if err != nil {
+		return err
+	}
+	var out syncStats
+	if !pull {
+		if out, err = syncInto(tx, "sync", "main", files); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "from %s: %d pdfs, %d trash changes, %d stored files\n", name, in.pdfs, in.trash, in.originals)
+	if !pull {
+		fmt.Fprintf(w, "to %s: %d pdfs, %d trash changes, %d stored files\n", name, out.pdfs, out.trash, out.originals)
+	}
+	return nil
+}
+
+// syncInto copies the changes of the database src to dst, both schemas of tx
+func syncInto(tx *sql.Tx, dst, src string, files bool) (syncStats, error) {
+	var stats syncStats
+	q := func(query string) string {
+		return strings.NewReplacer("dst.", dst+".", "src.", src+".").Replace(query)
+	}
+
+	var last int
+	if err := tx.QueryRow(q(syncLastIDSQL)).Scan(&last); err != nil {
+		return stats, err
+	}
+	if _, err := tx.Exec(q(syncCoversSQL)); err != nil {
+		return stats, err
+	}
+	res, err := tx.Exec(q(syncPDFsSQL))
+	if err != nil {
+		return stats, err
+	}
+	if stats.pdfs, err = res.RowsAffected(); err != nil {
+		return stats, err
+	}
+	if err := syncCoverFiles(tx, q, last); err != nil {
+		return stats, err
+	}
+	if _, err := tx.Exec(q(syncEventsSQL), formatTimestamp(time.Now()), hostname, last); err != nil {
+		return stats, err
+	}
+
+	if res, err = tx.Exec(q(syncTrashSQL), last); err != nil {
+		return stats, err
+	}
+	if stats.trash, err = res.RowsAffected(); err != nil {
+		return stats, err
+	}
+	if _, err := tx.Exec(q(syncSavedSearchesSQL)); err != nil {
+		return stats, err
+	}
+	if files {
+		if res, err = tx.Exec(q(syncOriginalsSQL)); err != nil {
+			return stats, err
+		}
+		if stats.originals, err = res.RowsAffected(); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// syncCoverFiles stores in the covers table the covers of the pdfs copied after last
+// that the other database kept as files. Covers that can't be read are dropped, the
+// files are on another machine or in its covers dir.
+func syncCoverFiles(tx *sql.Tx, q func(string) string, last int) error {
+	rows, err := tx.Query(q(syncCoverPathsSQL), last)
+	if err != nil {
+		return err
+	}
+	paths := make(map[int]string)
+	for rows.Next() {
+		var (
+			id   int
+			path string
+		)
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return err
+		}
+		paths[id] = path
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, path := range paths {
+		var hash sql.NullString
+		if cover, err := os.ReadFile(path); err == nil {
+			hash.String, hash.Valid = coverHash(cover), true
+			if _, err := tx.Exec(q(syncInsertCoverSQL), hash, cover); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(q(syncSetCoverSQL), hash, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncRemote syncs the db with the database name of booklice on host over ssh. A snapshot
+// of the remote database is copied here with scp and synced with the db, and then copied
+// back and pulled into the remote database by the booklice there.
+func syncRemote(ctx context.Context, host, name string, pull, files bool, w io.Writer) error {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	remoteTmp := "/tmp/booklice-sync-" + hex.EncodeToString(b[:]) + ".db"
+	dir, err := os.MkdirTemp("", "booklice-sync")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	localTmp := filepath.Join(dir, "remote.db")
+
+	defer runCommand(context.Background(), "ssh", host, "rm -f "+shellQuote(remoteTmp))
+	if err := runCommand(ctx, "ssh", host, progName+" -n "+shellQuote(name)+" db backup "+shellQuote(remoteTmp)); err != nil {
+		return err
+	}
+	if err := runCommand(ctx, "scp", "-q", host+":"+remoteTmp, localTmp); err != nil {
+		return err
+	}
+	if err := syncDatabase(ctx, localTmp, host+":"+name, pull, files, w); err != nil {
+		return err
+	}
+	if pull {
+		return nil
+	}
+	if err := runCommand(ctx, "scp", "-q", localTmp, host+":"+remoteTmp); err != nil {
+		return err
+	}
+	pullFlags := "-pull"
+	if files {
+		pullFlags += " -files"
+	}
+	return runCommand(ctx, "ssh", host, progName+" -n "+shellQuote(name)+" sync "+pullFlags+" "+shellQuote(remoteTmp))
+}
+
+// runCommand runs the command with args and returns its stderr in the error if it fails
+func runCommand(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// shellQuote quotes s for the shell that runs the commands of ssh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// the statements of syncInto copy from the schema src to the schema dst
+const (
+	syncLastIDSQL = `SELECT IFNULL(MAX(id), 0) FROM dst.pdfs`
+
+	syncCoversSQL = `INSERT OR IGNORE INTO dst.covers(hash, data) SELECT hash, data FROM src.covers ` +
+		`WHERE hash IN (SELECT cover_hash FROM src.pdfs WHERE sig NOT IN (SELECT sig FROM dst.pdfs WHERE sig IS NOT NULL))`
+
+	// the cover paths are copied so that syncCoverFiles can read them
+	syncPDFsSQL = `INSERT INTO dst.pdfs(path, pages, sig, text, cover, added_at, title, title_raw, abstract, keywords, isbn, simhash, toc, ` +
+		`cover_path, deleted_at, cover_hash, origin, authors, annex_key) ` +
+		`SELECT path, pages, sig, text, cover, added_at, title, title_raw, abstract, keywords, isbn, simhash, toc, ` +
+		`cover_path, deleted_at, cover_hash, origin, authors, annex_key FROM src.pdfs ` +
+		`WHERE sig NOT IN (SELECT sig FROM dst.pdfs WHERE sig IS NOT NULL) ORDER BY id`
+
+	syncCoverPathsSQL = `SELECT id, cover_path FROM dst.pdfs WHERE id > ? AND cover_path IS NOT NULL`
+
+	syncInsertCoverSQL = `INSERT OR IGNORE INTO dst.covers(hash, data) VALUES(?, ?)`
+
+	syncSetCoverSQL = `UPDATE dst.pdfs SET cover_hash = ?, cover_path = NULL WHERE id = ?`
+
+	syncEventsSQL = `INSERT INTO dst.events(at, host, op, pdf_id, path) SELECT ?, ?, 'sync', id, path FROM dst.pdfs WHERE id > ?`
+
+	// syncTrashSQL trashes or restores the pdfs, that were in dst before the sync, as in
+	// src if they were trashed or restored last in src
+	syncTrashSQL = `UPDATE dst.pdfs SET deleted_at = (SELECT s.deleted_at FROM src.pdfs AS s WHERE s.sig = pdfs.sig LIMIT 1) ` +
+		`WHERE id <= ? AND EXISTS(SELECT 1 FROM src.pdfs AS s WHERE s.sig = pdfs.sig AND s.deleted_at IS NOT pdfs.deleted_at) ` +
+		`AND (SELECT IFNULL(MAX(e.at), '') FROM src.events AS e JOIN src.pdfs AS s ON s.id = e.pdf_id ` +
+		`WHERE s.sig = pdfs.sig AND e.op IN ('remove', 'restore')) > ` +
+		`(SELECT IFNULL(MAX(e.at), '') FROM dst.events AS e WHERE e.pdf_id = pdfs.id AND e.op IN ('remove', 'restore'))`
+
+	syncSavedSearchesSQL = `INSERT INTO dst.saved_searches(name, query, saved_at) SELECT name, query, saved_at FROM src.saved_searches WHERE true ` +
+		`ON CONFLICT(name) DO UPDATE SET query = excluded.query, saved_at = excluded.saved_at WHERE excluded.saved_at > saved_at`
+
+	syncOriginalsSQL = `INSERT INTO dst.originals(pdf_id, data) SELECT d.id, o.data FROM src.originals AS o ` +
+		`JOIN src.pdfs AS s ON s.id = o.pdf_id JOIN dst.pdfs AS d ON d.sig = s.sig ` +
+		`WHERE d.id NOT IN (SELECT pdf_id FROM dst.originals) GROUP BY d.id`
+)
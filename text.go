@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// pageSeparator separates the pages of the stored text
+	pageSeparator = "\f"
+
+	// edgeLines is the number of non blank lines at the top and the bottom of a page checked for headers and footers
+	edgeLines = 3
+
+	// minPagesForHeaders is the minimum number of pages needed to detect running headers and footers
+	minPagesForHeaders = 4
+)
+
+var (
+	// hyphenated matches a word split with a hyphen at the end of a line
+	hyphenated = regexp.MustCompile(`(\pL+)([-\x{00AD}])[ \t]*\r?\n[ \t]*(\p{Ll}+)([[:punct:]]*)[ \t]*`)
+
+	// compound matches the words joined with hyphens on a line, like well-known
+	compound = regexp.MustCompile(`\pL+(?:-\pL+)+`)
+
+	digits     = regexp.MustCompile(`\d+`)
+	pageNumber = regexp.MustCompile(`^([Pp]age\s+)?[-–]?\s*(\d+|[ivxlc]+)\s*[-–]?(\s+of\s+\d+)?$`)
+	roman      = regexp.MustCompile(`^c{0,3}(xc|xl|l?x{0,3})(ix|iv|v?i{0,3})$`)
+)
+
+// romanValues are the values of the roman digits used in page numbers
+var romanValues = map[byte]int{'i': 1, 'v': 5, 'x': 10, 'l': 50, 'c': 100}
+
+// joinPages joins the text of pages to be stored in the index
+func joinPages(pages []string) string {
+	return strings.Join(pages, pageSeparator)
+}
+
+// cleanPages removes running headers, footers and page numbers from the text of pages.
+// A header or footer is a line near the top or the bottom of a page that is repeated,
+// ignoring numbers, on most pages. A page number is a number near the top or the bottom
+// of a page that follows the page sequence, with the numbers of other pages.
+func cleanPages(pages []string) []string {
+	lines := make([][]string, len(pages))
+	counts := make(map[string]int)
+	sequences := make(map[string]int)
+	for i, page := range pages {
+		lines[i] = strings.Split(page, "\n")
+		seen := make(map[string]bool)
+		for _, j := range edgeLineIndexes(lines[i]) {
+			key := lineKey(lines[i][j])
+			if seq, ok := pageSequence(lines[i][j], i); ok {
+				key = seq
+			}
+			if !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+
+	// the page numbers must follow the sequence on most pages
+	numbered := 0
+	for key, n := range counts {
+		if strings.HasPrefix(key, "\x00") && n >= 2 {
+			sequences[key] = n
+			numbered += n
+		}
+	}
+	if numbered <= len(pages)/2 {
+		sequences = nil
+	}
+
+	cleaned := make([]string, len(pages))
+	for i := range pages {
+		drop := make(map[int]bool)
+		for _, j := range edgeLineIndexes(lines[i]) {
+			line := strings.TrimSpace(lines[i][j])
+			if seq, ok := pageSequence(line, i); ok {
+				drop[j] = sequences[seq] > 0
+			} else if len(pages) >= minPagesForHeaders && len(lines[i]) > 2*edgeLines && counts[lineKey(line)] > len(pages)/2 {
+				drop[j] = true
+			}
+		}
+
+		kept := make([]string, 0, len(lines[i]))
+		for j, line := range lines[i] {
+			if !drop[j] {
+				kept = append(kept, line)
+			}
+		}
+		cleaned[i] = strings.Join(kept, "\n")
+	}
+	return cleaned
+}
+
+// pageSequence reports whether line is a page number of the page with index i and
+// returns a key shared by the page numbers of the same sequence. Numbers of the same
+// sequence have the same difference from the index of their page.
+func pageSequence(line string, i int) (string, bool) {
+	m := pageNumber.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return "", false
+	}
+	if n, err := strconv.Atoi(m[2]); err == nil {
+		return fmt.Sprintf("\x00arabic %d", n-i), true
+	}
+	if !roman.MatchString(m[2]) {
+		return "", false
+	}
+	return fmt.Sprintf("\x00roman %d", romanValue(m[2])-i), true
+}
+
+// romanValue returns the value of a valid lowercase roman numeral
+func romanValue(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		v := romanValues[s[i]]
+		if i+1 < len(s) && v < romanValues[s[i+1]] {
+			n -= v
+		} else {
+			n += v
+		}
+	}
+	return n
+}
+
+// dehyphenate joins the words split across line breaks, so that they can be matched
+// by queries. The joined word is kept on the first line. A word split with a soft
+// hyphen is always joined. A word split with a hyphen is joined too, unless the
+// hyphenated word appears elsewhere in the pages, like well-known, or is part of a
+// longer compound, like state-of-the-art, and the hyphen is a real one.
+func dehyphenate(pages []string) []string {
+	compounds := make(map[string]bool)
+	for _, page := range pages {
+		for _, c := range compound.FindAllString(page, -1) {
+			parts := strings.Split(strings.ToLower(c), "-")
+			for j := 1; j < len(parts); j++ {
+				compounds[parts[j-1]+"-"+parts[j]] = true
+			}
+		}
+	}
+
+	joined := make([]string, len(pages))
+	for i, page := range pages {
+		var b strings.Builder
+		last := 0
+		for _, m := range hyphenated.FindAllStringSubmatchIndex(page, -1) {
+			head, hyphen, tail, punct := page[m[2]:m[3]], page[m[4]:m[5]], page[m[6]:m[7]], page[m[8]:m[9]]
+			b.WriteString(page[last:m[0]])
+			b.WriteString(head)
+			inCompound := m[2] > 0 && page[m[2]-1] == '-'
+			if hyphen == "-" && (inCompound || compounds[strings.ToLower(head+"-"+tail)]) {
+				b.WriteString("-")
+			}
+			b.WriteString(tail)
+			b.WriteString(punct)
+			b.WriteString("\n")
+			last = m[1]
+		}
+		b.WriteString(page[last:])
+		joined[i] = strings.ReplaceAll(b.String(), "\u00ad", "")
+	}
+	return joined
+}
+
+// edgeLineIndexes returns the indexes of the first and last non blank lines of a page,
+// at most edgeLines from each side and never more than a quarter of the page.
+func edgeLineIndexes(lines []string) []int {
+	var nonBlank []int
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			nonBlank = append(nonBlank, i)
+		}
+	}
+	n := edgeLines
+	if q := len(nonBlank) / 4; q < n {
+		n = q
+	}
+	if n == 0 && len(nonBlank) > 1 {
+		// a page number is still worth checking on short pages
+		n = 1
+	}
+	if n == 0 {
+		return nonBlank
+	}
+	return append(nonBlank[:n:n], nonBlank[len(nonBlank)-n:]...)
+}
+
+// lineKey normalizes a line so that headers differing only in page numbers compare equal
+func lineKey(line string) string {
+	return digits.ReplaceAllString(strings.Join(strings.Fields(line), " "), "#")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// book returns pages with the body lines and, if set, a header and a footer made by
+// the functions of the page index
+func book(n int, header, footer func(i int) string) []string {
+	pages := make([]string, n)
+	for i := range pages {
+		var lines []string
+		if header != nil {
+			lines = append(lines, header(i))
+		}
+		for j := 0; j < 8; j++ {
+			lines = append(lines, fmt.Sprintf("body line %d of page %d", j, i))
+		}
+		if footer != nil {
+			lines = append(lines, footer(i))
+		}
+		pages[i] = strings.Join(lines, "\n")
+	}
+	return pages
+}
+
+func TestCleanPages(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   []string
+		dropped []string
+		kept    []string
+	}{
+		{
+			name:    "page numbers",
+			pages:   book(6, nil, func(i int) string { return fmt.Sprint(i + 1) }),
+			dropped: []string{"1", "3", "6"},
+		},
+		{
+			name:    "offset page numbers",
+			pages:   book(6, nil, func(i int) string { return fmt.Sprintf("- %d -", i+17) }),
+			dropped: []string{"- 17 -", "- 22 -"},
+		},
+		{
+			name:    "roman page numbers",
+			pages:   book(5, func(i int) string { return []string{"i", "ii", "iii", "iv", "v"}[i] }, nil),
+			dropped: []string{"ii", "iv"},
+		},
+		{
+			name:    "running header",
+			pages:   book(5, func(i int) string { return fmt.Sprintf("Chapter 2. Storage   %d", 30+i) }, nil),
+			dropped: []string{"Chapter 2. Storage   30"},
+		},
+		{
+			name: "words that look like numbers",
+			pages: book(5, func(i int) string {
+				return []string{"civil", "x", "2019", "Preface", "mix"}[i]
+			}, nil),
+			kept: []string{"civil", "x", "2019", "mix"},
+		},
+		{
+			name:  "numbers out of sequence",
+			pages: book(6, nil, func(i int) string { return []string{"7", "1", "42", "3", "2019", "13"}[i] }),
+			kept:  []string{"7", "42", "2019"},
+		},
+	}
+	for _, tt := range tests {
+		got := strings.Join(cleanPages(tt.pages), "\n")
+		lines := make(map[string]bool)
+		for _, l := range strings.Split(got, "\n") {
+			lines[strings.TrimSpace(l)] = true
+		}
+		for _, d := range tt.dropped {
+			if lines[d] {
+				t.Errorf("%s: line %q was kept", tt.name, d)
+			}
+		}
+		for _, k := range tt.kept {
+			if !lines[k] {
+				t.Errorf("%s: line %q was dropped", tt.name, k)
+			}
+		}
+		if !strings.Contains(got, "body line 3 of page 1") {
+			t.Errorf("%s: body was dropped", tt.name)
+		}
+	}
+}
+
+func TestDehyphenate(t *testing.T) {
+	tests := []struct {
+		pages, want []string
+	}{
+		{[]string{"the infor-\nmation is stored"}, []string{"the information\nis stored"}},
+		{[]string{"the infor-\nmation is stored", "information retrieval"}, []string{"the information\nis stored", "information retrieval"}},
+		{[]string{"a well-\nknown fact"}, []string{"a wellknown\nfact"}},
+		{[]string{"a well-\nknown fact", "and Well-Known others"}, []string{"a well-known\nfact", "and Well-Known others"}},
+		{[]string{"state-of-the-\nart methods"}, []string{"state-of-the-art\nmethods"}},
+		{[]string{"infor\u00ad\nmation, again"}, []string{"information,\nagain"}},
+		{[]string{"de\u00adhyphen\u00adate"}, []string{"dehyphenate"}},
+		{[]string{"ends with a dash -\nThen a sentence"}, []string{"ends with a dash -\nThen a sentence"}},
+		{[]string{"compu-\n  ters.\nnext"}, []string{"computers.\n\nnext"}},
+	}
+	for _, tt := range tests {
+		got := dehyphenate(tt.pages)
+		if strings.Join(got, "\f") != strings.Join(tt.want, "\f") {
+			t.Errorf("dehyphenate(%q) = %q, want %q", tt.pages, got, tt.want)
+		}
+	}
+}
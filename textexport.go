@@ -0,0 +1,172 @@
+//go:build fts5
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// exportText writes the text and details of the pdfs that are not in the trash to dir,
+// for Recoll, or for Xapian if format is xapian
+func exportText(ctx context.Context, dir, format string) error {
+	switch format {
+	case "recoll":
+		return exportRecoll(ctx, dir)
+	case "xapian":
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "booklice.script"), []byte(xapianScript), 0644); err != nil {
+			return err
+		}
+		f, err := os.Create(filepath.Join(dir, "booklice.dump"))
+		if err != nil {
+			return err
+		}
+		if err := exportXapian(ctx, f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return fmt.Errorf("unknown format %s, it is recoll or xapian", format)
+}
+
+// recollPage is the data of the html file of a pdf for Recoll
+type recollPage struct {
+	Doc   siteDoc
+	URL   template.URL // the file url of the pdf
+	Pages []string
+}
+
+// exportRecoll writes to dir an html file with the text of each pdf that is not in the
+// trash, for Recoll to index with its html handler, which takes the title, author,
+// keywords and description of the head as fields. Files are rewritten only if they
+// change, so that Recoll reindexes only those, and the files of the pdfs no more in the
+// index, or trashed, are removed.
+func exportRecoll(ctx context.Context, dir string) error {
+	t, err := template.New("recoll").Funcs(template.FuncMap{
+		"join": strings.Join,
+		"inc":  func(i int) int { return i + 1 },
+	}).ParseFS(webFiles, "web/recoll/*.tmpl")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	docs, err := siteDocs(ctx)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, d := range docs {
+		pages, err := pageTexts(d.ID)
+		if err != nil {
+			return err
+		}
+		page := recollPage{Doc: d, URL: template.URL(fileURL(d.Path)), Pages: pages}
+		var buf bytes.Buffer
+		if err := t.ExecuteTemplate(&buf, "recoll-doc", page); err != nil {
+			return err
+		}
+		name := strconv.Itoa(d.ID) + ".html"
+		keep[name] = true
+		path := filepath.Join(dir, name)
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, buf.Bytes()) {
+			continue
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		id := strings.TrimSuffix(name, ".html")
+		if _, err := strconv.Atoi(id); err != nil || e.IsDir() || id == name || keep[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xapianScript is the index script of scriptindex of Xapian Omega for the dump of
+// exportXapian. The id is the unique term, so that the dump can be indexed again to
+// update the database.
+const xapianScript = `id : boolean=Q unique=Q field=id
+url : field=url
+title : field=caption field=title weight=3 index=S index
+author : field=author index=A index
+keywords : field=keywords index=K index
+isbn : field=isbn boolean=XISBN
+date : field=date
+abstract : field=abstract index
+text : index truncate=300 field=sample
+`
+
+// exportXapian writes to w the pdfs that are not in the trash, with their text, in the
+// dump format of scriptindex of Xapian Omega, to be indexed with xapianScript
+func exportXapian(ctx context.Context, w io.Writer) error {
+	docs, err := siteDocs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range docs {
+		pages, err := pageTexts(d.ID)
+		if err != nil {
+			return err
+		}
+		fields := [][2]string{
+			{"id", strconv.Itoa(d.ID)},
+			{"url", fileURL(d.Path)},
+			{"title", d.Name()},
+			{"author", d.Authors},
+			{"keywords", strings.Join(d.Keywords, " ")},
+			{"isbn", d.ISBN},
+			{"date", d.AddedAt},
+			{"abstract", d.Abstract},
+			{"text", strings.Join(pages, "\n\n")},
+		}
+		var buf bytes.Buffer
+		for _, f := range fields {
+			if strings.TrimSpace(f[1]) != "" {
+				buf.WriteString(dumpField(f[0], f[1]))
+			}
+		}
+		buf.WriteString("\n")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileURL returns the file url of the file at path
+func fileURL(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// dumpField returns the field name with value in the dump format of scriptindex. The lines
+// of values after the first start with =, and records end with an empty line, so empty
+// lines are kept as =.
+func dumpField(name, value string) string {
+	value = strings.TrimSpace(strings.ReplaceAll(value, "\r", ""))
+	return fmt.Sprintf("%s=%s\n", name, strings.ReplaceAll(value, "\n", "\n="))
+}
@@ -0,0 +1,20 @@
+//go:build fts5
+
+package main
+
+import "testing"
+
+func TestDumpField(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{"title", "The Go Programming Language", "title=The Go Programming Language\n"},
+		{"text", "page one\r\nline two\n\npage two\n", "text=page one\n=line two\n=\n=page two\n"},
+		{"abstract", "  a=b  ", "abstract=a=b\n"},
+	}
+	for _, tt := range tests {
+		if got := dumpField(tt.name, tt.value); got != tt.want {
+			t.Errorf("dumpField(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		w, h         int
+		wantW, wantH int
+	}{
+		{1200, 1600, 300, 400},
+		{1000, 500, 300, 150},
+		{200, 1600, 50, 400},
+		{100, 120, 100, 120}, // small covers are not scaled up
+	}
+	for _, tt := range tests {
+		img := image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))
+		for y := 0; y < tt.h; y++ {
+			for x := 0; x < tt.w; x++ {
+				img.Set(x, y, color.RGBA{200, 100, 50, 255})
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		data, err := thumbnail(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%dx%d: %v", tt.w, tt.h, err)
+		}
+		cover, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%dx%d: the cover is not a jpeg: %v", tt.w, tt.h, err)
+		}
+		if b := cover.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("%dx%d: cover is %dx%d, want %dx%d", tt.w, tt.h, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+		}
+		if r, _, _, _ := cover.At(tt.wantW/2, tt.wantH/2).RGBA(); r>>8 < 190 || r>>8 > 210 {
+			t.Errorf("%dx%d: the color of the cover is lost, red is %d", tt.w, tt.h, r>>8)
+		}
+	}
+
+	if _, err := thumbnail([]byte("not an image")); err == nil {
+		t.Error("thumbnail of garbage succeeded")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// maxTitleLines is the number of lines, from the start of the text, searched for a title
+const maxTitleLines = 20
+
+var (
+	// columnGap separates the parts of a line laid out far apart by txtwrite, like a running header and a page number
+	columnGap = regexp.MustCompile(`\s{3,}`)
+
+	// pageArtifact matches page numbers and similar left at the end of a title. A separator
+	// must follow a space, so that Catch-22 and ISO 9660-1 are kept.
+	pageArtifact = regexp.MustCompile(`(?i)(\s*\bpage\s+\d+(\s+of\s+\d+)?|(^|\s+)[-–|]\s*\d+\s*[-–]?)\s*$`)
+
+	// smallWords stay lowercase when converting a title to title case, unless they start the title
+	smallWords = map[string]bool{
+		"a": true, "an": true, "and": true, "as": true, "at": true, "but": true, "by": true,
+		"for": true, "in": true, "of": true, "on": true, "or": true, "the": true, "to": true,
+		"vs": true, "via": true, "with": true,
+	}
+
+	// acronyms with vowels stay uppercase when converting a title to title case.
+	// Acronyms without vowels, like SQL or NT, are detected.
+	acronyms = map[string]bool{
+		"ACM": true, "AI": true, "ANSI": true, "API": true, "ASCII": true, "AWS": true,
+		"GUI": true, "IBM": true, "IEEE": true, "IO": true, "ISO": true, "NASA": true,
+		"NOSQL": true, "OOP": true, "OS": true, "UI": true, "UML": true, "UNIX": true,
+		"URL": true, "USB": true,
+	}
+)
+
+// guessTitle returns the first line of text that looks like a title. The line is returned
+// as found in the text, so that normalizeTitle can be audited against it.
+func guessTitle(text string) string {
+	lines := strings.SplitN(text, "\n", maxTitleLines+1)
+	if len(lines) > maxTitleLines {
+		lines = lines[:maxTitleLines]
+	}
+	for _, line := range lines {
+		if letters(line) >= 3 {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// normalizeTitle cleans up a guessed title. It removes soft hyphens, keeps the longest
+// part of lines with running headers, strips trailing page numbers and converts
+// ALL-CAPS titles to title case.
+func normalizeTitle(raw string) string {
+	title := strings.ReplaceAll(raw, "\u00ad", "")
+
+	var best string
+	for _, part := range columnGap.Split(title, -1) {
+		part = strings.TrimSpace(pageArtifact.ReplaceAllString(part, ""))
+		if letters(part) > letters(best) {
+			best = part
+		}
+	}
+	title = strings.Join(strings.Fields(best), " ")
+
+	if isAllCaps(title) {
+		title = titleCase(title)
+	}
+	return title
+}
+
+// letters counts the letters in s
+func letters(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// isAllCaps reports whether s has letters and all of them are uppercase
+func isAllCaps(s string) bool {
+	hasUpper := false
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			hasUpper = true
+		}
+	}
+	return hasUpper
+}
+
+// titleCase capitalizes the first letter of each word of s, except for small words.
+// Words that look like acronyms or contain digits are kept as they are.
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		if isAcronym(w) {
+			continue
+		}
+		w = strings.ToLower(w)
+		if i > 0 && smallWords[strings.Trim(w, ".,:;")] {
+			words[i] = w
+			continue
+		}
+		rs := []rune(w)
+		rs[0] = unicode.ToUpper(rs[0])
+		words[i] = string(rs)
+	}
+	return strings.Join(words, " ")
+}
+
+// isAcronym reports whether the word w of an all caps title should stay as it is
+func isAcronym(w string) bool {
+	w = strings.Trim(w, ".,:;()")
+	if acronyms[w] || strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+		return true
+	}
+	return letters(w) >= 2 && !strings.ContainsAny(w, "AEIOUY")
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"The Go Programming Language", "The Go Programming Language"},
+		{"THE ART OF COMPUTER PROGRAMMING", "The Art of Computer Programming"},
+		{"SQL AND NOSQL DATABASES", "SQL and NOSQL Databases"},
+		{"INSIDE WINDOWS NT", "Inside Windows NT"},
+		{"HTTP/2 IN ACTION", "HTTP/2 in Action"},
+		{"Catch-22", "Catch-22"},
+		{"ISO 9660-1", "ISO 9660-1"},
+		{"Operating Systems - 12", "Operating Systems"},
+		{"Operating Systems | 7", "Operating Systems"},
+		{"Distributed Systems page 3 of 40", "Distributed Systems"},
+		{"Chapter 1      Introduction to Algorithms      17", "Introduction to Algorithms"},
+		{"infor\u00admation retrieval", "information retrieval"},
+		{"  spaced  out  ", "spaced out"},
+	}
+	for _, tt := range tests {
+		if got := normalizeTitle(tt.raw); got != tt.want {
+			t.Errorf("normalizeTitle(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestGuessTitle(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"\n\n  12\nA Real Title\nmore", "A Real Title"},
+		{"", ""},
+		{"1\n2\n3", ""},
+	}
+	for _, tt := range tests {
+		if got := guessTitle(tt.text); got != tt.want {
+			t.Errorf("guessTitle(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxTOCStartPage is the number of pages, from the start of the text, searched for a table of contents
+	maxTOCStartPage = 15
+
+	// maxTOCPages is the maximum number of pages of a table of contents
+	maxTOCPages = 10
+)
+
+var (
+	tocHeading = regexp.MustCompile(`(?im)^\s*(table\s+of\s+)?contents\s*$`)
+
+	// tocEntry matches a heading followed by dot leaders or a column gap and a page number.
+	// A single space is not enough, prose lines often end in a number.
+	tocEntry = regexp.MustCompile(`^\s*(.*?\pL.*?)(?:\s*(?:[.·]\s*){2,}|\s{2,}|\t)(\d+|[ivxlc]+)\s*$`)
+)
+
+// findTOC returns the headings of the table of contents of a pdf, one per line. The table
+// of contents starts at a page with a "Contents" heading and ends at the first page
+// without entries, or at the first entry whose page number is smaller than the previous.
+// Roman page numbers of the front matter must come before the arabic ones.
+func findTOC(pages []string) string {
+	for i, page := range pages {
+		if i == maxTOCStartPage {
+			break
+		}
+		loc := tocHeading.FindStringIndex(page)
+		if loc == nil {
+			continue
+		}
+
+		var headings []string
+		last := -1
+	scan:
+		for j, p := range pages[i:] {
+			if j == maxTOCPages {
+				break
+			}
+			if j == 0 {
+				p = p[loc[1]:]
+			}
+			found := false
+			for _, line := range strings.Split(p, "\n") {
+				m := tocEntry.FindStringSubmatch(line)
+				if m == nil {
+					continue
+				}
+				if n, err := strconv.Atoi(m[2]); err == nil {
+					if n < last {
+						break scan
+					}
+					last = n
+				} else if last >= 0 {
+					break scan
+				}
+				headings = append(headings, strings.Join(strings.Fields(m[1]), " "))
+				found = true
+			}
+			if !found {
+				break
+			}
+		}
+		if len(headings) > 0 {
+			return strings.Join(headings, "\n")
+		}
+	}
+	return ""
+}
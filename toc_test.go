@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestFindTOC(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages []string
+		want  string
+	}{
+		{
+			name:  "dot leaders",
+			pages: []string{"Title", "Contents\nPreface . . . . . ix\n1 Introduction ........ 1\n2 B-Trees ...... 17\n"},
+			want:  "Preface\n1 Introduction\n2 B-Trees",
+		},
+		{
+			name:  "column gap",
+			pages: []string{"Table of Contents\n  Storage        3\n  Indexes        45\n"},
+			want:  "Storage\nIndexes",
+		},
+		{
+			name: "prose is not a heading",
+			pages: []string{"Contents\nIntroduction ...... 1\nRecovery ...... 9\n",
+				"We saw in chapter 3\nthat the year was 1999\n"},
+			want: "Introduction\nRecovery",
+		},
+		{
+			name: "stops when page numbers decrease",
+			pages: []string{"Contents\nIntroduction ...... 1\nRecovery ...... 9\n",
+				"Figure 1      12\nTable 2      3\nTable 3      20\n"},
+			want: "Introduction\nRecovery\nFigure 1",
+		},
+		{
+			name:  "no contents",
+			pages: []string{"Introduction ...... 1\n"},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		if got := findTOC(tt.pages); got != tt.want {
+			t.Errorf("%s: findTOC = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenizerOptions configure the unicode61 tokenizer of the full text index, optionally
+// wrapped by the porter stemmer, see https://www.sqlite.org/fts5.html#tokenizers
+type tokenizerOptions struct {
+	porter           bool
+	removeDiacritics int
+	separators       string
+	tokenChars       string
+}
+
+// String returns the options as the value of the tokenize option of fts5
+func (o tokenizerOptions) String() string {
+	args := []string{"unicode61", "remove_diacritics", fmt.Sprint(o.removeDiacritics)}
+	if o.separators != "" {
+		args = append(args, "separators", ftsArg(o.separators))
+	}
+	if o.tokenChars != "" {
+		args = append(args, "tokenchars", ftsArg(o.tokenChars))
+	}
+	if o.porter {
+		args = append([]string{"porter"}, args...)
+	}
+	return strings.Join(args, " ")
+}
+
+// ftsArg quotes s as an argument of an fts5 tokenizer
+func ftsArg(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
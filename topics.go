@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// maxTopicIterations bounds the iterations of k-means if it does not converge
+const maxTopicIterations = 50
+
+// vector is a sparse term vector normalized to unit length
+type vector map[string]float64
+
+type topicDoc struct {
+	id   int
+	path string
+	vec  vector
+}
+
+// topics clusters the pdfs of the index in k groups by their keywords, weighted by idf,
+// and writes each group to w with its nTerms most representative terms
+func topics(k, nTerms int, w io.Writer) error {
+	docs, err := topicDocs()
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	if k > len(docs) {
+		k = len(docs)
+	}
+
+	assignment, centroids := kmeans(docs, k)
+	for c, centroid := range centroids {
+		var members []topicDoc
+		for i, d := range docs {
+			if assignment[i] == c {
+				members = append(members, d)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+
+		top := make([]weightedTerm, 0, len(centroid))
+		for t, wt := range centroid {
+			top = append(top, weightedTerm{t, wt})
+		}
+		sortTerms(top)
+		if len(top) > nTerms {
+			top = top[:nTerms]
+		}
+		terms := make([]string, len(top))
+		for i, t := range top {
+			terms[i] = t.term
+		}
+
+		fmt.Fprintf(w, "Topic %d: %s (#%d)\n", c+1, strings.Join(terms, " "), len(members))
+		for _, d := range members {
+			fmt.Fprintf(w, "  [%d] %s\n", d.id, d.path)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// topicDocs returns the keyword vectors of all pdfs in the index
+func topicDocs() ([]topicDoc, error) {
+	var docs int
+	if err := countStmt.QueryRow().Scan(&docs); err != nil {
+		return nil, err
+	}
+
+	rows, err := topicsStmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		result []topicDoc
+		idf    = make(map[string]float64)
+	)
+	for rows.Next() {
+		var (
+			d   topicDoc
+			kws string
+		)
+		if err := rows.Scan(&d.id, &d.path, &kws); err != nil {
+			return nil, fmt.Errorf("can't scan row: %w", err)
+		}
+		if kws == "" {
+			continue
+		}
+		d.vec = make(vector)
+		for _, t := range strings.Fields(kws) {
+			if _, ok := idf[t]; !ok {
+				f, err := documentFrequency(t)
+				if err != nil {
+					return nil, err
+				}
+				idf[t] = math.Log(float64(docs+1)/float64(f+1)) + 1
+			}
+			d.vec[t] = idf[t]
+		}
+		d.vec.normalize()
+		result = append(result, d)
+	}
+	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("can't fetch rows: %w", err)
+	}
+	return result, nil
+}
+
+// kmeans clusters docs in k groups using cosine similarity. It returns the group of each
+// doc and the centroids of the groups. Seeding is k-means++ with a fixed seed, so that
+// the same index always gives the same topics.
+func kmeans(docs []topicDoc, k int) ([]int, []vector) {
+	rnd := rand.New(rand.NewSource(1))
+
+	centroids := []vector{docs[rnd.Intn(len(docs))].vec}
+	for len(centroids) < k {
+		dists := make([]float64, len(docs))
+		var total float64
+		for i, d := range docs {
+			dists[i] = math.MaxFloat64
+			for _, c := range centroids {
+				if dist := 1 - d.vec.dot(c); dist < dists[i] {
+					dists[i] = dist
+				}
+			}
+			dists[i] *= dists[i]
+			total += dists[i]
+		}
+		if total == 0 {
+			break
+		}
+		r := rnd.Float64() * total
+		next := len(docs) - 1
+		for i, dist := range dists {
+			if r -= dist; r <= 0 {
+				next = i
+				break
+			}
+		}
+		centroids = append(centroids, docs[next].vec)
+	}
+
+	assignment := make([]int, len(docs))
+	for iter := 0; iter < maxTopicIterations; iter++ {
+		changed := iter == 0
+		for i, d := range docs {
+			best, bestSim := 0, -1.0
+			for c, centroid := range centroids {
+				if sim := d.vec.dot(centroid); sim > bestSim {
+					best, bestSim = c, sim
+				}
+			}
+			if assignment[i] != best {
+				assignment[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		for c := range centroids {
+			centroid := make(vector)
+			for i, d := range docs {
+				if assignment[i] != c {
+					continue
+				}
+				for t, wt := range d.vec {
+					centroid[t] += wt
+				}
+			}
+			centroid.normalize()
+			centroids[c] = centroid
+		}
+	}
+	return assignment, centroids
+}
+
+func (v vector) dot(u vector) float64 {
+	if len(u) < len(v) {
+		v, u = u, v
+	}
+	var sum float64
+	for t, wt := range v {
+		sum += wt * u[t]
+	}
+	return sum
+}
+
+func (v vector) normalize() {
+	norm := math.Sqrt(v.dot(v))
+	if norm == 0 {
+		return
+	}
+	for t := range v {
+		v[t] /= norm
+	}
+}
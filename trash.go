@@ -0,0 +1,160 @@
+//go:build fts5
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// trashPDFs moves the pdfs with ids to the trash. Trashed pdfs are not searched or
+// listed, but keep their text and cover until the trash is emptied.
+func trashPDFs(ids []int) error {
+	now := formatTimestamp(time.Now())
+	for _, id := range ids {
+		if err := updatePDF(id, "remove", "pdf with id %d not found", trashSQL, now, id); err != nil {
+			return err
+		}
+		runHook("on-remove", id)
+	}
+	return nil
+}
+
+// restorePDFs moves the pdfs with ids out of the trash
+func restorePDFs(ids []int) error {
+	for _, id := range ids {
+		if err := updatePDF(id, "restore", "pdf with id %d not in trash", untrashSQL, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePDF executes query with args, that must update the pdf with id, and records
+// the event op. If nothing was updated, the error is notFound formatted with id.
+func updatePDF(id int, op, notFound, query string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf(notFound, id)
+	}
+	if err := recordEvent(tx, op, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// listTrash writes to w the pdfs in the trash
+func listTrash(w io.Writer) error {
+	rows, err := db.Query(trashListSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id        int
+			name      string
+			pages     int
+			deletedAt string
+		)
+		if err := rows.Scan(&id, &name, &pages, &deletedAt); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "[%d] %s (#%d) trashed at %s\n", id, name, pages, deletedAt)
+	}
+	return rows.Err()
+}
+
+// emptyTrash deletes for good the pdfs in the trash and their cover files, and writes
+// to w how many were deleted. Only cover files in the covers dir of the database, that
+// no other pdf references, are deleted. Older databases shared a single covers dir.
+func emptyTrash(w io.Writer) error {
+	dir, err := userCoversDir()
+	if err != nil {
+		return fmt.Errorf("failed to find covers dir: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(trashCoversSQL)
+	if err != nil {
+		return err
+	}
+	var covers []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return err
+		}
+		if filepath.Dir(path) == dir {
+			covers = append(covers, path)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(recordDeletesSQL, formatTimestamp(time.Now()), hostname); err != nil {
+		return err
+	}
+	res, err := tx.Exec(emptyTrashSQL)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(orphanCoversSQL); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, path := range covers {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("can't remove cover %s: %v", path, err)
+		}
+	}
+	fmt.Fprintf(w, "deleted %d pdfs\n", n)
+	return nil
+}
+
+const (
+	trashSQL = `UPDATE pdfs SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+
+	untrashSQL = `UPDATE pdfs SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`
+
+	trashListSQL = `SELECT id, path, pages, deleted_at FROM pdfs WHERE deleted_at IS NOT NULL ORDER BY deleted_at, id`
+
+	trashCoversSQL = `SELECT DISTINCT cover_path FROM pdfs AS t WHERE deleted_at IS NOT NULL AND IFNULL(cover_path, '') != ''
+		AND NOT EXISTS (SELECT 1 FROM pdfs WHERE cover_path = t.cover_path AND deleted_at IS NULL)`
+
+	emptyTrashSQL = `DELETE FROM pdfs WHERE deleted_at IS NOT NULL`
+
+	recordDeletesSQL = `INSERT INTO events(at, host, op, pdf_id, path) SELECT ?, ?, 'delete', id, path FROM pdfs WHERE deleted_at IS NOT NULL`
+)
@@ -0,0 +1,274 @@
+//go:build fts5
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxUploadSize is the largest request to /upload
+	maxUploadSize = 1 << 30
+
+	// uploadQueueSize is the most uploaded pdfs waiting to be added
+	uploadQueueSize = 100
+)
+
+// uploadJob is an uploaded pdf and how adding it went
+type uploadJob struct {
+	ID     int    `json:"id"`
+	File   string `json:"file"`
+	Status string `json:"status"` // queued, adding, added, duplicate or failed
+	PDF    int    `json:"pdf,omitempty"`
+	Error  string `json:"error,omitempty"`
+	path   string
+}
+
+// uploads adds the uploaded pdfs, one at a time, and keeps their jobs
+type uploads struct {
+	dir   string // where the uploaded pdfs are saved
+	queue chan *uploadJob
+
+	mu      sync.Mutex
+	jobs    []*uploadJob
+	changed chan struct{} // closed when a job changes, see progress
+}
+
+// newUploads returns uploads that saves the pdfs in dir and starts adding them
+func newUploads(dir string) *uploads {
+	u := &uploads{dir: dir, queue: make(chan *uploadJob, uploadQueueSize), changed: make(chan struct{})}
+	go u.run()
+	return u
+}
+
+// run adds the queued pdfs
+func (u *uploads) run() {
+	for job := range u.queue {
+		u.update(job, func(j *uploadJob) { j.Status = "adding" })
+		id, dup, err := addUploaded(job.path)
+		u.update(job, func(j *uploadJob) {
+			switch {
+			case err != nil:
+				j.Status, j.Error = "failed", err.Error()
+			case dup:
+				j.Status, j.PDF = "duplicate", id
+			default:
+				j.Status, j.PDF = "added", id
+			}
+		})
+	}
+}
+
+// addUploaded adds the pdf at path and returns its id. If the pdf is in the index
+// already, it returns the id of the one in the index and true and removes the file.
+func addUploaded(path string) (int, bool, error) {
+	if err := addPDF(path); err != nil {
+		return 0, false, err
+	}
+	id, dup, err := indexedPath(path)
+	if err == nil && dup {
+		return id, true, os.Remove(path)
+	}
+	return id, dup, err
+}
+
+// indexedPath returns the id of the pdf in the file at path and false, or, if the pdf was
+// indexed from another path, the id of that and true
+func indexedPath(path string) (int, bool, error) {
+	pdf, err := newPDF(path)
+	if err != nil {
+		return 0, false, err
+	}
+	sig, err := pdf.Sig()
+	if err != nil {
+		return 0, false, err
+	}
+	var (
+		id      int
+		indexed string
+	)
+	if err := db.QueryRow(sigPathIDSQL, sig).Scan(&id, &indexed); err != nil {
+		return 0, false, err
+	}
+	return id, indexed != path, nil
+}
+
+// save saves the uploaded file of fh in the dir of u and queues it to be added
+func (u *uploads) save(fh *multipart.FileHeader) (uploadJob, error) {
+	name := filepath.Base(fh.Filename)
+	if !strings.EqualFold(filepath.Ext(name), ".pdf") {
+		return uploadJob{}, fmt.Errorf("%q is not a pdf", fh.Filename)
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return uploadJob{}, err
+	}
+	defer src.Close()
+	dst, err := createUnique(u.dir, name)
+	if err != nil {
+		return uploadJob{}, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return uploadJob{}, err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return uploadJob{}, err
+	}
+
+	u.mu.Lock()
+	job := &uploadJob{ID: len(u.jobs) + 1, File: name, Status: "queued", path: dst.Name()}
+	u.jobs = append(u.jobs, job)
+	u.notify()
+	u.mu.Unlock()
+	select {
+	case u.queue <- job:
+	default:
+		u.update(job, func(j *uploadJob) { j.Status, j.Error = "failed", "too many pdfs to add, try later" })
+	}
+	return u.job(job.ID)
+}
+
+// update changes job with f
+func (u *uploads) update(job *uploadJob, f func(*uploadJob)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	f(job)
+	u.notify()
+}
+
+// notify wakes up the watchers of progress. u.mu must be held.
+func (u *uploads) notify() {
+	close(u.changed)
+	u.changed = make(chan struct{})
+}
+
+// job returns a copy of the job with id
+func (u *uploads) job(id int) (uploadJob, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if id < 1 || id > len(u.jobs) {
+		return uploadJob{}, fmt.Errorf("upload %d %w", id, errNotFound)
+	}
+	return *u.jobs[id-1], nil
+}
+
+// list returns a copy of the jobs, the latest first
+func (u *uploads) list() []uploadJob {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	jobs := make([]uploadJob, len(u.jobs))
+	for i, j := range u.jobs {
+		jobs[len(jobs)-1-i] = *j
+	}
+	return jobs
+}
+
+// createUnique creates a new file in dir named name, or name with a number before the
+// extension if a file with that name exists
+func createUnique(dir, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		p := filepath.Join(dir, name)
+		if i > 0 {
+			p = filepath.Join(dir, base+"-"+strconv.Itoa(i)+ext)
+		}
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// handleUpload shows the upload form with the uploads for GET and saves the pdfs in the
+// field file of the form for POST. Browsers are redirected to the form, other clients
+// get the jobs of the pdfs as json.
+func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if s.uploads == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		page := webPage{Uploads: s.uploads.list()}
+		for _, j := range page.Uploads {
+			if j.Status == "queued" || j.Status == "adding" {
+				page.Pending = true
+			}
+		}
+		s.render(w, "upload", page)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	release, ok := s.acquire(r)
+	if !ok {
+		serverError(w, r, r.Context().Err())
+		return
+	}
+	defer release()
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		apiError(w, http.StatusBadRequest, "no pdfs in the field file")
+		return
+	}
+	jobs := []uploadJob{}
+	for _, fh := range files {
+		job, err := s.uploads.save(fh)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	if r.FormValue("form") != "" {
+		http.Redirect(w, r, s.href("/upload"), http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, jobs)
+}
+
+// handleUploadStatus writes as json the job of the upload with the id in the path
+// /upload/{id}
+func (s *server) handleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	if s.uploads == nil {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/upload/"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, "no upload "+strings.TrimPrefix(r.URL.Path, "/upload/"))
+		return
+	}
+	job, err := s.uploads.job(id)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// sigPathIDSQL finds a pdf by its signature, in the trash too
+const sigPathIDSQL = `SELECT id, path FROM pdfs WHERE sig = ? LIMIT 1`
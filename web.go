@@ -0,0 +1,431 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// gridPageSize is the number of covers in a page of the browse grid
+	gridPageSize = 24
+
+	// resultsPageSize is the number of search results in a page
+	resultsPageSize = 20
+
+	// topKeywordsSize is the number of keywords shown to filter the grid
+	topKeywordsSize = 30
+)
+
+// webPage is the data of the pages of the web ui
+type webPage struct {
+	Query    string
+	Keyword  string // the keyword that filters the pdfs
+	Keywords []string
+	Error    string
+	Total    int
+	Results  []resultView
+	PDF      *pdfView
+	Prev     string // the url of the previous page, if any
+	Next     string // the url of the next page, if any
+	Page     int
+	Pages    int
+	Uploads  []uploadJob
+	Pending  bool // some uploads are not added yet
+	Upload   bool // the server accepts uploads
+	Viewer   string
+}
+
+// resultView is a pdf as shown in the grid or the results of a search
+type resultView struct {
+	searchResult
+	Link    string
+	Snippet template.HTML
+}
+
+// Name returns the title of the pdf, or the name of its file if it has none
+func (v resultView) Name() string {
+	if v.Title != "" {
+		return v.Title
+	}
+	return filepath.Base(v.Path)
+}
+
+// pdfView is the detail page of a pdf
+type pdfView struct {
+	ID       int      `json:"id"`
+	Path     string   `json:"path"`
+	Title    string   `json:"title"`
+	Authors  string   `json:"authors,omitempty"`
+	Pages    int      `json:"pages"`
+	AddedAt  string   `json:"added_at"`
+	Origin   string   `json:"origin,omitempty"`
+	ISBN     string   `json:"isbn,omitempty"`
+	Keywords []string `json:"keywords"`
+	TOC      []string `json:"toc,omitempty"`
+	Abstract string   `json:"abstract,omitempty"`
+	Link     string   `json:"link"`
+}
+
+// handleBrowse shows the grid of covers of the pdfs, the newest first, filtered by the
+// keyword in the parameter kw
+func (s *server) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	page := webPage{Keyword: strings.TrimSpace(r.FormValue("kw")), Page: pageParam(r)}
+	var match string
+	if page.Keyword != "" {
+		match = keywordQuery(page.Keyword)
+	}
+
+	err := db.QueryRowContext(r.Context(), browseCountSQL, sql.Named("match", match)).Scan(&page.Total)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	rows, err := db.QueryContext(r.Context(), browseSQL, sql.Named("match", match), sql.Named("limit", gridPageSize), sql.Named("offset", (page.Page-1)*gridPageSize))
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v resultView
+		if err := rows.Scan(&v.ID, &v.Path, &v.Pages, &v.Title); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		v.Link = s.href(s.link(v.searchResult))
+		page.Results = append(page.Results, v)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if page.Keywords, err = topKeywords(r.Context(), topKeywordsSize); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	page.paginate(r, gridPageSize)
+	s.render(w, "browse", page)
+}
+
+// handleSearch shows the results of the query in the parameter q, filtered by the keyword
+// in the parameter kw
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	page := webPage{
+		Query:   strings.TrimSpace(r.FormValue("q")),
+		Keyword: strings.TrimSpace(r.FormValue("kw")),
+		Page:    pageParam(r),
+	}
+	if page.Query == "" {
+		http.Redirect(w, r, s.href("/"), http.StatusSeeOther)
+		return
+	}
+	s.searches.Add(1)
+	query := page.Query
+	if page.Keyword != "" {
+		query = "(" + query + ") AND " + keywordQuery(page.Keyword)
+	}
+
+	var err error
+	if page.Total, err = searchCount(r.Context(), searchCountSQL, query, filter{}); timedOut(r) {
+		serverError(w, r, err)
+		return
+	} else if err != nil {
+		page.Error = fmt.Sprintf("Bad query: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		s.render(w, "search", page)
+		return
+	}
+	opts := searchOptions{limit: resultsPageSize, offset: (page.Page - 1) * resultsPageSize, tokens: 16, snippets: 1}
+	results, err := search(r.Context(), searchStmt, query, opts, filter{}, io.Discard, resultFormat{})
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	for _, res := range results {
+		page.Results = append(page.Results, resultView{searchResult: res, Link: s.href(s.link(res)), Snippet: snippetHTML(res)})
+	}
+	page.paginate(r, resultsPageSize)
+	s.render(w, "search", page)
+}
+
+// handlePDF shows the details of the pdf with the id in the path /pdf/{id}
+func (s *server) handlePDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/pdf/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	v, err := s.pdfView(r.Context(), id)
+	if errors.Is(err, errNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	s.render(w, "pdf", webPage{PDF: v})
+}
+
+// pdfView returns the details of the pdf with id. Pdfs in the trash are not found.
+func (s *server) pdfView(ctx context.Context, id int) (*pdfView, error) {
+	var (
+		v                                          pdfView
+		sig, titleRaw, kws, toc, trashed, annexKey string
+		stored                                     bool
+	)
+	err := infoStmt.QueryRowContext(ctx, id).Scan(&v.ID, &v.Path, &v.Pages, &sig, &v.AddedAt, &v.Title, &titleRaw, &v.Abstract, &kws, &v.ISBN, &toc, &trashed, &stored, &v.Origin, &v.Authors, &annexKey)
+	if err == sql.ErrNoRows || (err == nil && trashed != "") {
+		return nil, fmt.Errorf("pdf with id %d %w", id, errNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Keywords = strings.Fields(kws)
+	if toc != "" {
+		v.TOC = strings.Split(toc, "\n")
+	}
+	v.Link = s.href(s.link(searchResult{ID: v.ID, Path: v.Path}))
+	return &v, nil
+}
+
+// handleRead shows the pdf with the id in the path /read/{id} in pdf.js, or the viewer of
+// the browser, at the page in the parameter page or else at the first page that matches
+// the query in the parameter q
+func (s *server) handleRead(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/read/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	v, err := s.pdfView(r.Context(), id)
+	if errors.Is(err, errNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	n, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || n < 1 {
+		n = 1
+		if q := strings.TrimSpace(r.FormValue("q")); q != "" {
+			if n, err = firstMatchPage(r.Context(), id, q); err != nil {
+				log.Printf("can't find %q in pdf %d: %v", q, id, err)
+				n = 1
+			}
+		}
+	}
+	doc := s.href("/doc/" + strconv.Itoa(id))
+	viewer := doc + "#page=" + strconv.Itoa(n)
+	if s.pdfjs != "" {
+		viewer = s.href("/pdfjs/web/viewer.html?file=") + url.QueryEscape(doc) + "#page=" + strconv.Itoa(n)
+	}
+	s.render(w, "read", webPage{Query: r.FormValue("q"), PDF: v, Viewer: viewer})
+}
+
+// firstMatchPage returns the first page of the pdf with id that matches query, or 1 if
+// only the other columns of the index match
+func firstMatchPage(ctx context.Context, id int, query string) (int, error) {
+	var text string
+	if err := db.QueryRowContext(ctx, matchTextSQL, query, id).Scan(&text); err != nil {
+		return 0, err
+	}
+	i := strings.Index(text, "{{{")
+	if i < 0 {
+		return 1, nil
+	}
+	return strings.Count(text[:i], pageSeparator) + 1, nil
+}
+
+// paginate sets the page count and the urls of the pages before and after the current
+// one, for pages of size results
+func (p *webPage) paginate(r *http.Request, size int) {
+	p.Pages = (p.Total + size - 1) / size
+	pageURL := func(n int) string {
+		q := url.Values{}
+		for k, v := range r.URL.Query() {
+			q[k] = v
+		}
+		q.Set("page", strconv.Itoa(n))
+		return r.URL.Path + "?" + q.Encode()
+	}
+	if p.Page > 1 {
+		p.Prev = pageURL(p.Page - 1)
+	}
+	if p.Page < p.Pages {
+		p.Next = pageURL(p.Page + 1)
+	}
+}
+
+// pageParam returns the page in the parameter page, starting from 1
+func pageParam(r *http.Request) int {
+	n, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// keywordQuery returns the fts query for the pdfs with the keyword kw
+func keywordQuery(kw string) string {
+	return "{keywords} : " + ftsQuote(kw)
+}
+
+// topKeywords returns the n keywords of most pdfs, the most common first
+func topKeywords(ctx context.Context, n int) ([]string, error) {
+	top, err := keywordCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(top) > n {
+		top = top[:n]
+	}
+	kws := make([]string, len(top))
+	for i, t := range top {
+		kws[i] = t.term
+	}
+	return kws, nil
+}
+
+// keywordCounts returns the keywords of the pdfs weighted by the number of pdfs with
+// them, the most common first
+func keywordCounts(ctx context.Context) ([]weightedTerm, error) {
+	rows, err := topicsStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]float64)
+	for rows.Next() {
+		var (
+			id        int
+			path, kws string
+		)
+		if err := rows.Scan(&id, &path, &kws); err != nil {
+			return nil, err
+		}
+		for _, kw := range strings.Fields(kws) {
+			counts[kw]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	top := make([]weightedTerm, 0, len(counts))
+	for kw, c := range counts {
+		top = append(top, weightedTerm{kw, c})
+	}
+	sortTerms(top)
+	return top, nil
+}
+
+// snippetHTML returns the snippet of r escaped, with the matches in bold
+func snippetHTML(r searchResult) template.HTML {
+	var b strings.Builder
+	prev := 0
+	for _, m := range r.Matches {
+		b.WriteString(html.EscapeString(r.Snippet[prev:m[0]]))
+		b.WriteString("<b>" + html.EscapeString(r.Snippet[m[0]:m[1]]) + "</b>")
+		prev = m[1]
+	}
+	b.WriteString(html.EscapeString(r.Snippet[prev:]))
+	return template.HTML(strings.ReplaceAll(b.String(), "\n", "<br>"))
+}
+
+// render writes the page with the template name
+func (s *server) render(w http.ResponseWriter, name string, page webPage) {
+	page.Upload = s.uploads != nil
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, name, page); err != nil {
+		log.Printf("failed to render %s: %v", name, err)
+	}
+}
+
+// webFiles are the templates of the pages and the static files, like style.css, of the web ui
+//
+//go:embed web
+var webFiles embed.FS
+
+// loadTemplates parses the templates of the web ui and sets up its static files. The
+// templates defined in the .tmpl files in dir, if not empty, replace the embedded ones
+// with the same names, and the files in dir/static replace the embedded static files.
+// The templates write the links of the server as {{base}}/path, see basePath.
+func (s *server) loadTemplates(dir string) error {
+	funcs := template.FuncMap{"base": func() string { return s.basePath }}
+	t, err := template.New("web").Funcs(funcs).ParseFS(webFiles, "web/*.tmpl")
+	if err != nil {
+		return err
+	}
+	static, err := fs.Sub(webFiles, "web/static")
+	if err != nil {
+		return err
+	}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			if t, err = t.ParseFiles(files...); err != nil {
+				return err
+			}
+		}
+		static = overlayFS{os.DirFS(filepath.Join(dir, "static")), static}
+	}
+	s.templates = t
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+	s.static = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		files.ServeHTTP(w, r)
+	})
+	return nil
+}
+
+// overlayFS opens the files of top, or of base if top has no such file
+type overlayFS struct {
+	top, base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.top.Open(name); err == nil {
+		return f, nil
+	}
+	return o.base.Open(name)
+}
+
+const (
+	// matchTextSQL returns the text of a pdf with the matches of a query marked
+	matchTextSQL = `SELECT highlight(pdfs_fts, 0, '{{{', '}}}') FROM pdfs_fts WHERE pdfs_fts MATCH ? AND rowid = ?`
+
+	// browseSQL lists the pdfs matching the fts query :match, if not empty, the newest first
+	browseSQL = `SELECT pdfs.id, pdfs.path, pdfs.pages, IFNULL(pdfs.title, '') FROM pdfs WHERE ` + liveSQL +
+		` AND (:match = '' OR pdfs.id IN (SELECT rowid FROM pdfs_fts WHERE pdfs_fts MATCH :match)) ORDER BY pdfs.id DESC LIMIT :limit OFFSET :offset`
+
+	browseCountSQL = `SELECT COUNT(*) FROM pdfs WHERE ` + liveSQL +
+		` AND (:match = '' OR pdfs.id IN (SELECT rowid FROM pdfs_fts WHERE pdfs_fts MATCH :match))`
+)
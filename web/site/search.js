@@ -0,0 +1,39 @@
+// search.js filters the cards of the index page of a site exported by booklice. The words
+// of the search box match as prefixes the words of the titles, authors and keywords in
+// bookliceIndex, written by export-site, and a card is shown if it matches all of them.
+(function() {
+  var input = document.getElementById('q');
+  var count = document.getElementById('count');
+  var cards = document.querySelectorAll('.card');
+  var terms = Object.keys(bookliceIndex.terms);
+
+  // ids returns the ids of the pdfs with a word that starts with prefix
+  function ids(prefix) {
+    var found = {};
+    terms.forEach(function(t) {
+      if (t.indexOf(prefix) === 0) {
+        bookliceIndex.terms[t].forEach(function(id) { found[id] = true; });
+      }
+    });
+    return found;
+  }
+
+  function filter() {
+    var words = input.value.toLowerCase().split(/[^\p{L}\p{N}]+/u).filter(function(w) { return w !== ''; });
+    var sets = words.map(ids);
+    var shown = 0;
+    cards.forEach(function(card) {
+      var show = sets.every(function(s) { return s[card.dataset.id]; });
+      card.style.display = show ? '' : 'none';
+      if (show) shown++;
+    });
+    count.textContent = shown + ' pdfs';
+  }
+
+  // keyword links of the pdf pages open index.html#keyword
+  if (location.hash.length > 1) {
+    input.value = decodeURIComponent(location.hash.slice(1));
+  }
+  input.addEventListener('input', filter);
+  filter();
+})();
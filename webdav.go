@@ -0,0 +1,245 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// webdavShare is a folder of a WebDAV server, like a Nextcloud share, to add pdfs from
+type webdavShare struct {
+	root     *url.URL // the http or https url of the folder, ending in /
+	user     string
+	password string
+}
+
+// webdavFile is a pdf of a share
+type webdavFile struct {
+	url string
+	rel string // the path in the share, separated by /
+}
+
+// isWebDAV reports whether path is the url of a WebDAV share instead of a file
+func isWebDAV(path string) bool {
+	return strings.HasPrefix(path, "webdav://") || strings.HasPrefix(path, "webdav+http://")
+}
+
+// newWebDAVShare returns the share of a webdav:// url, that is served over https, or
+// webdav+http:// for servers without tls. The user and the password are those of the url
+// or else of the environment variables BOOKLICE_WEBDAV_USER and BOOKLICE_WEBDAV_PASSWORD.
+func newWebDAVShare(rawURL string) (*webdavShare, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "webdav":
+		u.Scheme = "https"
+	case "webdav+http":
+		u.Scheme = "http"
+	default:
+		return nil, fmt.Errorf("%s is not a webdav:// url", rawURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s has no server", rawURL)
+	}
+	s := &webdavShare{user: os.Getenv("BOOKLICE_WEBDAV_USER"), password: os.Getenv("BOOKLICE_WEBDAV_PASSWORD")}
+	if u.User != nil {
+		s.user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			s.password = p
+		}
+		u.User = nil
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+		u.RawPath = ""
+	}
+	u.RawQuery, u.Fragment = "", ""
+	s.root = u
+	return s, nil
+}
+
+// addWebDAV downloads to dir the pdfs of the share at rawURL, in the folders of the share,
+// and adds them. A pdf is not downloaded again if its file is in dir, so that a share can
+// be mirrored by adding it again.
+func addWebDAV(ctx context.Context, rawURL, dir string) error {
+	s, err := newWebDAVShare(rawURL)
+	if err != nil {
+		return err
+	}
+	files, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.rel))
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := s.download(ctx, f, path); err != nil {
+				log.Printf("download error %s: %v", f.url, err)
+				continue
+			}
+		}
+		if err := addPDF(path); err != nil {
+			log.Printf("add error %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// webdavDir returns the dir where the pdfs of the share at rawURL are downloaded by
+// default, under the user cache dir
+func webdavDir(rawURL string) (string, error) {
+	s, err := newWebDAVShare(rawURL)
+	if err != nil {
+		return "", err
+	}
+	cachePath, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cachePath, progName, "webdav", s.root.Host, filepath.FromSlash(s.root.Path)), nil
+}
+
+// list returns the pdfs of the share, walking its folders one level at a time, since
+// servers often refuse to list a whole tree
+func (s *webdavShare) list(ctx context.Context) ([]webdavFile, error) {
+	var files []webdavFile
+	queue := []*url.URL{s.root}
+	seen := map[string]bool{s.root.Path: true}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		resps, err := s.propfind(ctx, dir)
+		if err != nil {
+			if dir == s.root {
+				return nil, err
+			}
+			log.Printf("list error %s: %v", dir, err)
+			continue
+		}
+		for _, r := range resps {
+			u, err := dir.Parse(r.Href)
+			if err != nil || u.Host != s.root.Host || !strings.HasPrefix(u.Path, s.root.Path) {
+				continue
+			}
+			prop, ok := r.prop()
+			if !ok {
+				continue
+			}
+			if prop.ResourceType.Collection != nil {
+				if !strings.HasSuffix(u.Path, "/") {
+					u.Path += "/"
+					u.RawPath = ""
+				}
+				if !seen[u.Path] {
+					seen[u.Path] = true
+					queue = append(queue, u)
+				}
+				continue
+			}
+			rel := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(u.Path, s.root.Path)), "/")
+			if rel == "" || !strings.EqualFold(path.Ext(rel), ".pdf") && prop.ContentType != "application/pdf" {
+				continue
+			}
+			files = append(files, webdavFile{url: u.String(), rel: rel})
+		}
+	}
+	return files, nil
+}
+
+// propfind returns the responses of the PROPFIND of the folder at u and its members
+func (s *webdavShare) propfind(ctx context.Context, u *url.URL) ([]davResponse, error) {
+	resp, err := s.do(ctx, "PROPFIND", u.String(), strings.NewReader(propfindXML), "1")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: %s", u, resp.Status)
+	}
+	var ms davMultistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxOutputSize)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: bad response: %w", u, err)
+	}
+	return ms.Responses, nil
+}
+
+// download saves the pdf f to the file at path
+func (s *webdavShare) download(ctx context.Context, f webdavFile, path string) error {
+	resp, err := s.do(ctx, http.MethodGet, f.url, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", f.url, resp.Status)
+	}
+	return saveBody(resp.Body, f.url, path, maxDownloadSize)
+}
+
+// do sends a request with the credentials of the share
+func (s *webdavShare) do(ctx context.Context, method, u string, body io.Reader, depth string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", progName)
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	if s.user != "" || s.password != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	return opdsClient.Do(req)
+}
+
+// davMultistatus is the response of PROPFIND
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string  `xml:"DAV: status"`
+	Prop   davProp `xml:"DAV: prop"`
+}
+
+type davProp struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ContentType string `xml:"DAV: getcontenttype"`
+}
+
+// prop returns the properties that the server found
+func (r davResponse) prop() (davProp, bool) {
+	for _, ps := range r.Propstats {
+		if f := strings.Fields(ps.Status); len(f) > 1 && f[1] == "200" {
+			return ps.Prop, true
+		}
+	}
+	return davProp{}, false
+}
+
+const propfindXML = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontenttype/></d:prop></d:propfind>`
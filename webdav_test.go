@@ -0,0 +1,110 @@
+//go:build fts5
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMultistatus = `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:">%s</d:multistatus>`
+
+const testDAVResponse = `<d:response><d:href>%s</d:href><d:propstat><d:prop>%s</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`
+
+func TestWebDAVList(t *testing.T) {
+	folder := `<d:resourcetype><d:collection/></d:resourcetype>`
+	file := func(typ string) string { return `<d:resourcetype/><d:getcontenttype>` + typ + `</d:getcontenttype>` }
+	folders := map[string][]string{
+		"/dav/books/": {
+			fmt.Sprintf(testDAVResponse, "/dav/books/", folder),
+			fmt.Sprintf(testDAVResponse, "/dav/books/sql.pdf", file("application/pdf")),
+			fmt.Sprintf(testDAVResponse, "/dav/books/notes.txt", file("text/plain")),
+			fmt.Sprintf(testDAVResponse, "/dav/books/Go%20Papers/", folder),
+			fmt.Sprintf(testDAVResponse, "/dav/other/out.pdf", file("application/pdf")),
+		},
+		"/dav/books/Go Papers/": {
+			fmt.Sprintf(testDAVResponse, "/dav/books/Go%20Papers/", folder),
+			fmt.Sprintf(testDAVResponse, "http://ignored.example/dav/books/Go%20Papers/x.pdf", file("application/pdf")),
+			fmt.Sprintf(testDAVResponse, "/dav/books/Go%20Papers/gc", file("application/pdf")),
+			`<d:response><d:href>/dav/books/Go%20Papers/gone.pdf</d:href><d:propstat><d:prop/><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat></d:response>`,
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "reader" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		resps, ok := folders[r.URL.Path]
+		if r.Method != "PROPFIND" || r.Header.Get("Depth") != "1" || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, testMultistatus, strings.Join(resps, ""))
+	}))
+	defer srv.Close()
+
+	t.Setenv("BOOKLICE_WEBDAV_USER", "reader")
+	t.Setenv("BOOKLICE_WEBDAV_PASSWORD", "secret")
+	s, err := newWebDAVShare("webdav+http://" + strings.TrimPrefix(srv.URL, "http://") + "/dav/books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := s.list(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []webdavFile{
+		{url: srv.URL + "/dav/books/sql.pdf", rel: "sql.pdf"},
+		{url: srv.URL + "/dav/books/Go%20Papers/gc", rel: "Go Papers/gc"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("list() = %v, want %v", files, want)
+	}
+
+	s.password = "wrong"
+	if _, err := s.list(context.Background()); err == nil {
+		t.Error("list() with a wrong password succeeded")
+	}
+}
+
+func TestNewWebDAVShare(t *testing.T) {
+	t.Setenv("BOOKLICE_WEBDAV_USER", "env")
+	t.Setenv("BOOKLICE_WEBDAV_PASSWORD", "envpass")
+	tests := []struct {
+		url      string
+		root     string
+		user     string
+		password string
+		err      bool
+	}{
+		{"webdav://cloud.example/remote.php/dav/files/me/Books/", "https://cloud.example/remote.php/dav/files/me/Books/", "env", "envpass", false},
+		{"webdav+http://nas:8080/books", "http://nas:8080/books/", "env", "envpass", false},
+		{"webdav://me@cloud.example/books", "https://cloud.example/books/", "me", "envpass", false},
+		{"webdav://me:pw@cloud.example/", "https://cloud.example/", "me", "pw", false},
+		{"https://cloud.example/books", "", "", "", true},
+		{"webdav:///books", "", "", "", true},
+	}
+	for _, tt := range tests {
+		s, err := newWebDAVShare(tt.url)
+		if tt.err {
+			if err == nil {
+				t.Errorf("newWebDAVShare(%q) succeeded", tt.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newWebDAVShare(%q) failed: %v", tt.url, err)
+			continue
+		}
+		if s.root.String() != tt.root || s.user != tt.user || s.password != tt.password {
+			t.Errorf("newWebDAVShare(%q) = %s %s %s, want %s %s %s", tt.url, s.root, s.user, s.password, tt.root, tt.user, tt.password)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+//go:build fts5
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// importZotero adds the pdfs attached to the items of the Zotero data dir, like ~/Zotero,
+// with the titles, authors and tags of their items
+func importZotero(dir string) error {
+	pdfs, err := zoteroPDFs(dir)
+	if err != nil {
+		return err
+	}
+	addImported(pdfs)
+	return nil
+}
+
+// zoteroPDFs reads the pdf attachments from the zotero.sqlite of the data dir. The files
+// stored by Zotero are in dir/storage, the linked files are where they were linked from.
+// Files linked relative to a base dir are skipped, the base dir is a setting of Zotero.
+func zoteroPDFs(dir string) ([]importedPDF, error) {
+	database := filepath.Join(dir, "zotero.sqlite")
+	if _, err := os.Stat(database); err != nil {
+		return nil, fmt.Errorf("%s is not a Zotero data dir: %w", dir, err)
+	}
+	lib, err := sql.Open(driverName, "file:"+database+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer lib.Close()
+
+	rows, err := lib.Query(zoteroPDFsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the attachments of %s, is Zotero running? %w", database, err)
+	}
+	defer rows.Close()
+
+	var pdfs []importedPDF
+	for rows.Next() {
+		var key, path, title, authors, tags string
+		if err := rows.Scan(&key, &path, &title, &authors, &tags); err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(path, "storage:"):
+			path = filepath.Join(dir, "storage", key, strings.TrimPrefix(path, "storage:"))
+		case strings.HasPrefix(path, "attachments:"):
+			log.Printf("skipping %s, it is relative to the base dir of Zotero", strings.TrimPrefix(path, "attachments:"))
+			continue
+		}
+		p := importedPDF{path: path, meta: pdfMeta{title: title, authors: authors}}
+		if tags != "" {
+			p.meta.tags = strings.Split(tags, "\x1f")
+		}
+		pdfs = append(pdfs, p)
+	}
+	return pdfs, rows.Err()
+}
+
+// exportZotero writes to w the pdfs with ids, or all if ids is empty, as BibTeX entries
+// that Zotero imports with links to the pdf files. The DOI and the year are looked for
+// in the first pages of the text.
+func exportZotero(w io.Writer, ids []int) error {
+	missing := make(map[int]bool)
+	for _, id := range ids {
+		missing[id] = true
+	}
+	rows, err := db.Query(exportSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id                                                int
+			path, title, authors, isbns, kws, abstract, start string
+		)
+		if err := rows.Scan(&id, &path, &title, &authors, &isbns, &kws, &abstract, &start); err != nil {
+			return err
+		}
+		if len(ids) > 0 && !missing[id] {
+			continue
+		}
+		delete(missing, id)
+
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		pages := strings.Split(start, pageSeparator)
+		doi, year := findDOI(pages), findYear(pages)
+		isbn, _, _ := strings.Cut(isbns, " ")
+		e := bibEntry{typ: "misc", key: bibKey(id, authors, year)}
+		if isbn != "" {
+			e.typ = "book"
+		} else if doi != "" {
+			e.typ = "article"
+		}
+		e.fields = [][2]string{
+			{"title", title},
+			{"author", bibAuthors(authors)},
+			{"year", year},
+			{"doi", doi},
+			{"isbn", isbn},
+			{"keywords", strings.Join(strings.Fields(kws), ", ")},
+			{"abstract", abstract},
+			{"file", bibFile(title, path)},
+		}
+		if err := e.write(w); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id := range missing {
+		return fmt.Errorf("pdf with id %d not found", id)
+	}
+	return nil
+}
+
+// exportSQL lists the pdfs with the start of their text, where the DOI and the year are
+const exportSQL = `SELECT id, path, IFNULL(title, ''), IFNULL(authors, ''), IFNULL(isbn, ''), IFNULL(keywords, ''), IFNULL(abstract, ''), ` +
+	`substr(IFNULL(inflate(text), ''), 1, 20000) FROM pdfs WHERE ` + liveSQL + ` ORDER BY id`
+
+// zoteroPDFsSQL lists the pdf attachments of a Zotero database that are not in the trash,
+// with the key of the attachment, that names its dir in storage, and the title, the
+// authors and the tags of its parent item, or of itself if it is a standalone pdf. The
+// tags are separated by the unit separator \x1f.
+const zoteroPDFsSQL = `SELECT att.key, itemAttachments.path, ` +
+	`IFNULL((SELECT itemDataValues.value FROM itemData JOIN fields ON fields.fieldID = itemData.fieldID ` +
+	`JOIN itemDataValues ON itemDataValues.valueID = itemData.valueID ` +
+	`WHERE itemData.itemID = IFNULL(itemAttachments.parentItemID, itemAttachments.itemID) AND fields.fieldName = 'title'), ''), ` +
+	`IFNULL((SELECT group_concat(name, ' & ') FROM (SELECT CASE WHEN creators.fieldMode = 1 OR creators.firstName = '' THEN creators.lastName ` +
+	`ELSE creators.lastName || ', ' || creators.firstName END AS name FROM itemCreators JOIN creators ON creators.creatorID = itemCreators.creatorID ` +
+	`WHERE itemCreators.itemID = itemAttachments.parentItemID ORDER BY itemCreators.orderIndex)), ''), ` +
+	`IFNULL((SELECT group_concat(tags.name, char(31)) FROM itemTags JOIN tags ON tags.tagID = itemTags.tagID ` +
+	`WHERE itemTags.itemID = IFNULL(itemAttachments.parentItemID, itemAttachments.itemID)), '') ` +
+	`FROM itemAttachments JOIN items AS att ON att.itemID = itemAttachments.itemID ` +
+	`WHERE itemAttachments.contentType = 'application/pdf' AND itemAttachments.path IS NOT NULL ` +
+	`AND itemAttachments.itemID NOT IN (SELECT itemID FROM deletedItems) ` +
+	`AND IFNULL(itemAttachments.parentItemID, 0) NOT IN (SELECT itemID FROM deletedItems) ORDER BY itemAttachments.itemID`